@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dacort/babble/internal/config"
+	"github.com/dacort/babble/internal/server"
+)
+
+// serverProbeTimeout bounds how long the CLI waits to find out whether a
+// server is running before falling back to editing the file directly.
+const serverProbeTimeout = 500 * time.Millisecond
+
+// serverRequestTimeout bounds every other request to a running server.
+const serverRequestTimeout = 5 * time.Second
+
+// serverClient talks to a running babble server.
+type serverClient struct {
+	base  string // URL prefix for requests
+	where string // where the server was found, for messages
+	token string // sent as a bearer token, if set
+	http  *http.Client
+}
+
+// findServer returns a client for the babble server running with cfg, or nil
+// if none answers. The server's Unix socket is tried first; its file
+// permissions stand in for the auth token. Otherwise the TCP address is
+// tried, with the server's token and, over TLS, trusting its certificate.
+func findServer(cfg *config.Config, stateDir string) *serverClient {
+	if cfg.Listen != "tcp" {
+		path := server.SocketPath(cfg, stateDir)
+		dialer := &net.Dialer{}
+		c := &serverClient{
+			base:  "http://babble",
+			where: path,
+			http: &http.Client{
+				Timeout: serverRequestTimeout,
+				Transport: &http.Transport{
+					DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+						return dialer.DialContext(ctx, "unix", path)
+					},
+				},
+			},
+		}
+		if c.probe() {
+			return c
+		}
+	}
+	if cfg.Listen == "unix" {
+		return nil
+	}
+
+	scheme := "http"
+	transport := http.DefaultTransport
+	if certFile := server.CertFile(cfg, stateDir); certFile != "" {
+		pem, err := os.ReadFile(certFile)
+		if err != nil {
+			return nil
+		}
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(pem)
+		transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+		scheme = "https"
+	}
+	host := cfg.BindAddress
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	base := scheme + "://" + net.JoinHostPort(host, strconv.Itoa(cfg.Port))
+	c := &serverClient{
+		base:  base,
+		where: base,
+		token: server.ReadToken(cfg, stateDir),
+		http:  &http.Client{Timeout: serverRequestTimeout, Transport: transport},
+	}
+	if c.probe() {
+		return c
+	}
+	return nil
+}
+
+// probe reports whether a babble server answers at c within
+// serverProbeTimeout.
+func (c *serverClient) probe() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), serverProbeTimeout)
+	defer cancel()
+	req, err := c.newRequest(http.MethodGet, "/api/config", nil)
+	if err != nil {
+		return false
+	}
+	resp, err := c.http.Do(req.WithContext(ctx))
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// newRequest returns a request for path on the server, carrying the token if
+// there is one.
+func (c *serverClient) newRequest(method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, c.base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
@@ -0,0 +1,418 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/dacort/babble/internal/config"
+	"github.com/dacort/babble/internal/jsonpatch"
+)
+
+// runConfig dispatches the "babble config" subcommands. Keys are dotted
+// paths into config.json, e.g. "port" or "categoryVolumes.error". Commands
+// that change settings go through a running server when there is one, so
+// that the change applies live.
+func runConfig(args []string) error {
+	fs := flag.NewFlagSet("config", flag.ExitOnError)
+	paths := addPathFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "migrate: show the changes without writing them")
+	args = parseArgs(fs, args)
+	if len(args) == 0 {
+		printConfigUsage()
+		return nil
+	}
+	sub := args[0]
+	if *dryRun && sub != "migrate" {
+		return fmt.Errorf("--dry-run applies only to babble config migrate")
+	}
+
+	store := newConfigStore(paths.configPath(), paths.packs(), paths.stateDir())
+	switch sub {
+	case "list":
+		return runConfigList(store)
+	case "get":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: babble config get <key>")
+		}
+		return runConfigGet(store, args[1])
+	case "set":
+		key, value, ok := parseAssignment(args[1:])
+		if !ok {
+			return fmt.Errorf("usage: babble config set <key>=<value>")
+		}
+		return runConfigSet(store, key, value)
+	case "unset":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: babble config unset <key>")
+		}
+		return runConfigUnset(store, args[1])
+	case "edit":
+		return runConfigEdit(store)
+	case "path":
+		fmt.Println(store.path)
+		return nil
+	case "reset":
+		return runConfigReset(store)
+	case "migrate":
+		return runConfigMigrate(store.path, *dryRun)
+	default:
+		return fmt.Errorf("unknown config command: %s", sub)
+	}
+}
+
+// printConfigUsage lists the "babble config" subcommands.
+func printConfigUsage() {
+	fmt.Println("Usage: babble config <command>")
+	fmt.Println("  list                   Show every setting")
+	fmt.Println("  get <key>              Show one setting, e.g. categoryVolumes.error")
+	fmt.Println("  set <key>=<value>      Change a setting (values are JSON, or plain strings)")
+	fmt.Println("  unset <key>            Remove a setting, restoring its default")
+	fmt.Println("  edit                   Open config.json in $EDITOR and validate the result")
+	fmt.Println("  path                   Print the config file location")
+	fmt.Println("  reset                  Restore all defaults (keeps a backup)")
+	fmt.Println("  migrate [--dry-run]    Upgrade config.json to the current schema version")
+}
+
+// parseAssignment accepts "key=value" or "key value".
+func parseAssignment(args []string) (key, value string, ok bool) {
+	switch len(args) {
+	case 1:
+		return strings.Cut(args[0], "=")
+	case 2:
+		return args[0], args[1], true
+	default:
+		return "", "", false
+	}
+}
+
+// splitKey splits a dotted key into its path segments.
+func splitKey(key string) ([]string, error) {
+	parts := strings.Split(key, ".")
+	for _, p := range parts {
+		if p == "" {
+			return nil, fmt.Errorf("invalid key %q", key)
+		}
+	}
+	return parts, nil
+}
+
+// lookup returns the value at path within doc.
+func lookup(doc map[string]any, path []string) (any, bool) {
+	var cur any = doc
+	for _, p := range path {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[p]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// nestedPatch builds a merge patch that sets path to value.
+func nestedPatch(path []string, value any) map[string]any {
+	patch := map[string]any{path[len(path)-1]: value}
+	for i := len(path) - 2; i >= 0; i-- {
+		patch = map[string]any{path[i]: patch}
+	}
+	return patch
+}
+
+// formatValue renders a setting for display: strings as-is, anything else
+// as JSON.
+func formatValue(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// runConfigList prints every setting as key = value, with maps flattened
+// into dotted keys.
+func runConfigList(store *configStore) error {
+	doc, err := store.load()
+	if err != nil {
+		return err
+	}
+	var walk func(prefix string, m map[string]any)
+	walk = func(prefix string, m map[string]any) {
+		for _, k := range slices.Sorted(maps.Keys(m)) {
+			key := prefix + k
+			if sub, ok := m[k].(map[string]any); ok && len(sub) > 0 {
+				walk(key+".", sub)
+				continue
+			}
+			data, _ := json.Marshal(m[k])
+			fmt.Printf("%s = %s\n", key, data)
+		}
+	}
+	walk("", doc)
+	return nil
+}
+
+// runConfigGet prints the value of one setting.
+func runConfigGet(store *configStore, key string) error {
+	path, err := splitKey(key)
+	if err != nil {
+		return err
+	}
+	doc, err := store.load()
+	if err != nil {
+		return err
+	}
+	v, ok := lookup(doc, path)
+	if !ok {
+		return fmt.Errorf("%s is not set", key)
+	}
+	fmt.Println(formatValue(v))
+	return nil
+}
+
+// runConfigSet changes one setting to the value parseValue makes of raw.
+func runConfigSet(store *configStore, key, raw string) error {
+	path, err := splitKey(key)
+	if err != nil {
+		return err
+	}
+	doc, err := store.load()
+	if err != nil {
+		return err
+	}
+
+	value := parseValue(doc, path, raw)
+	if value == nil {
+		return fmt.Errorf("use `babble config unset %s` to remove a setting", key)
+	}
+
+	patch, err := json.Marshal(nestedPatch(path, value))
+	if err != nil {
+		return err
+	}
+	return store.patch(mergePatchType, patch)
+}
+
+// parseValue interprets raw as the new value of the setting at path in doc.
+// It is parsed as JSON unless the setting is currently a string or raw is
+// not valid JSON, so both `set port=4000` and `set activePack=pacman` do what
+// you'd expect, and `set activePack=1` keeps a string pack name a string.
+func parseValue(doc map[string]any, path []string, raw string) any {
+	if cur, ok := lookup(doc, path); ok && isString(cur) {
+		return raw
+	}
+	var value any
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		return raw
+	}
+	return value
+}
+
+// isString reports whether v is a string.
+func isString(v any) bool {
+	_, ok := v.(string)
+	return ok
+}
+
+// runConfigUnset removes one setting. Top-level settings revert to their
+// defaults; map entries such as categoryVolumes.error are deleted.
+func runConfigUnset(store *configStore, key string) error {
+	path, err := splitKey(key)
+	if err != nil {
+		return err
+	}
+	doc, err := store.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := lookup(doc, path); !ok {
+		return fmt.Errorf("%s is not set", key)
+	}
+
+	patch, err := json.Marshal(nestedPatch(path, nil))
+	if err != nil {
+		return err
+	}
+	return store.patch(mergePatchType, patch)
+}
+
+// runConfigReset restores every setting to its default, first copying the
+// current file to config.json.bak.
+func runConfigReset(store *configStore) error {
+	if data, err := os.ReadFile(store.path); err == nil {
+		backup := store.path + ".bak"
+		if err := config.WriteBackup(backup, data); err != nil {
+			return err
+		}
+		fmt.Printf("Saved previous config to %s.\n", backup)
+	}
+
+	patch, err := json.Marshal([]jsonpatch.Operation{{
+		Op:    "replace",
+		Path:  "",
+		Value: mustMarshal(config.Default()),
+	}})
+	if err != nil {
+		return err
+	}
+	return store.patch(jsonPatchType, patch)
+}
+
+// mustMarshal marshals a value that cannot fail to encode.
+func mustMarshal(v any) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// runConfigEdit opens a copy of the config in $VISUAL or $EDITOR (vi if
+// neither is set to more than spaces). When the editor exits the copy is
+// validated and applied as a whole; if it is invalid the original is left
+// untouched and the copy is kept so the edit is not lost.
+func runConfigEdit(store *configStore) error {
+	cfg, err := config.Load(store.path)
+	if err != nil {
+		return err
+	}
+	original, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp("", "babble-config-*.json")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(append(original, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	tmp.Close()
+
+	editor := os.Getenv("VISUAL")
+	if strings.TrimSpace(editor) == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if strings.TrimSpace(editor) == "" {
+		editor = "vi"
+	}
+	// The editor variable may include arguments, e.g. "code --wait".
+	fields := strings.Fields(editor)
+	cmd := exec.Command(fields[0], append(fields[1:], tmp.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("run %s: %w (your edits are in %s)", editor, err, tmp.Name())
+	}
+
+	edited, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(bytes.TrimSpace(edited), bytes.TrimSpace(original)) {
+		os.Remove(tmp.Name())
+		fmt.Println("No changes.")
+		return nil
+	}
+
+	// Replace the whole document so that deleted keys are deleted.
+	patch, err := json.Marshal([]jsonpatch.Operation{{Op: "replace", Path: "", Value: edited}})
+	if err != nil {
+		return fmt.Errorf("%s is not valid JSON: %w (your edits are kept there)", tmp.Name(), err)
+	}
+	if err := store.patch(jsonPatchType, patch); err != nil {
+		return fmt.Errorf("%w\nyour edits are kept in %s", err, tmp.Name())
+	}
+	os.Remove(tmp.Name())
+	return nil
+}
+
+// runConfigMigrate upgrades the config file at path to
+// config.CurrentVersion, keeping a backup of the original. With dryRun it
+// only prints the migrations that would run and a diff of the resulting file.
+func runConfigMigrate(path string, dryRun bool) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		fmt.Printf("No config file at %s; nothing to migrate.\n", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	migrated, applied, err := config.Migrate(data)
+	if err != nil {
+		return fmt.Errorf("config: migrate %s: %w", path, err)
+	}
+	if len(applied) == 0 {
+		fmt.Printf("%s is already at version %d.\n", path, config.CurrentVersion)
+		return nil
+	}
+
+	for _, m := range applied {
+		fmt.Printf("  v%d → v%d  %s\n", m.From, m.From+1, m.Description)
+	}
+
+	if dryRun {
+		fmt.Printf("\n--- %s\n+++ %s (version %d)\n", path, path, config.CurrentVersion)
+		fmt.Print(lineDiff(string(data), string(migrated)))
+		return nil
+	}
+
+	_, backup, err := config.MigrateFile(path)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Upgraded %s to version %d (backup at %s).\n", path, config.CurrentVersion, backup)
+	return nil
+}
+
+// lineDiff returns a line-by-line diff of a and b, with each line prefixed by
+// "-" (only in a), "+" (only in b) or " " (in both). It uses a plain
+// longest-common-subsequence table, which is fine for config-sized files.
+func lineDiff(a, b string) string {
+	x := strings.Split(strings.TrimSuffix(a, "\n"), "\n")
+	y := strings.Split(strings.TrimSuffix(b, "\n"), "\n")
+
+	// lcs[i][j] is the LCS length of x[i:] and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var sb strings.Builder
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			sb.WriteString(" " + x[i] + "\n")
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			sb.WriteString("-" + x[i] + "\n")
+			i++
+		default:
+			sb.WriteString("+" + y[j] + "\n")
+			j++
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/dacort/babble/internal/config"
+	"github.com/dacort/babble/internal/jsonpatch"
+)
+
+// Patch media types understood by PATCH /api/config.
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+// configStore applies config edits either through a running server, so they
+// take effect live, or directly to the config file when no server answers.
+type configStore struct {
+	path     string
+	packsDir string
+	stateDir string
+}
+
+// newConfigStore returns a configStore for the config file at path, which
+// validates activePack against the packs in packsDir. A running server is
+// looked for using the socket, token and certificate in stateDir.
+func newConfigStore(path, packsDir, stateDir string) *configStore {
+	return &configStore{path: path, packsDir: packsDir, stateDir: stateDir}
+}
+
+// load returns the config file's contents as a generic JSON document.
+func (s *configStore) load() (map[string]any, error) {
+	cfg, err := config.Load(s.path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// server returns a client for the running babble server, or nil if none is
+// reachable.
+func (s *configStore) server() *serverClient {
+	cfg, err := config.Load(s.path)
+	if err != nil {
+		return nil
+	}
+	return findServer(cfg, s.stateDir)
+}
+
+// patch applies a merge patch or JSON Patch (per contentType) to the config
+// and reports where the change was made. The result is validated either way.
+func (s *configStore) patch(contentType string, patch []byte) error {
+	if c := s.server(); c != nil {
+		if err := s.patchServer(c, contentType, patch); err != nil {
+			return err
+		}
+		fmt.Printf("Updated running server at %s.\n", c.where)
+		return nil
+	}
+	if err := s.patchFile(contentType, patch); err != nil {
+		return err
+	}
+	fmt.Printf("Updated %s.\n", s.path)
+	return nil
+}
+
+// patchServer sends patch to PATCH /api/config on the server c talks to.
+func (s *configStore) patchServer(c *serverClient, contentType string, patch []byte) error {
+	req, err := c.newRequest(http.MethodPatch, "/api/config", bytes.NewReader(patch))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("update server config: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnprocessableEntity:
+		var verr config.ValidationError
+		if err := json.NewDecoder(resp.Body).Decode(&verr); err != nil {
+			return fmt.Errorf("server rejected config: %w", err)
+		}
+		return &verr
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server rejected config: %s", strings.TrimSpace(string(body)))
+	}
+}
+
+// patchFile applies patch to the config file directly, with the same
+// validation the server performs. The default pack is installed first, as
+// serve would, so that a fresh config validates before the first serve.
+func (s *configStore) patchFile(contentType string, patch []byte) error {
+	ensureDefaultPack(s.packsDir)
+
+	cfg, err := config.Load(s.path)
+	if err != nil {
+		return err
+	}
+	doc, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	var patched []byte
+	if contentType == jsonPatchType {
+		patched, err = jsonpatch.Apply(doc, patch)
+	} else {
+		patched, err = jsonpatch.MergePatch(doc, patch)
+	}
+	if err != nil {
+		return err
+	}
+
+	cfg, err = config.Parse(patched)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Validate(s.packsDir); err != nil {
+		return err
+	}
+	return config.Save(cfg, s.path)
+}
@@ -0,0 +1,370 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/dacort/babble/internal/config"
+)
+
+// TestParseAssignment checks both spellings of a setting and the argument
+// counts that are rejected.
+func TestParseAssignment(t *testing.T) {
+	tests := []struct {
+		args       []string
+		key, value string
+		ok         bool
+	}{
+		{[]string{"port=4000"}, "port", "4000", true},
+		{[]string{"port", "4000"}, "port", "4000", true},
+		{[]string{"redactPatterns=a=b"}, "redactPatterns", "a=b", true},
+		{[]string{"activePack="}, "activePack", "", true},
+		{[]string{"port"}, "port", "", false},
+		{nil, "", "", false},
+		{[]string{"port", "4000", "extra"}, "", "", false},
+	}
+	for _, tt := range tests {
+		key, value, ok := parseAssignment(tt.args)
+		if key != tt.key || value != tt.value || ok != tt.ok {
+			t.Errorf("parseAssignment(%q) = %q, %q, %v; want %q, %q, %v", tt.args, key, value, ok, tt.key, tt.value, tt.ok)
+		}
+	}
+}
+
+// TestSplitKey checks dotted keys and the empty segments that are rejected.
+func TestSplitKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want []string // nil if the key is invalid
+	}{
+		{"port", []string{"port"}},
+		{"categoryVolumes.error", []string{"categoryVolumes", "error"}},
+		{"a.b.c", []string{"a", "b", "c"}},
+		{"", nil},
+		{".port", nil},
+		{"port.", nil},
+		{"categoryVolumes..error", nil},
+	}
+	for _, tt := range tests {
+		got, err := splitKey(tt.key)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("splitKey(%q) = %q, want an error", tt.key, got)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("splitKey(%q) = %q, %v; want %q", tt.key, got, err, tt.want)
+		}
+	}
+}
+
+// TestNestedPatch checks that the merge patch nests the value under every
+// segment of the path.
+func TestNestedPatch(t *testing.T) {
+	tests := []struct {
+		path  []string
+		value any
+		want  map[string]any
+	}{
+		{[]string{"port"}, 4000.0, map[string]any{"port": 4000.0}},
+		{[]string{"categoryVolumes", "error"}, nil, map[string]any{"categoryVolumes": map[string]any{"error": nil}}},
+		{[]string{"a", "b", "c"}, "x", map[string]any{"a": map[string]any{"b": map[string]any{"c": "x"}}}},
+	}
+	for _, tt := range tests {
+		if got := nestedPatch(tt.path, tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("nestedPatch(%q, %v) = %v, want %v", tt.path, tt.value, got, tt.want)
+		}
+	}
+}
+
+// TestParseValue checks when a value given to `config set` is taken as JSON
+// and when it is kept as a string.
+func TestParseValue(t *testing.T) {
+	doc := map[string]any{
+		"port":            3333.0,
+		"activePack":      "default",
+		"categoryVolumes": map[string]any{"error": 0.5},
+	}
+	tests := []struct {
+		key  string
+		raw  string
+		want any
+	}{
+		{"port", "4000", 4000.0},
+		{"port", `"4000"`, "4000"},
+		{"port", "abc", "abc"},
+		{"port", "null", nil},
+		// A setting that is currently a string stays one.
+		{"activePack", "1", "1"},
+		{"activePack", "true", "true"},
+		{"activePack", `"quoted"`, `"quoted"`},
+		{"categoryVolumes.error", "0.8", 0.8},
+		// Settings not yet present are parsed as JSON where possible.
+		{"categoryVolumes.write", "0.3", 0.3},
+		{"redactPatterns", `["a","b"]`, []any{"a", "b"}},
+		{"detailLevels", `{"read":"none"}`, map[string]any{"read": "none"}},
+		{"bindAddress", "0.0.0.0", "0.0.0.0"},
+		// A path through a non-object is not present either.
+		{"activePack.name", "1", 1.0},
+	}
+	for _, tt := range tests {
+		path, err := splitKey(tt.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := parseValue(doc, path, tt.raw); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseValue(%s, %s) = %#v, want %#v", tt.key, tt.raw, got, tt.want)
+		}
+	}
+}
+
+// TestLineDiff checks unchanged, changed, added and removed lines.
+func TestLineDiff(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{"a\nb\n", "a\nb\n", " a\n b\n"},
+		{"a\nb\nc\n", "a\nx\nc\n", " a\n-b\n+x\n c\n"},
+		{"a\nb\n", "a\nb\nc\n", " a\n b\n+c\n"},
+		{"a\nb\n", "b\n", "-a\n b\n"},
+		{"a\nb", "a\nb\n", " a\n b\n"},
+		{"{\n  \"port\": 1\n}\n", "{\n  \"port\": 1,\n  \"version\": 2\n}\n", " {\n-  \"port\": 1\n+  \"port\": 1,\n+  \"version\": 2\n }\n"},
+	}
+	for _, tt := range tests {
+		if got := lineDiff(tt.a, tt.b); got != tt.want {
+			t.Errorf("lineDiff(%q, %q) =\n%s\nwant\n%s", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// TestParseArgs checks that flags are accepted anywhere among the
+// positional arguments.
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		args       []string
+		positional []string
+		config     string
+		dryRun     bool
+	}{
+		{[]string{"get", "port"}, []string{"get", "port"}, "", false},
+		{[]string{"--config", "/c.json", "get", "port"}, []string{"get", "port"}, "/c.json", false},
+		{[]string{"get", "--config", "/c.json", "port"}, []string{"get", "port"}, "/c.json", false},
+		{[]string{"migrate", "--dry-run"}, []string{"migrate"}, "", true},
+		{[]string{"set", "port=1", "-config=/c.json", "-dry-run"}, []string{"set", "port=1"}, "/c.json", true},
+		{nil, nil, "", false},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("config", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		p := addPathFlags(fs)
+		dryRun := fs.Bool("dry-run", false, "")
+
+		got := parseArgs(fs, tt.args)
+		if !slices.Equal(got, tt.positional) || p.config != tt.config || *dryRun != tt.dryRun {
+			t.Errorf("parseArgs(%q) = %q, config %q, dry-run %v; want %q, %q, %v",
+				tt.args, got, p.config, *dryRun, tt.positional, tt.config, tt.dryRun)
+		}
+	}
+}
+
+// fileStore returns a configStore for a temp config file, with cfg applied
+// to the defaults, that never finds a running server: it listens only on a
+// socket that does not exist.
+func fileStore(t *testing.T, edit func(cfg *config.Config)) *configStore {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := config.Default()
+	cfg.Listen = "unix"
+	cfg.SocketPath = filepath.Join(dir, "none.sock")
+	if edit != nil {
+		edit(cfg)
+	}
+	path := filepath.Join(dir, "config.json")
+	if err := config.Save(cfg, path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	return newConfigStore(path, filepath.Join(dir, "packs"), filepath.Join(dir, "state"))
+}
+
+// TestConfigFile checks set, unset and reset against the config file when
+// no server is running.
+func TestConfigFile(t *testing.T) {
+	store := fileStore(t, func(cfg *config.Config) {
+		cfg.CategoryVolumes = map[string]float64{"error": 0.5}
+	})
+	load := func() *config.Config {
+		t.Helper()
+		cfg, err := config.Load(store.path)
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		return cfg
+	}
+
+	if err := runConfigSet(store, "port", "4000"); err != nil {
+		t.Fatalf("set port: %v", err)
+	}
+	if err := runConfigSet(store, "categoryVolumes.write", "0.25"); err != nil {
+		t.Fatalf("set categoryVolumes.write: %v", err)
+	}
+	cfg := load()
+	if cfg.Port != 4000 || !maps.Equal(cfg.CategoryVolumes, map[string]float64{"error": 0.5, "write": 0.25}) {
+		t.Errorf("after set: port %d, volumes %v", cfg.Port, cfg.CategoryVolumes)
+	}
+
+	if err := runConfigSet(store, "port", "-1"); err == nil {
+		t.Error("set port=-1 succeeded, want a validation error")
+	}
+	if err := runConfigSet(store, "port", "null"); err == nil {
+		t.Error("set port=null succeeded, want an error")
+	}
+	if cfg := load(); cfg.Port != 4000 {
+		t.Errorf("after rejected sets: port %d, want 4000", cfg.Port)
+	}
+
+	if err := runConfigUnset(store, "categoryVolumes.error"); err != nil {
+		t.Fatalf("unset categoryVolumes.error: %v", err)
+	}
+	if err := runConfigUnset(store, "port"); err != nil {
+		t.Fatalf("unset port: %v", err)
+	}
+	cfg = load()
+	if cfg.Port != config.Default().Port || !maps.Equal(cfg.CategoryVolumes, map[string]float64{"write": 0.25}) {
+		t.Errorf("after unset: port %d, volumes %v", cfg.Port, cfg.CategoryVolumes)
+	}
+	if err := runConfigUnset(store, "categoryVolumes.error"); err == nil {
+		t.Error("unset of a missing key succeeded, want an error")
+	}
+
+	before, err := os.ReadFile(store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runConfigReset(store); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if backup, err := os.ReadFile(store.path + ".bak"); err != nil || !bytes.Equal(backup, before) {
+		t.Errorf("backup = %q, %v; want the config before reset", backup, err)
+	}
+	if cfg := load(); !reflect.DeepEqual(cfg, config.Default()) {
+		t.Errorf("after reset = %+v, want the defaults", cfg)
+	}
+}
+
+// TestConfigServer checks that set, unset and reset send the matching
+// patches to a running server instead of touching the file.
+func TestConfigServer(t *testing.T) {
+	type request struct {
+		contentType string
+		body        string
+	}
+	var patches []request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/config" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == http.MethodPatch {
+			body, _ := io.ReadAll(r.Body)
+			patches = append(patches, request{r.Header.Get("Content-Type"), string(body)})
+			if strings.Contains(string(body), `"port":-1`) {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				json.NewEncoder(w).Encode(config.ValidationError{Errors: []config.FieldError{{Field: "port", Message: "must be between 1 and 65535"}}})
+				return
+			}
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+	port, err := strconv.Atoi(srv.URL[strings.LastIndex(srv.URL, ":")+1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := fileStore(t, func(cfg *config.Config) {
+		cfg.Listen = "tcp"
+		cfg.Port = port
+		cfg.CategoryVolumes = map[string]float64{"error": 0.5}
+	})
+	before, err := os.ReadFile(store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runConfigSet(store, "categoryVolumes.write", "0.25"); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	var verr *config.ValidationError
+	if err := runConfigSet(store, "port", "-1"); !errors.As(err, &verr) || len(verr.Errors) != 1 || verr.Errors[0].Field != "port" {
+		t.Errorf("set port=-1: %v, want the server's validation error", err)
+	}
+	if err := runConfigUnset(store, "categoryVolumes.error"); err != nil {
+		t.Fatalf("unset: %v", err)
+	}
+	if err := runConfigReset(store); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+
+	want := []request{
+		{mergePatchType, `{"categoryVolumes":{"write":0.25}}`},
+		{mergePatchType, `{"port":-1}`},
+		{mergePatchType, `{"categoryVolumes":{"error":null}}`},
+		{jsonPatchType, `[{"op":"replace","path":"","value":` + string(mustMarshal(config.Default())) + `}]`},
+	}
+	if !slices.Equal(patches, want) {
+		t.Errorf("patches =\n%q\nwant\n%q", patches, want)
+	}
+	if after, err := os.ReadFile(store.path); err != nil || !bytes.Equal(after, before) {
+		t.Errorf("config file changed to %q, %v; want it left to the server", after, err)
+	}
+}
+
+// TestConfigEditBlankEditor checks that an editor variable holding only
+// spaces is passed over rather than run.
+func TestConfigEditBlankEditor(t *testing.T) {
+	store := fileStore(t, nil)
+	t.Setenv("VISUAL", "  ")
+	t.Setenv("EDITOR", "true")
+	if err := runConfigEdit(store); err != nil {
+		t.Errorf("edit: %v", err)
+	}
+}
+
+// TestRunConfigFlags checks that flags may come before the subcommand and
+// that --dry-run is refused by everything but migrate.
+func TestRunConfigFlags(t *testing.T) {
+	t.Setenv("BABBLE_HOME", t.TempDir())
+	store := fileStore(t, nil)
+
+	if err := runConfig([]string{"--config", store.path, "--packs-dir", store.packsDir, "set", "port=4000"}); err != nil {
+		t.Fatalf("config --config … set: %v", err)
+	}
+	if err := runConfig([]string{"set", "port=5000", "--dry-run", "--config", store.path}); err == nil {
+		t.Error("set --dry-run succeeded, want an error")
+	}
+	if err := runConfig([]string{"--dry-run", "--config", store.path, "migrate"}); err != nil {
+		t.Errorf("migrate --dry-run: %v", err)
+	}
+	cfg, err := config.Load(store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != 4000 {
+		t.Errorf("port = %d, want 4000", cfg.Port)
+	}
+}
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/dacort/babble/internal/config"
+	"github.com/dacort/babble/internal/instance"
+	"github.com/dacort/babble/internal/server"
+)
+
+// Version is the babble version, reported by GET /api/health. main sets it.
+var Version = "dev"
+
+// stopTimeout bounds how long babble stop waits for the server to exit.
+const stopTimeout = 10 * time.Second
+
+// errNotRunning is returned by status and stop when no server is running.
+var errNotRunning = errors.New("babble is not running")
+
+// health fetches GET /api/health from the server.
+func (c *serverClient) health() (*server.Health, error) {
+	req, err := c.newRequest(http.MethodGet, "/api/health", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("query server at %s: %w", c.where, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("query server at %s: %s", c.where, resp.Status)
+	}
+	var h server.Health
+	if err := json.NewDecoder(resp.Body).Decode(&h); err != nil {
+		return nil, fmt.Errorf("query server at %s: %w", c.where, err)
+	}
+	return &h, nil
+}
+
+// runningServer returns a client for the server running with the config at
+// configPath, and its health, or errNotRunning.
+func runningServer(configPath, stateDir string) (*serverClient, *server.Health, error) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	c := findServer(cfg, stateDir)
+	if c == nil {
+		if pid, ok := instance.Running(stateDir); ok {
+			return nil, nil, fmt.Errorf("babble is running (pid %d) but not answering", pid)
+		}
+		return nil, nil, errNotRunning
+	}
+	h, err := c.health()
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, h, nil
+}
+
+// runStatus implements "babble status": it reports whether a server is
+// running and, if so, its version, PID, uptime and addresses.
+func runStatus(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	paths := addPathFlags(fs)
+	if len(parseArgs(fs, args)) != 0 {
+		return fmt.Errorf("usage: babble status")
+	}
+
+	_, h, err := runningServer(paths.configPath(), paths.stateDir())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("babble %s is running (pid %d)\n", h.Version, h.PID)
+	fmt.Printf("  uptime   %s (since %s)\n", h.Uptime, h.StartedAt.Local().Format(time.DateTime))
+	if h.URL != "" {
+		fmt.Printf("  url      %s\n", h.URL)
+	}
+	if h.Socket != "" {
+		fmt.Printf("  socket   %s\n", h.Socket)
+	}
+	fmt.Printf("  clients  %d\n", h.Clients)
+	return nil
+}
+
+// runStop implements "babble stop": it asks the running server to shut down
+// gracefully and waits for it to exit. A server that does not answer is
+// sent SIGTERM instead.
+func runStop(args []string) error {
+	fs := flag.NewFlagSet("stop", flag.ExitOnError)
+	paths := addPathFlags(fs)
+	if len(parseArgs(fs, args)) != 0 {
+		return fmt.Errorf("usage: babble stop")
+	}
+	stateDir := paths.stateDir()
+
+	pid, ok := instance.Running(stateDir)
+	if !ok {
+		return errNotRunning
+	}
+
+	if err := requestShutdown(paths.configPath(), stateDir); err != nil {
+		if pid == 0 {
+			return err
+		}
+		proc, ferr := os.FindProcess(pid)
+		if ferr != nil {
+			return ferr
+		}
+		if serr := proc.Signal(syscall.SIGTERM); serr != nil {
+			return fmt.Errorf("stop pid %d: %w", pid, serr)
+		}
+	}
+
+	deadline := time.Now().Add(stopTimeout)
+	for {
+		if _, ok := instance.Running(stateDir); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("babble (pid %d) did not exit within %s", pid, stopTimeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if pid != 0 {
+		fmt.Printf("Stopped babble (pid %d).\n", pid)
+	} else {
+		fmt.Println("Stopped babble.")
+	}
+	return nil
+}
+
+// requestShutdown sends POST /api/shutdown to the running server.
+func requestShutdown(configPath, stateDir string) error {
+	c, _, err := runningServer(configPath, stateDir)
+	if err != nil {
+		return err
+	}
+	req, err := c.newRequest(http.MethodPost, "/api/shutdown", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("stop server at %s: %w", c.where, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("stop server at %s: %s", c.where, resp.Status)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"archive/zip"
 	"bytes"
+	"flag"
 	"fmt"
 	"io"
 	"net/http"
@@ -155,8 +156,10 @@ var packRegistry = []remotePack{
 }
 
 func runPacks(args []string) error {
-	home, _ := os.UserHomeDir()
-	packsDir := filepath.Join(home, ".config", "babble", "soundpacks")
+	fs := flag.NewFlagSet("packs", flag.ExitOnError)
+	paths := addPathFlags(fs)
+	args = parseArgs(fs, args)
+	packsDir := paths.packs()
 
 	if len(args) == 0 {
 		return listPacks(packsDir)
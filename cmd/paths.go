@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"flag"
+
+	"github.com/dacort/babble/internal/config"
+)
+
+// pathFlags holds the --config and --packs-dir flags shared by every
+// subcommand.
+type pathFlags struct {
+	config   string
+	packsDir string
+}
+
+// addPathFlags registers --config and --packs-dir on fs.
+func addPathFlags(fs *flag.FlagSet) *pathFlags {
+	p := &pathFlags{}
+	fs.StringVar(&p.config, "config", "", "path to config.json (default from $BABBLE_HOME or $XDG_CONFIG_HOME)")
+	fs.StringVar(&p.packsDir, "packs-dir", "", "sound packs directory (default from $BABBLE_HOME or $XDG_DATA_HOME)")
+	return p
+}
+
+// configPath returns the config file to use: --config if given, otherwise
+// the resolved default.
+func (p *pathFlags) configPath() string {
+	if p.config != "" {
+		return p.config
+	}
+	return config.DefaultPath()
+}
+
+// packs returns the sound packs directory to use: --packs-dir if given,
+// otherwise the resolved default.
+func (p *pathFlags) packs() string {
+	if p.packsDir != "" {
+		return p.packsDir
+	}
+	return config.ResolveDirs().Packs
+}
+
+// stateDir returns the directory for runtime files such as the generated
+// auth token and self-signed certificate.
+func (p *pathFlags) stateDir() string {
+	return config.ResolveDirs().State
+}
+
+// parseArgs parses flags from args with fs, allowing them to appear before,
+// between or after positional arguments (the flag package alone stops at the
+// first positional). It returns the positional arguments in order.
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
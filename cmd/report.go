@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dacort/babble/internal/events"
+	"github.com/dacort/babble/internal/report"
+)
+
+// runReport implements "babble report": it reads the Claude Code session
+// logs directly, so it works whether or not a server is running, and prints a
+// summary of each session active within --since.
+func runReport(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	since := fs.Duration("since", 24*time.Hour, "summarise sessions active within this long (0 for all)")
+	session := fs.String("session", "", "only the session with this name or ID (or ID prefix)")
+	format := fs.String("format", "text", "output format: text, json or markdown")
+	addPathFlags(fs) // accepted like every command's, though report needs neither
+	if len(parseArgs(fs, args)) != 0 {
+		return fmt.Errorf("usage: babble report [--since 24h] [--session X] [--format text|json|markdown]")
+	}
+	switch *format {
+	case "text", "json", "markdown":
+	default:
+		return fmt.Errorf("report: unknown format %q (want text, json or markdown)", *format)
+	}
+	if *since < 0 {
+		return fmt.Errorf("report: --since must not be negative")
+	}
+
+	var from time.Time
+	if *since > 0 {
+		from = time.Now().Add(-*since)
+	}
+	var keep func(*events.BabbleEvent) bool
+	if *session != "" {
+		keep = func(ev *events.BabbleEvent) bool {
+			return ev.Session == *session || strings.HasPrefix(ev.SessionID, *session)
+		}
+	}
+
+	home, _ := os.UserHomeDir()
+	b := report.NewBuilder()
+	if err := report.ReadLogs(filepath.Join(home, ".claude", "projects"), from, keep, b); err != nil {
+		return err
+	}
+	sums := b.Summaries()
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(sums)
+	case "markdown":
+		return report.WriteMarkdown(os.Stdout, sums)
+	}
+	if len(sums) == 0 {
+		if from.IsZero() {
+			fmt.Println("No sessions found.")
+		} else {
+			fmt.Printf("No sessions since %s.\n", from.Format(time.DateTime))
+		}
+		return nil
+	}
+	return report.WriteText(os.Stdout, sums)
+}
@@ -4,18 +4,27 @@
 package cmd
 
 import (
+	"context"
 	"embed"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/fs"
 	"log"
+	"maps"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/dacort/babble/internal/config"
+	"github.com/dacort/babble/internal/instance"
 	"github.com/dacort/babble/internal/server"
 	"github.com/dacort/babble/internal/sessions"
 )
@@ -32,48 +41,207 @@ func Execute() error {
 	serveCmd := flag.NewFlagSet("serve", flag.ExitOnError)
 	port := serveCmd.Int("p", 3333, "port to listen on")
 	noOpen := serveCmd.Bool("no-open", false, "don't auto-open browser")
+	profile := serveCmd.String("profile", "", "activate the named config profile")
+	servePaths := addPathFlags(serveCmd)
 
 	if len(os.Args) < 2 {
 		fmt.Println("Usage: babble <command>")
 		fmt.Println("  serve                  Start the Babble server")
+		fmt.Println("  status                 Show whether a server is running, and where")
+		fmt.Println("  stop                   Stop the running server")
+		fmt.Println("  report                 Summarise recent sessions (--since, --session, --format)")
 		fmt.Println("  packs                  List installed sound packs")
 		fmt.Println("  packs install <name>   Install a sound pack (donkeykong, pacman, spaceinvaders, frogger, asteroids)")
+		fmt.Println("  config <command>       View or change settings (list, get, set, unset, edit, path, reset, migrate)")
 		return nil
 	}
 
 	switch os.Args[1] {
 	case "serve":
 		serveCmd.Parse(os.Args[2:])
-		return runServe(*port, *noOpen)
+		return runServe(serveOptions{
+			port:       *port,
+			noOpen:     *noOpen,
+			profile:    *profile,
+			configPath: servePaths.configPath(),
+			packsDir:   servePaths.packs(),
+			stateDir:   servePaths.stateDir(),
+		})
+	case "status":
+		return runStatus(os.Args[2:])
+	case "stop":
+		return runStop(os.Args[2:])
+	case "report":
+		return runReport(os.Args[2:])
 	case "packs":
 		return runPacks(os.Args[2:])
+	case "config":
+		return runConfig(os.Args[2:])
 	default:
 		return fmt.Errorf("unknown command: %s", os.Args[1])
 	}
 }
 
-// runServe builds and wires all components, then starts the HTTP server.
-func runServe(port int, noOpen bool) error {
+// serveOptions holds the settings for runServe, gathered from serve's flags.
+type serveOptions struct {
+	port       int
+	noOpen     bool
+	profile    string // activated before the server starts; "" keeps the current one
+	configPath string
+	packsDir   string
+	stateDir   string
+}
+
+// shutdownTimeout bounds how long serve waits for clients to receive their
+// final events and disconnect before exiting anyway.
+const shutdownTimeout = 5 * time.Second
+
+// runServe builds and wires all components, then starts the HTTP server. It
+// runs until the server fails, the process receives SIGINT or SIGTERM, or a
+// client calls POST /api/shutdown (babble stop), in which case it shuts down
+// gracefully (see shutdown). SIGHUP reloads the config file and sound packs
+// without restarting.
+//
+// Only one server runs per state directory. If another is already running,
+// runServe opens the browser to it and returns.
+func runServe(opts serveOptions) error {
+	lock, err := instance.Acquire(opts.stateDir)
+	var running *instance.RunningError
+	if errors.As(err, &running) {
+		return showRunning(opts, running)
+	}
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
 	home, _ := os.UserHomeDir()
 	watchPath := filepath.Join(home, ".claude", "projects")
-	packsDir := filepath.Join(home, ".config", "babble", "soundpacks")
-	configPath := config.DefaultPath()
+	packsDir := opts.packsDir
+	configPath := opts.configPath
 
 	ensureDefaultPack(packsDir)
 
+	if opts.profile != "" {
+		if err := activateProfile(configPath, opts.profile); err != nil {
+			return err
+		}
+	}
+
 	staticFS, _ := fs.Sub(webFS, "web")
 
-	srv := server.New(port, staticFS, packsDir, configPath)
+	srv := server.New(opts.port, staticFS, packsDir, configPath, opts.stateDir)
+	srv.SetVersion(Version)
+	srv.SetLogsDir(watchPath)
 
 	mgr := sessions.NewManager(watchPath, srv.EventCh())
-	go mgr.Start()
+	mgrDone := make(chan struct{})
+	go func() {
+		defer close(mgrDone)
+		if err := mgr.Start(); err != nil {
+			log.Printf("serve: session manager: %v", err)
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	serveDone := make(chan error, 1)
+	go func() { serveDone <- srv.Start() }()
+
+	if url := srv.BrowserURL(); url != "" {
+		log.Printf("serve: open %s", url)
+		if !opts.noOpen {
+			openBrowser(url)
+		}
+	}
+
+	for {
+		select {
+		case err := <-serveDone:
+			mgr.Stop()
+			return err
+
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				ensureDefaultPack(packsDir)
+				if err := srv.Reload(); err != nil {
+					log.Printf("serve: reload: %v", err)
+				}
+				continue
+			}
+			// Restore default handling so a second Ctrl-C exits immediately.
+			signal.Stop(signals)
+			log.Printf("serve: received %v — shutting down", sig)
+			return shutdown(srv, mgr, mgrDone, serveDone)
+
+		case <-srv.ShutdownRequested():
+			signal.Stop(signals)
+			log.Printf("serve: stop requested — shutting down")
+			return shutdown(srv, mgr, mgrDone, serveDone)
+		}
+	}
+}
 
-	if !noOpen {
-		url := fmt.Sprintf("http://localhost:%d", port)
-		openBrowser(url)
+// showRunning reports the server that is already running and opens the
+// browser to it, unless --no-open was given.
+func showRunning(opts serveOptions, running *instance.RunningError) error {
+	_, h, err := runningServer(opts.configPath, opts.stateDir)
+	if err != nil {
+		// Locked but not answering: most likely still starting up or
+		// shutting down.
+		return fmt.Errorf("%w; try again shortly or run babble stop", running)
+	}
+	if h.URL == "" {
+		fmt.Printf("babble is already running (pid %d), listening on %s only.\n", h.PID, h.Socket)
+		return nil
 	}
+	fmt.Printf("babble is already running (pid %d) at %s\n", h.PID, h.URL)
+	if !opts.noOpen {
+		openBrowser(h.URL)
+	}
+	return nil
+}
 
-	return srv.Start()
+// shutdown stops the session manager, waits for its tailers to exit so that
+// no more events are produced, then shuts the server down, giving clients up
+// to shutdownTimeout to receive the remaining events and a close frame.
+func shutdown(srv *server.Server, mgr *sessions.Manager, mgrDone <-chan struct{}, serveDone <-chan error) error {
+	mgr.Stop()
+	<-mgrDone
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		return err
+	}
+	return <-serveDone
+}
+
+// activateProfile makes name the active profile in the config file at
+// configPath, so that the browser picks it up as soon as it connects.
+func activateProfile(configPath, name string) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+	if _, ok := cfg.Profiles[name]; !ok {
+		return fmt.Errorf("unknown profile %q (defined: %s)", name, profileNames(cfg))
+	}
+	if cfg.ActiveProfile == name {
+		return nil
+	}
+	cfg.ActiveProfile = name
+	return config.Save(cfg, configPath)
+}
+
+// profileNames lists cfg's profile names for error messages.
+func profileNames(cfg *config.Config) string {
+	if len(cfg.Profiles) == 0 {
+		return "none"
+	}
+	return strings.Join(slices.Sorted(maps.Keys(cfg.Profiles)), ", ")
 }
 
 // ensureDefaultPack copies the embedded default sound pack into
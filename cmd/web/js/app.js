@@ -16,6 +16,7 @@ const RECONNECT_BASE_MS = 500;
 const RECONNECT_MAX_MS = 5000;
 const ACTIVITY_WINDOW_MS = 10_000;   // dot goes green if event in last 10s
 const RATE_WINDOW_MS = 60_000;       // events/min rolling window
+const PROTOCOL = 'babble.v1';        // WebSocket subprotocol (enveloped messages)
 
 const CATEGORY_ICONS = {
   ambient: '💭',
@@ -63,6 +64,9 @@ let autoScroll = true;
 let ws = null;
 let reconnectDelay = RECONNECT_BASE_MS;
 
+/** Last config received from the server (base settings plus profiles). */
+let serverConfig = null;
+
 // ---------------------------------------------------------------------------
 // DOM refs (populated after DOMContentLoaded)
 // ---------------------------------------------------------------------------
@@ -114,29 +118,14 @@ async function populatePacks() {
   try {
     const res = await fetch('/api/packs');
     if (!res.ok) return;
-    const packs = await res.json();
-
-    elPackSelect.innerHTML = '';
-    for (const pack of packs) {
-      const opt = document.createElement('option');
-      opt.value = pack.slug;
-      opt.textContent = pack.name;
-      elPackSelect.appendChild(opt);
-    }
-
-    // Default to first pack if available.
-    if (packs.length === 0) {
-      const opt = document.createElement('option');
-      opt.value = 'default';
-      opt.textContent = 'Default';
-      elPackSelect.appendChild(opt);
-    }
+    renderPackOptions(await res.json());
 
     // Restore persisted pack selection from config.
     try {
       const cfgRes = await fetch('/api/config');
       if (cfgRes.ok) {
-        const cfg = await cfgRes.json();
+        serverConfig = await cfgRes.json();
+        const cfg = effectiveConfig(serverConfig);
         if (cfg.activePack && elPackSelect.querySelector(`option[value="${cfg.activePack}"]`)) {
           elPackSelect.value = cfg.activePack;
         }
@@ -147,16 +136,55 @@ async function populatePacks() {
   }
 }
 
+function renderPackOptions(packs) {
+  elPackSelect.innerHTML = '';
+  for (const pack of packs) {
+    const opt = document.createElement('option');
+    opt.value = pack.slug;
+    opt.textContent = pack.name;
+    elPackSelect.appendChild(opt);
+  }
+
+  // Default to first pack if available.
+  if (packs.length === 0) {
+    const opt = document.createElement('option');
+    opt.value = 'default';
+    opt.textContent = 'Default';
+    elPackSelect.appendChild(opt);
+  }
+}
+
+/**
+ * Applies a `packs` message, sent when the server reloads its sound packs
+ * (on SIGHUP): refreshes the selector and reloads the current pack in case
+ * its sounds changed on disk.
+ */
+function applyPacks(packs) {
+  const current = elPackSelect.value;
+  renderPackOptions(packs);
+  if (elPackSelect.querySelector(`option[value="${current}"]`)) {
+    elPackSelect.value = current;
+  }
+  audio.loadPack(elPackSelect.value).catch((err) => {
+    console.warn('BabbleApp: failed to reload pack:', err);
+  });
+}
+
 function setupPackSelector() {
   elPackSelect.addEventListener('change', async () => {
     const packName = elPackSelect.value;
     try {
       await audio.loadPack(packName);
-      // Persist selection to config.
+      // Persist selection to config, inside the active profile if there is
+      // one so that the profile's own pack choice doesn't mask it.
+      const profile = serverConfig?.activeProfile;
+      const patch = profile
+        ? { profiles: { [profile]: { activePack: packName } } }
+        : { activePack: packName };
       fetch('/api/config', {
         method: 'PATCH',
-        headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ activePack: packName }),
+        headers: { 'Content-Type': 'application/merge-patch+json' },
+        body: JSON.stringify(patch),
       }).catch(() => {});
     } catch (err) {
       console.warn('BabbleApp: failed to switch pack:', err);
@@ -174,7 +202,10 @@ function connectWebSocket() {
     ws.close();
   }
 
-  ws = new WebSocket(`ws://${location.host}/ws`);
+  // Ask for the enveloped v1 protocol so we also get snapshots and
+  // control messages, not just bare events.
+  const scheme = location.protocol === 'https:' ? 'wss' : 'ws';
+  ws = new WebSocket(`${scheme}://${location.host}/ws`, [PROTOCOL]);
 
   ws.onopen = () => {
     reconnectDelay = RECONNECT_BASE_MS;
@@ -182,17 +213,24 @@ function connectWebSocket() {
   };
 
   ws.onmessage = (e) => {
-    let event;
+    let msg;
     try {
-      event = JSON.parse(e.data);
+      msg = JSON.parse(e.data);
     } catch {
       return;
     }
-    handleEvent(event);
+    if (msg.type === 'event') {
+      handleEvent(msg.data);
+    } else {
+      handleControl(msg.type, msg.data ?? {});
+    }
   };
 
-  ws.onclose = () => {
-    console.log(`BabbleApp: WebSocket closed — reconnecting in ${reconnectDelay}ms`);
+  ws.onclose = (e) => {
+    // 1001 (going away) means the server is shutting down; keep retrying so
+    // that we pick up again when it restarts.
+    const why = e.code === 1001 ? 'server shut down' : 'WebSocket closed';
+    console.log(`BabbleApp: ${why} — reconnecting in ${reconnectDelay}ms`);
     setTimeout(() => {
       reconnectDelay = Math.min(reconnectDelay * 2, RECONNECT_MAX_MS);
       connectWebSocket();
@@ -208,6 +246,100 @@ function connectWebSocket() {
 // Event handling
 // ---------------------------------------------------------------------------
 
+/** Handles a server message other than `event`. */
+function handleControl(type, data) {
+  switch (type) {
+    case 'dropped':
+      console.warn(`BabbleApp: server dropped ${data.count} event(s) (${data.total} total)`);
+      break;
+    case 'error':
+      console.warn('BabbleApp: server rejected message:', data.message);
+      break;
+    case 'snapshot':
+      applySnapshot(data);
+      break;
+    case 'config':
+      applyConfig(data);
+      break;
+    case 'packs':
+      applyPacks(data);
+      break;
+  }
+}
+
+/**
+ * Returns the settings in effect: the base config with the active profile's
+ * overrides applied, as GET /api/profiles reports in "effective": a
+ * profile's pack and muted sessions replace the base ones when set, and its
+ * volume and event overrides are merged over the base maps.
+ */
+function effectiveConfig(cfg) {
+  const profile = cfg.profiles?.[cfg.activeProfile];
+  if (!profile) return cfg;
+  return {
+    ...cfg,
+    activePack: profile.activePack || cfg.activePack,
+    categoryVolumes: { ...cfg.categoryVolumes, ...profile.categoryVolumes },
+    mutedSessions: profile.mutedSessions ?? cfg.mutedSessions,
+    eventOverrides: { ...cfg.eventOverrides, ...profile.eventOverrides },
+  };
+}
+
+/**
+ * Applies a config pushed by the server after it changed in another tab, on
+ * disk, or by switching profile, keeping the pack, volumes and muted sessions
+ * in sync.
+ */
+async function applyConfig(data) {
+  serverConfig = data;
+  const cfg = effectiveConfig(data);
+
+  if (cfg.activePack && cfg.activePack !== elPackSelect.value &&
+      elPackSelect.querySelector(`option[value="${cfg.activePack}"]`)) {
+    elPackSelect.value = cfg.activePack;
+    try {
+      await audio.loadPack(cfg.activePack);
+    } catch (err) {
+      console.warn('BabbleApp: failed to switch pack:', err);
+    }
+  }
+
+  // Categories without an override fall back to the pack default, so that
+  // leaving a profile restores them.
+  const vols = cfg.categoryVolumes ?? {};
+  for (const cat of CATEGORIES) {
+    const slider = document.querySelector(`.vol-slider[aria-label="${cat} volume"]`);
+    if (cat in vols) {
+      audio.setCategoryVolume(cat, vols[cat]);
+      if (slider) slider.value = String(vols[cat]);
+    } else if (audio.categoryOverrides.has(cat)) {
+      audio.categoryOverrides.delete(cat);
+      if (slider) slider.value = '0.5';
+    }
+  }
+
+  if (Array.isArray(cfg.mutedSessions)) {
+    audio.mutedSessions = new Set(cfg.mutedSessions);
+    renderSessionList();
+  }
+}
+
+/**
+ * Rebuilds the event stream from the server's snapshot of recent events.
+ * Sent on every (re)connect, so the stream is cleared first to avoid
+ * duplicating rows. Snapshot events are shown silently.
+ */
+function applySnapshot(snap) {
+  elEventStream.innerHTML = '';
+  for (const s of snap.sessions ?? []) {
+    getOrCreateSession(s.name);
+  }
+  for (const event of snap.events ?? []) {
+    addEventRow(event);
+  }
+  renderSessionList();
+}
+
 /** Per-category meter levels (0–1), decayed each frame. */
 const meterLevels = {};
 
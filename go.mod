@@ -3,7 +3,8 @@ module github.com/dacort/babble
 go 1.25.1
 
 require (
-	github.com/fsnotify/fsnotify v1.9.0 // indirect
-	github.com/gorilla/websocket v1.5.3 // indirect
-	golang.org/x/sys v0.13.0 // indirect
+	github.com/fsnotify/fsnotify v1.9.0
+	github.com/gorilla/websocket v1.5.3
 )
+
+require golang.org/x/sys v0.13.0 // indirect
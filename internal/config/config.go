@@ -2,9 +2,11 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 )
@@ -12,14 +14,38 @@ import (
 // Config holds all user-configurable settings for babble. Field names are
 // kept in camelCase JSON to match the browser UI conventions.
 type Config struct {
+	Version         int                `json:"version"`
 	Port            int                `json:"port"`
+	Listen          string             `json:"listen"`
+	BindAddress     string             `json:"bindAddress"`
+	SocketPath      string             `json:"socketPath"`
+	TLSCert         string             `json:"tlsCert"`
+	TLSKey          string             `json:"tlsKey"`
+	TLSSelfSigned   bool               `json:"tlsSelfSigned"`
+	AuthToken       string             `json:"authToken"`
+	AllowedHosts    []string           `json:"allowedHosts"`
 	AutoOpen        bool               `json:"autoOpen"`
 	ActivePack      string             `json:"activePack"`
 	WatchPath       string             `json:"watchPath"`
 	IdleTimeout     string             `json:"idleTimeout"`
 	CategoryVolumes map[string]float64 `json:"categoryVolumes"`
 	MutedSessions   []string           `json:"mutedSessions"`
+	SessionAliases  map[string]string  `json:"sessionAliases"`
 	EventOverrides  map[string]string  `json:"eventOverrides"`
+	EventBuffer     int                `json:"eventBuffer"`
+	DropPolicy      string             `json:"dropPolicy"`
+	PingInterval    string             `json:"pingInterval"`
+	PongTimeout     string             `json:"pongTimeout"`
+	WriteTimeout    string             `json:"writeTimeout"`
+	SnapshotEvents  int                `json:"snapshotEvents"`
+	HistoryEvents   int                `json:"historyEvents"`
+	EventLog        bool               `json:"eventLog"`
+	EventLogMaxAge  string             `json:"eventLogMaxAge"`
+	EventLogMaxMB   int                `json:"eventLogMaxMB"`
+	RedactPatterns  []string           `json:"redactPatterns"`
+	DetailLevels    map[string]string  `json:"detailLevels"`
+	Profiles        map[string]Profile `json:"profiles"`
+	ActiveProfile   string             `json:"activeProfile"`
 }
 
 // Default returns a *Config populated with the documented sentinel values.
@@ -27,33 +53,51 @@ type Config struct {
 // that callers can safely range/index them without a nil check.
 func Default() *Config {
 	return &Config{
+		Version:         CurrentVersion,
 		Port:            3333,
+		Listen:          "both",
+		BindAddress:     "127.0.0.1",
+		AllowedHosts:    []string{},
 		AutoOpen:        true,
 		ActivePack:      "default",
 		WatchPath:       "~/.claude/projects",
 		IdleTimeout:     "5m",
 		CategoryVolumes: map[string]float64{},
 		MutedSessions:   []string{},
+		SessionAliases:  map[string]string{},
 		EventOverrides:  map[string]string{},
+		EventBuffer:     100,
+		DropPolicy:      "drop-oldest",
+		PingInterval:    "30s",
+		PongTimeout:     "60s",
+		WriteTimeout:    "10s",
+		SnapshotEvents:  50,
+		HistoryEvents:   500,
+		EventLog:        true,
+		EventLogMaxAge:  "168h",
+		EventLogMaxMB:   100,
+		RedactPatterns:  []string{},
+		DetailLevels:    map[string]string{},
+		Profiles:        map[string]Profile{},
 	}
 }
 
 // DefaultPath returns the canonical location for the config file:
-// ~/.config/babble/config.json. The leading ~ is not expanded; callers that
-// need the real path should use os.UserHomeDir themselves.
+// config.json in the config directory chosen by ResolveDirs, usually
+// ~/.config/babble/config.json. If the home directory is unknown the leading
+// ~ is not expanded; callers that need the real path should expand it
+// themselves.
 func DefaultPath() string {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		// Fall back to the tilde form; the caller can expand it later.
-		return "~/.config/babble/config.json"
-	}
-	return filepath.Join(home, ".config", "babble", "config.json")
+	return filepath.Join(ResolveDirs().Config, "config.json")
 }
 
 // Load reads the JSON file at path and unmarshals it over a set of defaults,
 // so any field absent from the file retains its default value. If path does
 // not exist, Load returns the defaults with a nil error — a missing config
 // file is not an error condition.
+//
+// A file written by an older babble is upgraded to CurrentVersion in place
+// (see MigrateFile) before it is used.
 func Load(path string) (*Config, error) {
 	cfg := Default()
 
@@ -69,27 +113,80 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("config: parse %s: %w", path, err)
 	}
 
-	// Ensure collections are never nil after unmarshalling a JSON file that
-	// omits them (e.g. `"categoryVolumes": null`).
+	migrated, applied, backup, err := upgradeFile(path, data)
+	switch {
+	case migrated == nil:
+		return nil, err
+	case err != nil:
+		// The file could not be rewritten (read-only, perhaps); carry on
+		// with the migrated settings in memory.
+		log.Printf("%v — using migrated settings without saving", err)
+	case len(applied) > 0:
+		log.Printf("config: upgraded %s to version %d (backup at %s)", path, CurrentVersion, backup)
+	}
+	if len(applied) > 0 {
+		cfg = Default()
+		if err := json.Unmarshal(migrated, cfg); err != nil {
+			return nil, fmt.Errorf("config: parse migrated %s: %w", path, err)
+		}
+	}
+	cfg.initCollections()
+
+	return cfg, nil
+}
+
+// Parse decodes data as a config document over a set of defaults, like Load,
+// but rejects unknown fields. It is meant for documents built by clients
+// (such as the result of applying a patch) where an unknown field is a typo
+// rather than a setting from another babble version.
+func Parse(data []byte) (*Config, error) {
+	cfg := Default()
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("config: parse: %w", err)
+	}
+	cfg.initCollections()
+	return cfg, nil
+}
+
+// initCollections ensures collections are never nil after unmarshalling a
+// JSON document that omits them (e.g. `"categoryVolumes": null`).
+func (cfg *Config) initCollections() {
 	if cfg.CategoryVolumes == nil {
 		cfg.CategoryVolumes = map[string]float64{}
 	}
+	if cfg.AllowedHosts == nil {
+		cfg.AllowedHosts = []string{}
+	}
 	if cfg.MutedSessions == nil {
 		cfg.MutedSessions = []string{}
 	}
+	if cfg.SessionAliases == nil {
+		cfg.SessionAliases = map[string]string{}
+	}
 	if cfg.EventOverrides == nil {
 		cfg.EventOverrides = map[string]string{}
 	}
-
-	return cfg, nil
+	if cfg.RedactPatterns == nil {
+		cfg.RedactPatterns = []string{}
+	}
+	if cfg.DetailLevels == nil {
+		cfg.DetailLevels = map[string]string{}
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = map[string]Profile{}
+	}
 }
 
 // Save serialises cfg as indented JSON and writes it to path, creating any
-// missing parent directories with mode 0755. The file is written atomically
-// from the Go perspective (os.WriteFile truncates then writes).
+// missing parent directories with mode 0755. The data is written to a
+// temporary file in the same directory and renamed over path, so readers
+// (including the file watcher) never observe a partially written config.
 func Save(cfg *Config, path string) error {
-	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
-		return fmt.Errorf("config: mkdir %s: %w", filepath.Dir(path), err)
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("config: mkdir %s: %w", dir, err)
 	}
 
 	data, err := json.MarshalIndent(cfg, "", "  ")
@@ -97,9 +194,46 @@ func Save(cfg *Config, path string) error {
 		return fmt.Errorf("config: marshal: %w", err)
 	}
 
-	if err := os.WriteFile(path, data, 0o644); err != nil {
-		return fmt.Errorf("config: write %s: %w", path, err)
+	return writeFileAtomic(path, data)
+}
+
+// fileMode is the permission config files and their backups are written
+// with. They may hold authToken, so only their owner may read them.
+const fileMode = 0o600
+
+// WriteBackup writes data, the contents of a config file, to path, which
+// only the current user may read.
+func WriteBackup(path string, data []byte) error {
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic writes data to a temporary file in path's directory and
+// renames it over path, which only the current user may then read.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("config: create temp file: %w", err)
 	}
+	// Clean up the temp file on any failure; after a successful rename the
+	// remove is a harmless no-op.
+	defer os.Remove(tmp.Name())
 
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("config: write %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("config: sync %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("config: close %s: %w", tmp.Name(), err)
+	}
+	if err := os.Chmod(tmp.Name(), fileMode); err != nil {
+		return fmt.Errorf("config: chmod %s: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("config: write %s: %w", path, err)
+	}
 	return nil
 }
@@ -18,11 +18,25 @@ func TestLoadDefaultConfig(t *testing.T) {
 		got  any
 		want any
 	}{
+		{"Version", cfg.Version, config.CurrentVersion},
 		{"Port", cfg.Port, 3333},
+		{"Listen", cfg.Listen, "both"},
+		{"BindAddress", cfg.BindAddress, "127.0.0.1"},
+		{"TLSSelfSigned", cfg.TLSSelfSigned, false},
 		{"AutoOpen", cfg.AutoOpen, true},
 		{"ActivePack", cfg.ActivePack, "default"},
 		{"WatchPath", cfg.WatchPath, "~/.claude/projects"},
 		{"IdleTimeout", cfg.IdleTimeout, "5m"},
+		{"EventBuffer", cfg.EventBuffer, 100},
+		{"DropPolicy", cfg.DropPolicy, "drop-oldest"},
+		{"PingInterval", cfg.PingInterval, "30s"},
+		{"PongTimeout", cfg.PongTimeout, "60s"},
+		{"WriteTimeout", cfg.WriteTimeout, "10s"},
+		{"SnapshotEvents", cfg.SnapshotEvents, 50},
+		{"HistoryEvents", cfg.HistoryEvents, 500},
+		{"EventLog", cfg.EventLog, true},
+		{"EventLogMaxAge", cfg.EventLogMaxAge, "168h"},
+		{"EventLogMaxMB", cfg.EventLogMaxMB, 100},
 	}
 
 	for _, tt := range tests {
@@ -45,11 +59,23 @@ func TestLoadDefaultConfig(t *testing.T) {
 		}
 	})
 
+	t.Run("SessionAliases not nil", func(t *testing.T) {
+		if cfg.SessionAliases == nil {
+			t.Error("SessionAliases should be an empty map, got nil")
+		}
+	})
+
 	t.Run("EventOverrides not nil", func(t *testing.T) {
 		if cfg.EventOverrides == nil {
 			t.Error("EventOverrides should be an empty map, got nil")
 		}
 	})
+
+	t.Run("Profiles not nil", func(t *testing.T) {
+		if cfg.Profiles == nil {
+			t.Error("Profiles should be an empty map, got nil")
+		}
+	})
 }
 
 // TestSaveAndLoad round-trips a Config through Save then Load and verifies
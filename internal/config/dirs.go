@@ -0,0 +1,64 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Dirs holds the directories babble keeps its files in.
+type Dirs struct {
+	// Config holds config.json.
+	Config string
+	// Packs holds installed sound packs, one subdirectory per pack.
+	Packs string
+	// State holds runtime files such as sockets, PID files and event logs.
+	State string
+}
+
+// ResolveDirs works out where babble's files live, in order of precedence:
+//
+//  1. $BABBLE_HOME, if set, holds everything: config.json directly inside
+//     it, packs in soundpacks/ and runtime state in state/. This makes it
+//     easy to run isolated instances side by side.
+//  2. Otherwise the XDG base directories are used: config in
+//     $XDG_CONFIG_HOME/babble (default ~/.config/babble), packs in
+//     $XDG_DATA_HOME/babble/soundpacks, and state in $XDG_STATE_HOME/babble
+//     (default ~/.local/state/babble).
+//
+// When $XDG_DATA_HOME is unset, packs stay in the config directory's
+// soundpacks/ subdirectory, where babble has always installed them, so
+// existing installs keep working.
+//
+// If the home directory cannot be determined, paths fall back to the
+// unexpanded "~" form.
+func ResolveDirs() Dirs {
+	if home := os.Getenv("BABBLE_HOME"); home != "" {
+		return Dirs{
+			Config: home,
+			Packs:  filepath.Join(home, "soundpacks"),
+			State:  filepath.Join(home, "state"),
+		}
+	}
+
+	userHome, err := os.UserHomeDir()
+	if err != nil {
+		userHome = "~"
+	}
+	xdg := func(env string, fallback ...string) string {
+		if dir := os.Getenv(env); filepath.IsAbs(dir) {
+			return dir
+		}
+		return filepath.Join(append([]string{userHome}, fallback...)...)
+	}
+
+	d := Dirs{
+		Config: filepath.Join(xdg("XDG_CONFIG_HOME", ".config"), "babble"),
+		State:  filepath.Join(xdg("XDG_STATE_HOME", ".local", "state"), "babble"),
+	}
+	if dataHome := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dataHome) {
+		d.Packs = filepath.Join(dataHome, "babble", "soundpacks")
+	} else {
+		d.Packs = filepath.Join(d.Config, "soundpacks")
+	}
+	return d
+}
@@ -0,0 +1,77 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dacort/babble/internal/config"
+)
+
+// TestResolveDirs checks the precedence of BABBLE_HOME and the XDG variables.
+func TestResolveDirs(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skipf("no home directory: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want config.Dirs
+	}{
+		{
+			name: "defaults",
+			want: config.Dirs{
+				Config: filepath.Join(home, ".config", "babble"),
+				Packs:  filepath.Join(home, ".config", "babble", "soundpacks"),
+				State:  filepath.Join(home, ".local", "state", "babble"),
+			},
+		},
+		{
+			name: "XDG",
+			env: map[string]string{
+				"XDG_CONFIG_HOME": "/xdg/config",
+				"XDG_DATA_HOME":   "/xdg/data",
+				"XDG_STATE_HOME":  "/xdg/state",
+			},
+			want: config.Dirs{
+				Config: "/xdg/config/babble",
+				Packs:  "/xdg/data/babble/soundpacks",
+				State:  "/xdg/state/babble",
+			},
+		},
+		{
+			name: "relative XDG paths are ignored",
+			env:  map[string]string{"XDG_CONFIG_HOME": "rel/config", "XDG_DATA_HOME": "rel/data"},
+			want: config.Dirs{
+				Config: filepath.Join(home, ".config", "babble"),
+				Packs:  filepath.Join(home, ".config", "babble", "soundpacks"),
+				State:  filepath.Join(home, ".local", "state", "babble"),
+			},
+		},
+		{
+			name: "BABBLE_HOME wins",
+			env:  map[string]string{"BABBLE_HOME": "/work/babble", "XDG_CONFIG_HOME": "/xdg/config"},
+			want: config.Dirs{
+				Config: "/work/babble",
+				Packs:  "/work/babble/soundpacks",
+				State:  "/work/babble/state",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"BABBLE_HOME", "XDG_CONFIG_HOME", "XDG_DATA_HOME", "XDG_STATE_HOME"} {
+				t.Setenv(key, tt.env[key])
+			}
+			if got := config.ResolveDirs(); got != tt.want {
+				t.Errorf("ResolveDirs() = %+v, want %+v", got, tt.want)
+			}
+			if got, want := config.DefaultPath(), filepath.Join(tt.want.Config, "config.json"); got != want {
+				t.Errorf("DefaultPath() = %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// CurrentVersion is the config schema version written by this build. Files
+// with an older version are upgraded by the migrations below when loaded.
+const CurrentVersion = 1
+
+// Migration upgrades a config document from schema version From to From+1.
+// Apply receives the document decoded generically (numbers as json.Number)
+// and edits it in place; it does not need to touch the version field.
+type Migration struct {
+	From        int
+	Description string
+	Apply       func(doc map[string]any) error
+}
+
+// migrations is the ordered upgrade path, one entry per schema version. To
+// change the schema, bump CurrentVersion and append a Migration whose From is
+// the previous version.
+var migrations = []Migration{
+	{
+		From:        0,
+		Description: "add schema version field",
+		Apply:       func(map[string]any) error { return nil },
+	},
+}
+
+// Migrate upgrades a config document to CurrentVersion and returns the
+// result, indented as Save would write it, together with the migrations that
+// were applied. A document with no version field is version 0. If the
+// document is already current it is returned unchanged with no migrations.
+// A document from a newer babble is an error, since downgrading could
+// silently drop settings. Errors are not prefixed with the package name, as
+// callers add the file path.
+func Migrate(data []byte) ([]byte, []Migration, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("parse: %w", err)
+	}
+	if doc == nil {
+		doc = map[string]any{}
+	}
+
+	version, err := docVersion(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	if version > CurrentVersion {
+		return nil, nil, fmt.Errorf("version %d is newer than this babble supports (%d)", version, CurrentVersion)
+	}
+	if version == CurrentVersion {
+		return data, nil, nil
+	}
+
+	var applied []Migration
+	for _, m := range migrations {
+		if m.From < version {
+			continue
+		}
+		if m.From != version {
+			return nil, nil, fmt.Errorf("no migration from version %d", version)
+		}
+		if err := m.Apply(doc); err != nil {
+			return nil, nil, fmt.Errorf("from version %d (%s): %w", m.From, m.Description, err)
+		}
+		version++
+		doc["version"] = version
+		applied = append(applied, m)
+	}
+	if version != CurrentVersion {
+		return nil, nil, fmt.Errorf("no migration from version %d", version)
+	}
+
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal: %w", err)
+	}
+	return out, applied, nil
+}
+
+// docVersion reads the version field of a generically decoded document.
+func docVersion(doc map[string]any) (int, error) {
+	raw, ok := doc["version"]
+	if !ok || raw == nil {
+		return 0, nil
+	}
+	n, ok := raw.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("version must be a number, got %v", raw)
+	}
+	v, err := n.Int64()
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid version %s", n)
+	}
+	return int(v), nil
+}
+
+// BackupPath returns where MigrateFile saves the pre-migration copy of a
+// config file at version: path with ".v<version>.bak" appended.
+func BackupPath(path string, version int) string {
+	return fmt.Sprintf("%s.v%d.bak", path, version)
+}
+
+// MigrateFile upgrades the config file at path to CurrentVersion in place.
+// The original is first copied to BackupPath so the upgrade can be undone
+// by hand. It returns the migrations applied (none if the file is missing or
+// already current) and the backup's path.
+func MigrateFile(path string) (applied []Migration, backup string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, "", nil
+		}
+		return nil, "", fmt.Errorf("config: read %s: %w", path, err)
+	}
+
+	_, applied, backup, err = upgradeFile(path, data)
+	return applied, backup, err
+}
+
+// upgradeFile migrates data, the current contents of the file at path, and
+// if anything changed writes a backup followed by the migrated document. It
+// returns the migrated document even when writing fails, so that Load can
+// still use it.
+func upgradeFile(path string, data []byte) (migrated []byte, applied []Migration, backup string, err error) {
+	migrated, applied, err = Migrate(data)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("config: migrate %s: %w", path, err)
+	}
+	if len(applied) == 0 {
+		return migrated, nil, "", nil
+	}
+
+	backup = BackupPath(path, applied[0].From)
+	if err := WriteBackup(backup, data); err != nil {
+		return migrated, applied, "", err
+	}
+	if err := writeFileAtomic(path, migrated); err != nil {
+		return migrated, applied, backup, err
+	}
+	return migrated, applied, backup, nil
+}
@@ -0,0 +1,107 @@
+package config_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/dacort/babble/internal/config"
+)
+
+// TestMigrate verifies version detection and upgrading of raw documents.
+func TestMigrate(t *testing.T) {
+	t.Run("unversioned document is upgraded", func(t *testing.T) {
+		out, applied, err := config.Migrate([]byte(`{"port":4000,"legacyField":true}`))
+		if err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+		if len(applied) != config.CurrentVersion {
+			t.Errorf("applied %d migrations, want %d", len(applied), config.CurrentVersion)
+		}
+		var doc map[string]any
+		if err := json.Unmarshal(out, &doc); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if doc["version"] != float64(config.CurrentVersion) {
+			t.Errorf("version = %v, want %d", doc["version"], config.CurrentVersion)
+		}
+		// Unknown fields are preserved, not dropped.
+		if doc["port"] != float64(4000) || doc["legacyField"] != true {
+			t.Errorf("settings not preserved: %s", out)
+		}
+	})
+
+	t.Run("current document is unchanged", func(t *testing.T) {
+		in := []byte(`{"version":1,"port":4000}`)
+		out, applied, err := config.Migrate(in)
+		if err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+		if len(applied) != 0 || string(out) != string(in) {
+			t.Errorf("got %s with %d migrations, want input unchanged", out, len(applied))
+		}
+	})
+
+	for name, in := range map[string]string{
+		"newer version":     `{"version":99}`,
+		"non-numeric":       `{"version":"1"}`,
+		"negative version":  `{"version":-1}`,
+		"malformed JSON":    `{`,
+		"non-object config": `[1,2]`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := config.Migrate([]byte(in)); err == nil {
+				t.Errorf("Migrate(%s): expected error", in)
+			}
+		})
+	}
+}
+
+// TestLoadUpgradesFile verifies that loading an old config file upgrades it
+// in place and keeps a backup of the original.
+func TestLoadUpgradesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	original := []byte(`{"port":4000,"activePack":"retro"}`)
+	if err := os.WriteFile(path, original, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Version != config.CurrentVersion || cfg.Port != 4000 || cfg.ActivePack != "retro" {
+		t.Errorf("loaded version %d, port %d, pack %q", cfg.Version, cfg.Port, cfg.ActivePack)
+	}
+
+	backup, err := os.ReadFile(config.BackupPath(path, 0))
+	if err != nil {
+		t.Fatalf("read backup: %v", err)
+	}
+	if string(backup) != string(original) {
+		t.Errorf("backup = %s, want original %s", backup, original)
+	}
+	if runtime.GOOS != "windows" {
+		// Both may hold authToken.
+		for _, p := range []string{path, config.BackupPath(path, 0)} {
+			fi, err := os.Stat(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if perm := fi.Mode().Perm(); perm != 0o600 {
+				t.Errorf("mode of %s = %v, want 0600", p, perm)
+			}
+		}
+	}
+
+	// The file on disk is now current, so another migration is a no-op.
+	applied, _, err := config.MigrateFile(path)
+	if err != nil {
+		t.Fatalf("MigrateFile: %v", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("MigrateFile applied %d migrations to an upgraded file", len(applied))
+	}
+}
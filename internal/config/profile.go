@@ -0,0 +1,43 @@
+package config
+
+import (
+	"maps"
+	"slices"
+)
+
+// Profile is a named set of overrides applied on top of the base config
+// while it is active, e.g. a quiet "focus" profile or a loud "demo" one.
+// Empty fields inherit from the base config: ActivePack when "", and
+// MutedSessions when null. Entries in CategoryVolumes and EventOverrides are
+// merged over the base maps key by key.
+type Profile struct {
+	ActivePack      string             `json:"activePack,omitempty"`
+	CategoryVolumes map[string]float64 `json:"categoryVolumes,omitempty"`
+	MutedSessions   []string           `json:"mutedSessions"`
+	EventOverrides  map[string]string  `json:"eventOverrides,omitempty"`
+}
+
+// Effective returns a copy of cfg with its active profile, if any, applied to
+// the top-level settings. Profiles and ActiveProfile are carried over so the
+// result still describes which profile is in use.
+func (cfg *Config) Effective() *Config {
+	out := *cfg
+	out.CategoryVolumes = maps.Clone(cfg.CategoryVolumes)
+	out.MutedSessions = slices.Clone(cfg.MutedSessions)
+	out.EventOverrides = maps.Clone(cfg.EventOverrides)
+	out.initCollections()
+
+	p, ok := cfg.Profiles[cfg.ActiveProfile]
+	if !ok {
+		return &out
+	}
+	if p.ActivePack != "" {
+		out.ActivePack = p.ActivePack
+	}
+	maps.Copy(out.CategoryVolumes, p.CategoryVolumes)
+	if p.MutedSessions != nil {
+		out.MutedSessions = slices.Clone(p.MutedSessions)
+	}
+	maps.Copy(out.EventOverrides, p.EventOverrides)
+	return &out
+}
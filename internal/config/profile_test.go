@@ -0,0 +1,69 @@
+package config_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dacort/babble/internal/config"
+)
+
+// TestEffective verifies how a profile's overrides combine with the base
+// config.
+func TestEffective(t *testing.T) {
+	base := config.Default()
+	base.ActivePack = "default"
+	base.CategoryVolumes = map[string]float64{"read": 0.4, "write": 0.6}
+	base.MutedSessions = []string{"scratch"}
+	base.EventOverrides = map[string]string{"Grep": "read"}
+	base.Profiles = map[string]config.Profile{
+		"focus": {
+			CategoryVolumes: map[string]float64{"read": 0, "ambient": 0},
+			EventOverrides:  map[string]string{"Bash": "action"},
+		},
+		"demo": {
+			ActivePack:    "retro",
+			MutedSessions: []string{},
+		},
+	}
+
+	t.Run("no active profile", func(t *testing.T) {
+		eff := base.Effective()
+		if !reflect.DeepEqual(eff.CategoryVolumes, base.CategoryVolumes) || eff.ActivePack != "default" {
+			t.Errorf("effective config differs from base: %+v", eff)
+		}
+	})
+
+	t.Run("maps merge", func(t *testing.T) {
+		cfg := *base
+		cfg.ActiveProfile = "focus"
+		eff := cfg.Effective()
+
+		wantVols := map[string]float64{"read": 0, "write": 0.6, "ambient": 0}
+		if !reflect.DeepEqual(eff.CategoryVolumes, wantVols) {
+			t.Errorf("CategoryVolumes = %v, want %v", eff.CategoryVolumes, wantVols)
+		}
+		wantOverrides := map[string]string{"Grep": "read", "Bash": "action"}
+		if !reflect.DeepEqual(eff.EventOverrides, wantOverrides) {
+			t.Errorf("EventOverrides = %v, want %v", eff.EventOverrides, wantOverrides)
+		}
+		if !reflect.DeepEqual(eff.MutedSessions, []string{"scratch"}) || eff.ActivePack != "default" {
+			t.Errorf("unset fields not inherited: pack %q, muted %v", eff.ActivePack, eff.MutedSessions)
+		}
+		// The base config must not be modified.
+		if base.CategoryVolumes["read"] != 0.4 || len(base.EventOverrides) != 1 {
+			t.Error("Effective modified the base config")
+		}
+	})
+
+	t.Run("set fields replace", func(t *testing.T) {
+		cfg := *base
+		cfg.ActiveProfile = "demo"
+		eff := cfg.Effective()
+		if eff.ActivePack != "retro" {
+			t.Errorf("ActivePack = %q, want retro", eff.ActivePack)
+		}
+		if len(eff.MutedSessions) != 0 {
+			t.Errorf("MutedSessions = %v, want none", eff.MutedSessions)
+		}
+	})
+}
@@ -0,0 +1,230 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"maps"
+	"net"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dacort/babble/internal/packs"
+	"github.com/dacort/babble/internal/queue"
+	"github.com/dacort/babble/internal/redact"
+)
+
+// FieldError describes a single invalid setting. Field is the JSON name of
+// the setting, with map keys appended after a dot (e.g.
+// "categoryVolumes.write").
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid setting found by Validate.
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+// Error implements error.
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return "config: invalid " + strings.Join(msgs, "; ")
+}
+
+// Validate checks cfg for values that parse but make no sense: a schema
+// version other than CurrentVersion, an out-of-range port or volume, a bad
+// bind address, TLS files that do not load, a too-short auth token, an
+// unparseable duration or redaction pattern, an unknown drop policy, a
+// negative buffer, history or event log size, an unknown detail level, a
+// session alias for a relative directory or with an empty name, or an
+// activePack that is not installed in packsDir.
+// Profiles are checked the same way, and activeProfile must name one of them.
+// The pack check is skipped when packsDir is empty. It returns a
+// *ValidationError listing every problem, or nil.
+func (cfg *Config) Validate(packsDir string) error {
+	var errs []FieldError
+	add := func(field, format string, args ...any) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if cfg.Version != CurrentVersion {
+		add("version", "must be %d, got %d", CurrentVersion, cfg.Version)
+	}
+	if cfg.Port < 1 || cfg.Port > 65535 {
+		add("port", "must be between 1 and 65535, got %d", cfg.Port)
+	}
+	validateListener(cfg, add)
+
+	validateVolumes("categoryVolumes", cfg.CategoryVolumes, add)
+
+	for _, d := range []struct{ field, value string }{
+		{"idleTimeout", cfg.IdleTimeout},
+		{"pingInterval", cfg.PingInterval},
+		{"pongTimeout", cfg.PongTimeout},
+		{"writeTimeout", cfg.WriteTimeout},
+		{"eventLogMaxAge", cfg.EventLogMaxAge},
+	} {
+		if d.value == "" {
+			continue
+		}
+		if v, err := time.ParseDuration(d.value); err != nil {
+			add(d.field, "invalid duration %q", d.value)
+		} else if v < 0 {
+			add(d.field, "must not be negative, got %s", d.value)
+		}
+	}
+
+	if _, err := queue.ParsePolicy(cfg.DropPolicy); err != nil {
+		add("dropPolicy", "must be %s, %s, %s or %s, got %q",
+			queue.PolicyBlock, queue.PolicyDropOldest, queue.PolicyDropNewest, queue.PolicyCoalesce, cfg.DropPolicy)
+	}
+	for _, n := range []struct {
+		field string
+		value int
+	}{
+		{"eventBuffer", cfg.EventBuffer},
+		{"snapshotEvents", cfg.SnapshotEvents},
+		{"historyEvents", cfg.HistoryEvents},
+		{"eventLogMaxMB", cfg.EventLogMaxMB},
+	} {
+		if n.value < 0 {
+			add(n.field, "must not be negative, got %d", n.value)
+		}
+	}
+
+	for _, dir := range slices.Sorted(maps.Keys(cfg.SessionAliases)) {
+		switch {
+		case !filepath.IsAbs(dir) && dir != "~" && !strings.HasPrefix(dir, "~/"):
+			add("sessionAliases."+dir, "must be an absolute directory or start with ~/")
+		case strings.TrimSpace(cfg.SessionAliases[dir]) == "":
+			add("sessionAliases."+dir, "must not be empty")
+		}
+	}
+
+	for i, p := range cfg.RedactPatterns {
+		if _, err := regexp.Compile(p); err != nil {
+			add(fmt.Sprintf("redactPatterns.%d", i), "invalid regular expression: %v", err)
+		}
+	}
+	for _, cat := range slices.Sorted(maps.Keys(cfg.DetailLevels)) {
+		if _, err := redact.ParseLevel(cfg.DetailLevels[cat]); err != nil {
+			add("detailLevels."+cat, "%v", err)
+		}
+	}
+
+	if cfg.ActivePack == "" {
+		add("activePack", "must not be empty")
+	} else {
+		validatePack("activePack", cfg.ActivePack, packsDir, add)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(cfg.Profiles)) {
+		p := cfg.Profiles[name]
+		field := "profiles." + name
+		if name == "" {
+			add("profiles", "profile name must not be empty")
+		}
+		if p.ActivePack != "" {
+			validatePack(field+".activePack", p.ActivePack, packsDir, add)
+		}
+		validateVolumes(field+".categoryVolumes", p.CategoryVolumes, add)
+	}
+	if _, ok := cfg.Profiles[cfg.ActiveProfile]; cfg.ActiveProfile != "" && !ok {
+		add("activeProfile", "no profile named %q", cfg.ActiveProfile)
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// minTokenLength is the shortest authToken accepted, so that a token cannot
+// be guessed by trying every short string.
+const minTokenLength = 16
+
+// maxSocketPath is the longest Unix socket path every supported platform
+// accepts (sun_path is 104 bytes on macOS, including the terminating NUL).
+const maxSocketPath = 103
+
+// validateListener checks the settings that control where and how the server
+// listens: TCP and/or Unix socket, the bind address, TLS files, auth token
+// and extra allowed hosts.
+func validateListener(cfg *Config, add func(field, format string, args ...any)) {
+	switch cfg.Listen {
+	case "tcp", "unix", "both":
+	default:
+		add("listen", "must be tcp, unix or both, got %q", cfg.Listen)
+	}
+	if cfg.SocketPath != "" {
+		if !filepath.IsAbs(cfg.SocketPath) {
+			add("socketPath", "must be an absolute path, got %q", cfg.SocketPath)
+		} else if len(cfg.SocketPath) > maxSocketPath {
+			add("socketPath", "must be at most %d bytes long", maxSocketPath)
+		}
+	}
+	if !validHost(cfg.BindAddress) {
+		add("bindAddress", "must be an IP address or host name (0.0.0.0 for all interfaces), got %q", cfg.BindAddress)
+	}
+
+	switch {
+	case (cfg.TLSCert == "") != (cfg.TLSKey == ""):
+		add("tlsCert", "tlsCert and tlsKey must be set together")
+	case cfg.TLSCert != "" && cfg.TLSSelfSigned:
+		add("tlsSelfSigned", "cannot be combined with tlsCert and tlsKey")
+	case cfg.TLSCert != "":
+		if _, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey); err != nil {
+			add("tlsCert", "cannot load certificate: %v", err)
+		}
+	}
+
+	if cfg.AuthToken != "" && len(cfg.AuthToken) < minTokenLength {
+		add("authToken", "must be at least %d characters", minTokenLength)
+	}
+
+	for i, h := range cfg.AllowedHosts {
+		if !validHost(h) {
+			add(fmt.Sprintf("allowedHosts.%d", i), "must be an IP address or host name, got %q", h)
+		}
+	}
+}
+
+// validHost reports whether h is an IP address or a plausible host name.
+func validHost(h string) bool {
+	if net.ParseIP(h) != nil {
+		return true
+	}
+	return h != "" && !strings.ContainsAny(h, ":/\\ \t@?#")
+}
+
+// validateVolumes checks that every volume in vols, reported under field, is
+// between 0 and 1.
+func validateVolumes(field string, vols map[string]float64, add func(field, format string, args ...any)) {
+	for _, cat := range slices.Sorted(maps.Keys(vols)) {
+		if v := vols[cat]; v < 0 || v > 1 {
+			add(field+"."+cat, "must be between 0 and 1, got %g", v)
+		}
+	}
+}
+
+// validatePack checks that pack, reported under field, names a pack installed
+// in packsDir. Only the name is checked when packsDir is empty.
+func validatePack(field, pack, packsDir string, add func(field, format string, args ...any)) {
+	if strings.ContainsAny(pack, `/\`) {
+		add(field, "invalid pack name %q", pack)
+		return
+	}
+	if packsDir == "" {
+		return
+	}
+	if _, err := packs.LoadPack(filepath.Join(packsDir, pack)); err != nil {
+		add(field, "pack %q is not installed", pack)
+	}
+}
@@ -0,0 +1,137 @@
+package config_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dacort/babble/internal/config"
+)
+
+// TestValidate checks each rule enforced by Config.Validate.
+func TestValidate(t *testing.T) {
+	packsDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(packsDir, "default"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	manifest := []byte(`{"name":"default","categories":{}}`)
+	if err := os.WriteFile(filepath.Join(packsDir, "default", "pack.json"), manifest, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*config.Config)
+		field  string // expected invalid field; "" means valid
+	}{
+		{"defaults", func(*config.Config) {}, ""},
+		{"old version", func(c *config.Config) { c.Version = 0 }, "version"},
+		{"port zero", func(c *config.Config) { c.Port = 0 }, "port"},
+		{"port too high", func(c *config.Config) { c.Port = 65536 }, "port"},
+		{"listen unix", func(c *config.Config) { c.Listen = "unix" }, ""},
+		{"listen unknown", func(c *config.Config) { c.Listen = "udp" }, "listen"},
+		{"socketPath relative", func(c *config.Config) { c.SocketPath = "babble.sock" }, "socketPath"},
+		{"socketPath too long", func(c *config.Config) { c.SocketPath = "/" + strings.Repeat("s", 200) }, "socketPath"},
+		{"bind all interfaces", func(c *config.Config) { c.BindAddress = "0.0.0.0" }, ""},
+		{"bind IPv6", func(c *config.Config) { c.BindAddress = "::1" }, ""},
+		{"bind with port", func(c *config.Config) { c.BindAddress = "127.0.0.1:3333" }, "bindAddress"},
+		{"bind empty", func(c *config.Config) { c.BindAddress = "" }, "bindAddress"},
+		{"tlsCert without key", func(c *config.Config) { c.TLSCert = "cert.pem" }, "tlsCert"},
+		{"tlsCert unreadable", func(c *config.Config) { c.TLSCert, c.TLSKey = "missing.pem", "missing-key.pem" }, "tlsCert"},
+		{"tlsSelfSigned with cert", func(c *config.Config) {
+			c.TLSCert, c.TLSKey, c.TLSSelfSigned = "cert.pem", "key.pem", true
+		}, "tlsSelfSigned"},
+		{"authToken short", func(c *config.Config) { c.AuthToken = "hunter2" }, "authToken"},
+		{"authToken long enough", func(c *config.Config) { c.AuthToken = "correct-horse-battery" }, ""},
+		{"allowedHosts invalid", func(c *config.Config) { c.AllowedHosts = []string{"babble.local", "http://x"} }, "allowedHosts.1"},
+		{"eventLogMaxAge invalid", func(c *config.Config) { c.EventLogMaxAge = "7d" }, "eventLogMaxAge"},
+		{"eventLogMaxMB negative", func(c *config.Config) { c.EventLogMaxMB = -1 }, "eventLogMaxMB"},
+		{"dropPolicy coalesce", func(c *config.Config) { c.DropPolicy = "coalesce" }, ""},
+		{"dropPolicy unknown", func(c *config.Config) { c.DropPolicy = "bogus" }, "dropPolicy"},
+		{"eventBuffer negative", func(c *config.Config) { c.EventBuffer = -1 }, "eventBuffer"},
+		{"snapshotEvents negative", func(c *config.Config) { c.SnapshotEvents = -1 }, "snapshotEvents"},
+		{"historyEvents negative", func(c *config.Config) { c.HistoryEvents = -5 }, "historyEvents"},
+		{"historyEvents zero", func(c *config.Config) { c.HistoryEvents = 0 }, ""},
+		{"sessionAliases valid", func(c *config.Config) { c.SessionAliases = map[string]string{"~/work/api": "work-api", "/srv": "prod"} }, ""},
+		{"sessionAliases relative", func(c *config.Config) { c.SessionAliases = map[string]string{"work/api": "work-api"} }, "sessionAliases.work/api"},
+		{"sessionAliases empty name", func(c *config.Config) { c.SessionAliases = map[string]string{"/srv/api": " "} }, "sessionAliases./srv/api"},
+		{"redactPatterns valid", func(c *config.Config) { c.RedactPatterns = []string{`acme-\d+`} }, ""},
+		{"redactPatterns invalid", func(c *config.Config) { c.RedactPatterns = []string{"ok", "(unclosed"} }, "redactPatterns.1"},
+		{"detailLevels valid", func(c *config.Config) { c.DetailLevels = map[string]string{"read": "basename", "action": "none"} }, ""},
+		{"detailLevels unknown", func(c *config.Config) { c.DetailLevels = map[string]string{"network": "host"} }, "detailLevels.network"},
+		{"volume in range", func(c *config.Config) { c.CategoryVolumes["write"] = 1 }, ""},
+		{"volume negative", func(c *config.Config) { c.CategoryVolumes["error"] = -0.1 }, "categoryVolumes.error"},
+		{"volume too loud", func(c *config.Config) { c.CategoryVolumes["warn"] = 1.01 }, "categoryVolumes.warn"},
+		{"idleTimeout unparseable", func(c *config.Config) { c.IdleTimeout = "5 minutes" }, "idleTimeout"},
+		{"pongTimeout negative", func(c *config.Config) { c.PongTimeout = "-1s" }, "pongTimeout"},
+		{"activePack missing", func(c *config.Config) { c.ActivePack = "retro" }, "activePack"},
+		{"activePack path", func(c *config.Config) { c.ActivePack = "../default" }, "activePack"},
+		{"activePack empty", func(c *config.Config) { c.ActivePack = "" }, "activePack"},
+		{"profile valid", func(c *config.Config) {
+			c.Profiles["focus"] = config.Profile{ActivePack: "default", CategoryVolumes: map[string]float64{"read": 0}}
+			c.ActiveProfile = "focus"
+		}, ""},
+		{"profile volume", func(c *config.Config) {
+			c.Profiles["demo"] = config.Profile{CategoryVolumes: map[string]float64{"write": 3}}
+		}, "profiles.demo.categoryVolumes.write"},
+		{"profile pack missing", func(c *config.Config) {
+			c.Profiles["demo"] = config.Profile{ActivePack: "retro"}
+		}, "profiles.demo.activePack"},
+		{"activeProfile unknown", func(c *config.Config) { c.ActiveProfile = "focus" }, "activeProfile"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			tt.modify(cfg)
+			err := cfg.Validate(packsDir)
+
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var verr *config.ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("got %v, want *ValidationError", err)
+			}
+			if len(verr.Errors) != 1 || verr.Errors[0].Field != tt.field {
+				t.Errorf("errors = %+v, want one for %q", verr.Errors, tt.field)
+			}
+		})
+	}
+
+	t.Run("pack check skipped without packsDir", func(t *testing.T) {
+		cfg := config.Default()
+		cfg.ActivePack = "retro"
+		if err := cfg.Validate(""); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+// TestSaveLeavesNoTempFiles verifies that Save's atomic write cleans up
+// after itself, leaving only the config file in its directory.
+func TestSaveLeavesNoTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	for i := 0; i < 3; i++ {
+		if err := config.Save(config.Default(), path); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "config.json" {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("directory contains %v, want only config.json", names)
+	}
+}
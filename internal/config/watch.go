@@ -0,0 +1,117 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce coalesces the burst of filesystem events produced by a single
+// save (editors often write, chmod and rename in quick succession).
+const watchDebounce = 100 * time.Millisecond
+
+// Watcher reloads a config file whenever it changes on disk.
+type Watcher struct {
+	path     string
+	onChange func(*Config)
+	fsw      *fsnotify.Watcher
+	done     chan struct{}
+}
+
+// Watch starts watching the config file at path and calls onChange with the
+// freshly loaded Config after each change settles. Files that fail to load
+// are logged and skipped; onChange receives whatever Load returns otherwise,
+// which parses but may still be invalid, so it must call Validate itself. The
+// parent directory is watched rather than the file itself so that editors
+// which save by renaming a temp file over the original are noticed; it is
+// created if missing.
+func Watch(path string, onChange func(*Config)) (*Watcher, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("config: mkdir %s: %w", dir, err)
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("config: watch: %w", err)
+	}
+	if err := fsw.Add(dir); err != nil {
+		fsw.Close()
+		return nil, fmt.Errorf("config: watch %s: %w", dir, err)
+	}
+
+	w := &Watcher{
+		path:     filepath.Clean(path),
+		onChange: onChange,
+		fsw:      fsw,
+		done:     make(chan struct{}),
+	}
+	go w.loop()
+	return w, nil
+}
+
+// Close stops the watcher. It is safe to call more than once.
+func (w *Watcher) Close() error {
+	select {
+	case <-w.done:
+		return nil
+	default:
+		close(w.done)
+	}
+	return w.fsw.Close()
+}
+
+// loop waits for events on the config file, debounces them, and reloads.
+func (w *Watcher) loop() {
+	var (
+		timer   *time.Timer
+		timerCh <-chan time.Time
+	)
+
+	for {
+		select {
+		case <-w.done:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+
+		case ev, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(ev.Name) != w.path || ev.Op == fsnotify.Chmod {
+				continue
+			}
+			if timer == nil {
+				timer = time.NewTimer(watchDebounce)
+			} else {
+				timer.Reset(watchDebounce)
+			}
+			timerCh = timer.C
+
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("config: watcher error: %v", err)
+
+		case <-timerCh:
+			timerCh = nil
+			if _, err := os.Stat(w.path); err != nil {
+				// Removed (or mid-rename); wait for it to reappear.
+				continue
+			}
+			cfg, err := Load(w.path)
+			if err != nil {
+				log.Printf("config: ignoring change: %v", err)
+				continue
+			}
+			w.onChange(cfg)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dacort/babble/internal/config"
+)
+
+// TestWatch verifies that Watch reports saves and hand edits, skips files
+// that fail to parse, and notices a file replaced by rename.
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "babble", "config.json")
+
+	changes := make(chan *config.Config, 10)
+	w, err := config.Watch(path, func(cfg *config.Config) { changes <- cfg })
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	t.Cleanup(func() { w.Close() })
+
+	next := func() *config.Config {
+		t.Helper()
+		select {
+		case cfg := <-changes:
+			return cfg
+		case <-time.After(3 * time.Second):
+			t.Fatal("timed out waiting for config change")
+			return nil
+		}
+	}
+
+	cfg := config.Default()
+	cfg.ActivePack = "retro"
+	if err := config.Save(cfg, path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if got := next(); got.ActivePack != "retro" {
+		t.Errorf("after Save: ActivePack = %q, want %q", got.ActivePack, "retro")
+	}
+
+	// Invalid JSON is skipped; the following valid write is reported.
+	if err := os.WriteFile(path, []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(`{"activePack":"chiptune"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	if got := next(); got.ActivePack != "chiptune" {
+		t.Errorf("after rename: ActivePack = %q, want %q", got.ActivePack, "chiptune")
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"errors"
 	"path"
 	"strings"
+
+	"github.com/dacort/babble/internal/gitinfo"
 )
 
 // Category classifies a BabbleEvent into a display bucket.
@@ -40,6 +42,9 @@ const (
 var ErrSkipEvent = errors.New("skip event")
 
 // BabbleEvent is the normalised representation of a single log line.
+// ParseLine leaves Host, Seq and Git empty: the session manager stamps Host,
+// and the server numbers events with Seq in the order it broadcasts them and
+// looks up Git from Cwd.
 type BabbleEvent struct {
 	Session    string   `json:"session"`
 	SessionID  string   `json:"sessionId"`
@@ -48,6 +53,32 @@ type BabbleEvent struct {
 	Detail     string   `json:"detail"`
 	Timestamp  string   `json:"timestamp"`
 	IsSubagent bool     `json:"isSubagent,omitempty"`
+	Host       string   `json:"host,omitempty"`
+	Seq        uint64   `json:"seq,omitempty"`
+	// ToolUse is set when Event names a tool Claude called.
+	ToolUse bool `json:"toolUse,omitempty"`
+	// Usage is the token usage reported with an assistant message.
+	Usage *Usage `json:"usage,omitempty"`
+	// Cwd is the session's working directory when the event was logged.
+	Cwd string `json:"cwd,omitempty"`
+	// AgentID identifies the subagent that logged the event, if any.
+	AgentID string `json:"agentId,omitempty"`
+	// Git describes the git working tree Cwd is in, if any.
+	Git *gitinfo.Info `json:"git,omitempty"`
+	// FilePath is the file a write tool changed, in full; Detail holds the
+	// same path cut to 80 characters.
+	FilePath string `json:"filePath,omitempty"`
+}
+
+// Usage counts the tokens of one API response. Claude Code logs a response
+// with several content blocks as several lines, each repeating the same
+// usage, so totals must count each MessageID once.
+type Usage struct {
+	MessageID     string `json:"messageId,omitempty"`
+	Input         int    `json:"input"`
+	Output        int    `json:"output"`
+	CacheCreation int    `json:"cacheCreation,omitempty"`
+	CacheRead     int    `json:"cacheRead,omitempty"`
 }
 
 // -----------------------------------------------------------------------------
@@ -61,14 +92,25 @@ type rawLine struct {
 	SessionID string           `json:"sessionId"`
 	Timestamp string           `json:"timestamp"`
 	Cwd       string           `json:"cwd"`
+	AgentID   string           `json:"agentId"`
 	Message   *rawMessage      `json:"message"`
 	Data      *rawProgressData `json:"data"`
 }
 
 // rawMessage represents the message field present on assistant and user events.
 type rawMessage struct {
+	ID      string       `json:"id"`
 	Role    string       `json:"role"`
 	Content []rawContent `json:"content"`
+	Usage   *rawUsage    `json:"usage"`
+}
+
+// rawUsage is the token usage attached to assistant messages.
+type rawUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
 }
 
 // rawContent represents a single element in the content array.
@@ -139,7 +181,17 @@ var skippedTypes = map[string]bool{
 // ParseLine parses a single JSONL line from a Claude Code session log and
 // returns a BabbleEvent. It returns (nil, ErrSkipEvent) for events that should
 // be discarded by the caller, and a non-nil error for malformed input.
+// Every call is counted in the parse metrics (see ReadParseStats), which are
+// meant to describe live log traffic, so only the tailer should call it.
 func ParseLine(line []byte) (*BabbleEvent, error) {
+	ev, err := Parse(line)
+	countParse(ev, err)
+	return ev, err
+}
+
+// Parse is ParseLine without the parse metrics, for reading logs after the
+// fact as babble report does.
+func Parse(line []byte) (*BabbleEvent, error) {
 	var raw rawLine
 	if err := json.Unmarshal(line, &raw); err != nil {
 		return nil, err
@@ -154,6 +206,8 @@ func ParseLine(line []byte) (*BabbleEvent, error) {
 		Session:   SessionNameFromCwd(raw.Cwd),
 		SessionID: raw.SessionID,
 		Timestamp: raw.Timestamp,
+		Cwd:       raw.Cwd,
+		AgentID:   raw.AgentID,
 	}
 
 	switch raw.Type {
@@ -224,6 +278,15 @@ func SessionNameFromCwd(cwd string) string {
 
 // parseAssistant handles type=assistant lines.
 func parseAssistant(ev *BabbleEvent, msg *rawMessage) (*BabbleEvent, error) {
+	if msg != nil && msg.Usage != nil {
+		ev.Usage = &Usage{
+			MessageID:     msg.ID,
+			Input:         msg.Usage.InputTokens,
+			Output:        msg.Usage.OutputTokens,
+			CacheCreation: msg.Usage.CacheCreationInputTokens,
+			CacheRead:     msg.Usage.CacheReadInputTokens,
+		}
+	}
 	if msg == nil || len(msg.Content) == 0 {
 		ev.Category = CategoryAmbient
 		ev.Event = "assistant"
@@ -258,6 +321,7 @@ func parseAssistant(ev *BabbleEvent, msg *rawMessage) (*BabbleEvent, error) {
 // classifyToolUse maps a tool_use content block to category + detail.
 func classifyToolUse(ev *BabbleEvent, block rawContent) (*BabbleEvent, error) {
 	ev.Event = block.Name
+	ev.ToolUse = true
 
 	if cat, ok := toolCategory[block.Name]; ok {
 		ev.Category = cat
@@ -273,6 +337,9 @@ func classifyToolUse(ev *BabbleEvent, block rawContent) (*BabbleEvent, error) {
 				var s string
 				if err := json.Unmarshal(raw, &s); err == nil {
 					ev.Detail = truncate(s, 80)
+					if ev.Category == CategoryWrite {
+						ev.FilePath = s
+					}
 				}
 			}
 		}
@@ -2,6 +2,7 @@ package events_test
 
 import (
 	"errors"
+	"strings"
 	"testing"
 
 	"github.com/dacort/babble/internal/events"
@@ -42,6 +43,9 @@ func TestParseAssistantToolUse(t *testing.T) {
 	if ev.Detail != "/home/user/myproject/main.go" {
 		t.Errorf("detail = %q, want %q", ev.Detail, "/home/user/myproject/main.go")
 	}
+	if ev.FilePath != ev.Detail {
+		t.Errorf("filePath = %q, want %q", ev.FilePath, ev.Detail)
+	}
 	if ev.Event != "Edit" {
 		t.Errorf("event = %q, want %q", ev.Event, "Edit")
 	}
@@ -252,6 +256,45 @@ func TestDetailTruncation(t *testing.T) {
 	if len(ev.Detail) > 80 {
 		t.Errorf("detail length = %d, want <= 80; detail = %q", len(ev.Detail), ev.Detail)
 	}
+	if ev.FilePath != "" {
+		t.Errorf("filePath = %q for a read, want empty", ev.FilePath)
+	}
+}
+
+// TestWriteFilePath verifies that a write tool's file path is kept in full
+// in FilePath while Detail is truncated.
+func TestWriteFilePath(t *testing.T) {
+	longPath := "/home/user/project/" + strings.Repeat("nested/", 12) + "file.go"
+	line := []byte(`{
+		"type": "assistant",
+		"sessionId": "write01",
+		"timestamp": "2024-01-01T00:06:30Z",
+		"cwd": "/home/user/project",
+		"message": {
+			"role": "assistant",
+			"content": [
+				{
+					"type": "tool_use",
+					"name": "Write",
+					"input": {
+						"file_path": "` + longPath + `",
+						"content": "package main"
+					}
+				}
+			]
+		}
+	}`)
+
+	ev, err := events.ParseLine(line)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ev.FilePath != longPath {
+		t.Errorf("filePath = %q, want %q", ev.FilePath, longPath)
+	}
+	if len(ev.Detail) != 80 {
+		t.Errorf("detail length = %d, want 80", len(ev.Detail))
+	}
 }
 
 // TestParseBashToolUse verifies that a Bash tool_use block is classified as
@@ -376,3 +419,68 @@ func TestParseProgressWithoutMessageNotSkipped(t *testing.T) {
 		t.Errorf("category = %q, want %q", ev.Category, events.CategoryInit)
 	}
 }
+
+// TestReadParseStats checks that ParseLine counts parsed, skipped and
+// malformed lines.
+func TestReadParseStats(t *testing.T) {
+	before := events.ReadParseStats()
+
+	events.ParseLine([]byte(`{"type":"system","subtype":"compact_boundary"}`)) //nolint:errcheck
+	events.ParseLine([]byte(`{"type":"file-history-snapshot"}`))               //nolint:errcheck
+	events.ParseLine([]byte(`not json`))                                       //nolint:errcheck
+
+	after := events.ReadParseStats()
+	if got := after.Lines - before.Lines; got != 3 {
+		t.Errorf("lines: counted %d, want 3", got)
+	}
+	if got := after.Skipped - before.Skipped; got != 1 {
+		t.Errorf("skipped: counted %d, want 1", got)
+	}
+	if got := after.Errors - before.Errors; got != 1 {
+		t.Errorf("errors: counted %d, want 1", got)
+	}
+	if got := after.ByCategory[events.CategoryWarn] - before.ByCategory[events.CategoryWarn]; got != 1 {
+		t.Errorf("warn events: counted %d, want 1", got)
+	}
+}
+
+// TestParseUsage verifies that token usage is taken from assistant messages
+// along with the message ID, and that tool calls are flagged.
+func TestParseUsage(t *testing.T) {
+	line := []byte(`{"type":"assistant","sessionId":"s","timestamp":"2024-01-01T00:00:00Z","cwd":"/p",` +
+		`"message":{"id":"msg_01","role":"assistant","content":[{"type":"tool_use","name":"Read","input":{"file_path":"/p/a.go"}}],` +
+		`"usage":{"input_tokens":12,"output_tokens":34,"cache_creation_input_tokens":5,"cache_read_input_tokens":600}}}`)
+	ev, err := events.ParseLine(line)
+	if err != nil {
+		t.Fatalf("ParseLine: %v", err)
+	}
+	if !ev.ToolUse {
+		t.Error("ToolUse = false for a tool_use block")
+	}
+	want := events.Usage{MessageID: "msg_01", Input: 12, Output: 34, CacheCreation: 5, CacheRead: 600}
+	if ev.Usage == nil || *ev.Usage != want {
+		t.Errorf("Usage = %+v, want %+v", ev.Usage, want)
+	}
+
+	ev, err = events.ParseLine([]byte(`{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"hi"}]}}`))
+	if err != nil {
+		t.Fatalf("ParseLine: %v", err)
+	}
+	if ev.ToolUse || ev.Usage != nil {
+		t.Errorf("text without usage: ToolUse=%v Usage=%+v, want neither", ev.ToolUse, ev.Usage)
+	}
+}
+
+// TestParseCwdAndAgent verifies that the working directory and subagent ID
+// are carried over from the log line.
+func TestParseCwdAndAgent(t *testing.T) {
+	line := []byte(`{"type":"assistant","sessionId":"s","agentId":"a1b2","cwd":"/home/u/api",` +
+		`"message":{"role":"assistant","content":[{"type":"text","text":"hi"}]}}`)
+	ev, err := events.ParseLine(line)
+	if err != nil {
+		t.Fatalf("ParseLine: %v", err)
+	}
+	if ev.Cwd != "/home/u/api" || ev.AgentID != "a1b2" {
+		t.Errorf("Cwd, AgentID = %q, %q, want /home/u/api, a1b2", ev.Cwd, ev.AgentID)
+	}
+}
@@ -0,0 +1,49 @@
+package events
+
+import (
+	"errors"
+
+	"github.com/dacort/babble/internal/metrics"
+)
+
+var (
+	parseLines   = metrics.Default.Counter("babble_parse_lines_total", "Session log lines passed to the parser.")
+	parseSkipped = metrics.Default.Counter("babble_parse_skipped_total", "Lines parsed but deliberately discarded.")
+	parseErrors  = metrics.Default.Counter("babble_parse_errors_total", "Lines that could not be parsed.")
+	parsedEvents = metrics.Default.CounterVec("babble_events_total", "Events parsed from session logs, by category.", "category")
+)
+
+// ParseStats counts the outcomes of ParseLine since the process started.
+type ParseStats struct {
+	Lines      uint64              `json:"lines"`
+	Skipped    uint64              `json:"skipped"`
+	Errors     uint64              `json:"errors"`
+	ByCategory map[Category]uint64 `json:"byCategory"`
+}
+
+// ReadParseStats returns the current parse counts.
+func ReadParseStats() ParseStats {
+	st := ParseStats{
+		Lines:      parseLines.Value(),
+		Skipped:    parseSkipped.Value(),
+		Errors:     parseErrors.Value(),
+		ByCategory: make(map[Category]uint64),
+	}
+	for cat, n := range parsedEvents.Values() {
+		st.ByCategory[Category(cat)] = n
+	}
+	return st
+}
+
+// countParse records the outcome of one ParseLine call.
+func countParse(ev *BabbleEvent, err error) {
+	parseLines.Inc()
+	switch {
+	case errors.Is(err, ErrSkipEvent):
+		parseSkipped.Inc()
+	case err != nil:
+		parseErrors.Inc()
+	default:
+		parsedEvents.With(string(ev.Category)).Inc()
+	}
+}
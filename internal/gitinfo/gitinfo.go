@@ -0,0 +1,206 @@
+// Package gitinfo finds the git repository a directory belongs to, its
+// current branch and remote by reading the .git directory itself, without
+// running git.
+package gitinfo
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Info describes the git working tree that contains a directory.
+type Info struct {
+	Root   string `json:"root"`             // top directory of the working tree
+	Repo   string `json:"repo"`             // base name of Root
+	Branch string `json:"branch,omitempty"` // "" when HEAD is detached
+	Remote string `json:"remote,omitempty"` // e.g. "origin"; "" if there is none
+}
+
+// Lookup returns the working tree containing dir, with its branch and the
+// remote that branch tracks, searching dir and its parents for a .git
+// directory, or a .git file as left by git worktree and submodules. ok is
+// false if dir is not inside a working tree or its HEAD cannot be read.
+func Lookup(dir string) (info Info, ok bool) {
+	if dir == "" {
+		return Info{}, false
+	}
+	for d := filepath.Clean(dir); ; {
+		if gitDir, found := findGitDir(d); found {
+			head, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+			if err != nil {
+				return Info{}, false
+			}
+			info := Info{Root: d, Repo: filepath.Base(d), Branch: branch(head)}
+			info.Remote = remote(commonDir(gitDir), info.Branch)
+			return info, true
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return Info{}, false
+		}
+		d = parent
+	}
+}
+
+// findGitDir returns the git directory of the working tree rooted at d, if
+// d is one.
+func findGitDir(d string) (string, bool) {
+	path := filepath.Join(d, ".git")
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", false
+	}
+	if fi.IsDir() {
+		return path, true
+	}
+	// A .git file points elsewhere: "gitdir: <path>".
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	target, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+	if !ok {
+		return "", false
+	}
+	target = strings.TrimSpace(target)
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(d, target)
+	}
+	return target, true
+}
+
+// branch returns the branch named by the contents of a HEAD file, or "" if
+// HEAD holds a commit rather than a branch reference.
+func branch(head []byte) string {
+	ref, ok := strings.CutPrefix(strings.TrimSpace(string(head)), "ref:")
+	if !ok {
+		return ""
+	}
+	ref = strings.TrimSpace(ref)
+	if name, ok := strings.CutPrefix(ref, "refs/heads/"); ok {
+		return name
+	}
+	return ref
+}
+
+// commonDir returns the directory holding the config shared by every
+// worktree of the repository whose git directory is gitDir.
+func commonDir(gitDir string) string {
+	data, err := os.ReadFile(filepath.Join(gitDir, "commondir"))
+	if err != nil {
+		return gitDir
+	}
+	dir := strings.TrimSpace(string(data))
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(gitDir, dir)
+	}
+	return dir
+}
+
+// remote returns the remote that branch tracks according to the config file
+// in dir, or else "origin" if it exists, or else the first remote.
+func remote(dir, branch string) string {
+	data, err := os.ReadFile(filepath.Join(dir, "config"))
+	if err != nil {
+		return ""
+	}
+	var remotes []string
+	tracked := ""
+	section := ""
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if strings.HasPrefix(line, "[") {
+			section = strings.Trim(line, "[]")
+			if name, ok := subsection(section, "remote"); ok {
+				remotes = append(remotes, name)
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(key) != "remote" {
+			continue
+		}
+		if name, ok := subsection(section, "branch"); ok && name == branch && branch != "" {
+			tracked = strings.TrimSpace(value)
+		}
+	}
+	switch {
+	case tracked != "" && tracked != ".":
+		return tracked
+	case len(remotes) == 0:
+		return ""
+	}
+	for _, r := range remotes {
+		if r == "origin" {
+			return r
+		}
+	}
+	return remotes[0]
+}
+
+// subsection returns name if section is `kind "name"`.
+func subsection(section, kind string) (string, bool) {
+	rest, ok := strings.CutPrefix(section, kind+" ")
+	if !ok {
+		return "", false
+	}
+	return strings.Trim(strings.TrimSpace(rest), `"`), true
+}
+
+// Cache remembers what Lookup found for each directory, including that a
+// directory is not in a working tree. It is safe for concurrent use.
+type Cache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// cacheEntry is one remembered Lookup result.
+type cacheEntry struct {
+	info Info
+	ok   bool
+}
+
+// NewCache returns an empty Cache.
+func NewCache() *Cache {
+	return &Cache{entries: make(map[string]cacheEntry)}
+}
+
+// Lookup is like the package-level Lookup, but reads the .git directory only
+// the first time it is asked about dir, or after Forget.
+func (c *Cache) Lookup(dir string) (Info, bool) {
+	c.mu.Lock()
+	e, found := c.entries[dir]
+	c.mu.Unlock()
+	if found {
+		return e.info, e.ok
+	}
+
+	info, ok := Lookup(dir)
+	c.mu.Lock()
+	c.entries[dir] = cacheEntry{info: info, ok: ok}
+	c.mu.Unlock()
+	return info, ok
+}
+
+// Forget discards what c knows about dir and every other directory in the
+// same working tree, so that the next Lookup of each reads it afresh.
+func (c *Cache) Forget(dir string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, found := c.entries[dir]
+	delete(c.entries, dir)
+	if !found || !e.ok {
+		return
+	}
+	for d, other := range c.entries {
+		if other.ok && other.info.Root == e.info.Root {
+			delete(c.entries, d)
+		}
+	}
+}
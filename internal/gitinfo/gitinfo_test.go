@@ -0,0 +1,98 @@
+package gitinfo_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dacort/babble/internal/gitinfo"
+)
+
+// writeFile creates path, and its parent directories, holding data.
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestLookup checks repositories, worktrees, detached HEADs and directories
+// outside any repository.
+func TestLookup(t *testing.T) {
+	root := t.TempDir()
+	api := filepath.Join(root, "api")
+	writeFile(t, filepath.Join(api, ".git", "HEAD"), "ref: refs/heads/feature/login\n")
+	writeFile(t, filepath.Join(api, ".git", "config"), `[core]
+	bare = false
+[remote "fork"]
+	url = git@example.com:me/api.git
+[remote "origin"]
+	url = git@example.com:team/api.git
+[branch "fix"]
+	remote = fork
+	merge = refs/heads/fix
+`)
+	sub := filepath.Join(api, "internal", "server")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// A worktree's .git file points at its git directory, relatively here.
+	wt := filepath.Join(root, "api-fix")
+	writeFile(t, filepath.Join(api, ".git", "worktrees", "api-fix", "HEAD"), "ref: refs/heads/fix\n")
+	writeFile(t, filepath.Join(api, ".git", "worktrees", "api-fix", "commondir"), "../..\n")
+	writeFile(t, filepath.Join(wt, ".git"), "gitdir: ../api/.git/worktrees/api-fix\n")
+
+	detached := filepath.Join(root, "old")
+	writeFile(t, filepath.Join(detached, ".git", "HEAD"), "4b825dc642cb6eb9a060e54bf8d69288fbee4904\n")
+
+	tests := []struct {
+		dir  string
+		want gitinfo.Info
+	}{
+		{api, gitinfo.Info{Root: api, Repo: "api", Branch: "feature/login", Remote: "origin"}},
+		{sub, gitinfo.Info{Root: api, Repo: "api", Branch: "feature/login", Remote: "origin"}},
+		{wt, gitinfo.Info{Root: wt, Repo: "api-fix", Branch: "fix", Remote: "fork"}},
+		{detached, gitinfo.Info{Root: detached, Repo: "old"}},
+	}
+	for _, tt := range tests {
+		got, ok := gitinfo.Lookup(tt.dir)
+		if !ok || got != tt.want {
+			t.Errorf("Lookup(%s) = %+v, %v, want %+v", tt.dir, got, ok, tt.want)
+		}
+	}
+
+	if got, ok := gitinfo.Lookup(filepath.Join(root, "elsewhere")); ok {
+		t.Errorf("Lookup outside a repository = %+v, want none", got)
+	}
+}
+
+// TestCache checks that a Cache keeps answering from memory until told to
+// forget the working tree.
+func TestCache(t *testing.T) {
+	api := t.TempDir()
+	head := filepath.Join(api, ".git", "HEAD")
+	writeFile(t, head, "ref: refs/heads/main\n")
+	sub := filepath.Join(api, "cmd")
+
+	c := gitinfo.NewCache()
+	for _, dir := range []string{api, sub} {
+		if info, _ := c.Lookup(dir); info.Branch != "main" {
+			t.Fatalf("Lookup(%s) branch = %q, want main", dir, info.Branch)
+		}
+	}
+
+	writeFile(t, head, "ref: refs/heads/next\n")
+	if info, _ := c.Lookup(sub); info.Branch != "main" {
+		t.Errorf("cached branch = %q, want main until forgotten", info.Branch)
+	}
+	c.Forget(api)
+	for _, dir := range []string{api, sub} {
+		if info, _ := c.Lookup(dir); info.Branch != "next" {
+			t.Errorf("Lookup(%s) after Forget: branch = %q, want next", dir, info.Branch)
+		}
+	}
+}
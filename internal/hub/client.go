@@ -0,0 +1,187 @@
+package hub
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/dacort/babble/internal/events"
+)
+
+// Timeouts controls WebSocket keepalive and write behaviour.
+type Timeouts struct {
+	// Write bounds how long a single WebSocket write may take before the
+	// client is considered dead.
+	Write time.Duration
+	// Pong is how long the server waits for any frame (usually a pong) from
+	// the client before dropping the connection.
+	Pong time.Duration
+	// Ping is the interval between server pings. It must be shorter than Pong.
+	Ping time.Duration
+}
+
+// DefaultTimeouts returns the keepalive settings used when none are given.
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		Write: 10 * time.Second,
+		Pong:  60 * time.Second,
+		Ping:  54 * time.Second,
+	}
+}
+
+// withDefaults fills zero fields of t from DefaultTimeouts and keeps Ping
+// below Pong so that a healthy client is never timed out between pings.
+func (t Timeouts) withDefaults() Timeouts {
+	def := DefaultTimeouts()
+	if t.Write <= 0 {
+		t.Write = def.Write
+	}
+	if t.Pong <= 0 {
+		t.Pong = def.Pong
+	}
+	if t.Ping <= 0 || t.Ping >= t.Pong {
+		t.Ping = t.Pong * 9 / 10
+	}
+	return t
+}
+
+// sendBufferSize is the number of messages queued per client. A client whose
+// queue fills up is evicted rather than allowed to slow the hub.
+const sendBufferSize = 64
+
+// maxMessageSize caps the size of a single client-originated message.
+const maxMessageSize = 4096
+
+// ClientInfo describes a connected client for GET /api/clients.
+type ClientInfo struct {
+	ID          uint64    `json:"id"`
+	Protocol    int       `json:"protocol"`
+	RemoteAddr  string    `json:"remoteAddr"`
+	UserAgent   string    `json:"userAgent"`
+	ConnectedAt time.Time `json:"connectedAt"`
+	LastSeen    time.Time `json:"lastSeen"`
+	IdleSeconds float64   `json:"idleSeconds"`
+	Filter      *Filter   `json:"filter,omitempty"`
+}
+
+// client is a single connected WebSocket. Messages for it are queued on send
+// and written by its own writePump goroutine, so a stalled connection only
+// ever blocks itself.
+type client struct {
+	id          uint64
+	conn        *websocket.Conn
+	send        chan []byte
+	version     int // negotiated protocol version
+	timeouts    Timeouts
+	userAgent   string
+	connectedAt time.Time
+	lastSeen    atomic.Int64 // unix nanoseconds of the last frame received
+	filter      atomic.Pointer[Filter]
+
+	// closeCode and closeText are sent in the close frame once send is
+	// closed. They are set under the hub's lock before closing send; zero
+	// means a normal closure.
+	closeCode int
+	closeText string
+}
+
+// wants reports whether ev passes c's subscription filter.
+func (c *client) wants(ev *events.BabbleEvent) bool {
+	f := c.filter.Load()
+	return f == nil || f.Match(ev)
+}
+
+// touch records that a frame was just received from the client and extends
+// its read deadline.
+func (c *client) touch() {
+	now := time.Now()
+	c.lastSeen.Store(now.UnixNano())
+	c.conn.SetReadDeadline(now.Add(c.timeouts.Pong)) //nolint:errcheck
+}
+
+// info returns a snapshot of c's connection details.
+func (c *client) info() ClientInfo {
+	last := time.Unix(0, c.lastSeen.Load())
+	return ClientInfo{
+		ID:          c.id,
+		Protocol:    c.version,
+		RemoteAddr:  c.conn.RemoteAddr().String(),
+		UserAgent:   c.userAgent,
+		ConnectedAt: c.connectedAt,
+		LastSeen:    last,
+		IdleSeconds: time.Since(last).Seconds(),
+		Filter:      c.filter.Load(),
+	}
+}
+
+// readPump reads from c until the connection fails or the read deadline
+// passes without a frame. Every frame, including pongs, extends the deadline.
+// Text messages are handled as control messages (see handleControl).
+func (h *Hub) readPump(c *client) {
+	defer h.removeClient(c)
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetPongHandler(func(string) error {
+		c.touch()
+		return nil
+	})
+	c.touch()
+
+	for {
+		msgType, data, err := c.conn.ReadMessage()
+		if err != nil {
+			// Any error here (including normal close or a missed pong) means
+			// the connection is gone.
+			return
+		}
+		c.touch()
+		if msgType == websocket.TextMessage {
+			h.handleControl(c, data)
+		}
+	}
+}
+
+// writePump writes queued messages to c's connection and pings it every
+// Ping interval, applying the Write timeout to each frame. It returns,
+// closing the connection, when the send queue is closed or a write fails.
+func (h *Hub) writePump(c *client) {
+	ticker := time.NewTicker(c.timeouts.Ping)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case payload, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(c.timeouts.Write)) //nolint:errcheck
+			if !ok {
+				// The hub closed our queue: say goodbye politely, then hang up.
+				code := c.closeCode
+				if code == 0 {
+					code = websocket.CloseNormalClosure
+				}
+				c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, c.closeText)) //nolint:errcheck
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+				writeErrors.Inc()
+				log.Printf("hub: write to client %d: %v — removing", c.id, err)
+				h.removeClient(c)
+				return
+			}
+			messagesSent.Inc()
+
+		case <-ticker.C:
+			deadline := time.Now().Add(c.timeouts.Write)
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				writeErrors.Inc()
+				log.Printf("hub: ping client %d: %v — removing", c.id, err)
+				h.removeClient(c)
+				return
+			}
+		}
+	}
+}
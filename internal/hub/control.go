@@ -0,0 +1,71 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// controlMessage is a JSON message sent by a client over the WebSocket.
+//
+// Supported types:
+//
+//	{"type":"subscribe","categories":["error","warn"],"sessions":["api"]}
+//	{"type":"unsubscribe"}
+//
+// subscribe replaces the client's filter with the one given; any of
+// sessions, categories, hosts and events (globs) may be set. unsubscribe
+// clears the filter so the client receives everything again.
+//
+// ProtocolV1 clients may instead wrap the filter in an Envelope:
+//
+//	{"v":1,"type":"subscribe","data":{"categories":["error"]}}
+type controlMessage struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+	Filter
+}
+
+// errorData is the payload of an "error" message reporting a rejected
+// control message back to the client.
+type errorData struct {
+	Message string `json:"message"`
+}
+
+// handleControl applies a single control message from c. Replies are only
+// delivered to ProtocolV1 clients.
+func (h *Hub) handleControl(c *client, data []byte) {
+	var msg controlMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		h.send(c, TypeError, errorData{Message: "invalid message: " + err.Error()})
+		return
+	}
+	if len(msg.Data) > 0 {
+		msg.Filter = Filter{}
+		if err := json.Unmarshal(msg.Data, &msg.Filter); err != nil {
+			h.send(c, TypeError, errorData{Message: "invalid data: " + err.Error()})
+			return
+		}
+	}
+
+	switch msg.Type {
+	case "subscribe":
+		if err := msg.Filter.Validate(); err != nil {
+			h.send(c, TypeError, errorData{Message: err.Error()})
+			return
+		}
+		if msg.Filter.IsZero() {
+			c.filter.Store(nil)
+		} else {
+			f := msg.Filter
+			c.filter.Store(&f)
+		}
+		h.send(c, TypeSubscribed, msg.Filter)
+
+	case "unsubscribe":
+		c.filter.Store(nil)
+		h.send(c, TypeSubscribed, Filter{})
+
+	default:
+		h.send(c, TypeError, errorData{Message: fmt.Sprintf("unknown message type %q", msg.Type)})
+	}
+}
@@ -0,0 +1,88 @@
+package hub
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/dacort/babble/internal/events"
+)
+
+// Filter selects which events a client receives. Each non-empty field
+// narrows the selection; an event must satisfy every non-empty field to
+// match. The zero Filter matches everything.
+type Filter struct {
+	// Sessions lists session names or session IDs.
+	Sessions []string `json:"sessions,omitempty"`
+	// Categories lists event categories such as "error" or "warn".
+	Categories []string `json:"categories,omitempty"`
+	// Hosts lists the hostnames events originate from.
+	Hosts []string `json:"hosts,omitempty"`
+	// Events lists glob patterns (path.Match syntax) matched against the
+	// event name, e.g. "Web*" or "tool_result".
+	Events []string `json:"events,omitempty"`
+}
+
+// FilterFromQuery builds a Filter from URL query parameters, mirroring the
+// WebSocket subscribe message: session, category, host and event. Each may be
+// repeated or hold a comma-separated list, e.g.
+//
+//	?category=error,warn&session=api
+func FilterFromQuery(q url.Values) Filter {
+	return Filter{
+		Sessions:   queryList(q, "session"),
+		Categories: queryList(q, "category"),
+		Hosts:      queryList(q, "host"),
+		Events:     queryList(q, "event"),
+	}
+}
+
+// queryList collects the non-empty comma-separated values of key in q.
+func queryList(q url.Values, key string) []string {
+	var out []string
+	for _, v := range q[key] {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				out = append(out, item)
+			}
+		}
+	}
+	return out
+}
+
+// Validate reports an error if any event glob is malformed.
+func (f Filter) Validate() error {
+	for _, pattern := range f.Events {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid event pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// IsZero reports whether f matches every event.
+func (f Filter) IsZero() bool {
+	return len(f.Sessions) == 0 && len(f.Categories) == 0 && len(f.Hosts) == 0 && len(f.Events) == 0
+}
+
+// Match reports whether ev passes the filter.
+func (f Filter) Match(ev *events.BabbleEvent) bool {
+	if len(f.Sessions) > 0 && !slices.Contains(f.Sessions, ev.Session) && !slices.Contains(f.Sessions, ev.SessionID) {
+		return false
+	}
+	if len(f.Categories) > 0 && !slices.Contains(f.Categories, string(ev.Category)) {
+		return false
+	}
+	if len(f.Hosts) > 0 && !slices.Contains(f.Hosts, ev.Host) {
+		return false
+	}
+	if len(f.Events) > 0 && !slices.ContainsFunc(f.Events, func(pattern string) bool {
+		ok, _ := path.Match(pattern, ev.Event)
+		return ok
+	}) {
+		return false
+	}
+	return true
+}
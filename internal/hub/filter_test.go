@@ -0,0 +1,76 @@
+package hub_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/dacort/babble/internal/events"
+	"github.com/dacort/babble/internal/hub"
+)
+
+func TestFilterMatch(t *testing.T) {
+	ev := &events.BabbleEvent{
+		Session:   "api",
+		SessionID: "sess-1",
+		Category:  events.CategoryNetwork,
+		Event:     "WebFetch",
+		Host:      "laptop",
+	}
+
+	tests := []struct {
+		name   string
+		filter hub.Filter
+		want   bool
+	}{
+		{"zero filter matches", hub.Filter{}, true},
+		{"session by name", hub.Filter{Sessions: []string{"api"}}, true},
+		{"session by id", hub.Filter{Sessions: []string{"sess-1"}}, true},
+		{"other session", hub.Filter{Sessions: []string{"web"}}, false},
+		{"category", hub.Filter{Categories: []string{"error", "network"}}, true},
+		{"other category", hub.Filter{Categories: []string{"error", "warn"}}, false},
+		{"host", hub.Filter{Hosts: []string{"laptop"}}, true},
+		{"other host", hub.Filter{Hosts: []string{"desktop"}}, false},
+		{"event glob", hub.Filter{Events: []string{"Web*"}}, true},
+		{"event glob miss", hub.Filter{Events: []string{"Bash", "Read"}}, false},
+		{"all fields must match", hub.Filter{Sessions: []string{"api"}, Categories: []string{"error"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(ev); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterValidate(t *testing.T) {
+	if err := (hub.Filter{Events: []string{"Web*", "Bash"}}).Validate(); err != nil {
+		t.Errorf("valid patterns: unexpected error %v", err)
+	}
+	if err := (hub.Filter{Events: []string{"[unterminated"}}).Validate(); err == nil {
+		t.Error("malformed pattern: expected error, got nil")
+	}
+}
+
+func TestFilterFromQuery(t *testing.T) {
+	q := url.Values{
+		"category": {"error,warn"},
+		"session":  {"api", "web"},
+		"event":    {" Web* "},
+	}
+	f := hub.FilterFromQuery(q)
+
+	if len(f.Categories) != 2 || f.Categories[0] != "error" || f.Categories[1] != "warn" {
+		t.Errorf("Categories = %v, want [error warn]", f.Categories)
+	}
+	if len(f.Sessions) != 2 {
+		t.Errorf("Sessions = %v, want [api web]", f.Sessions)
+	}
+	if len(f.Events) != 1 || f.Events[0] != "Web*" {
+		t.Errorf("Events = %v, want [Web*]", f.Events)
+	}
+	if f.Hosts != nil {
+		t.Errorf("Hosts = %v, want nil", f.Hosts)
+	}
+}
@@ -3,24 +3,21 @@
 package hub
 
 import (
-	"encoding/json"
 	"log"
 	"net/http"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 
 	"github.com/dacort/babble/internal/events"
 )
 
-// upgrader accepts WebSocket connections from any origin. Origin checking is
-// intentionally permissive because Babble is a local-only tool.
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
-}
-
 // Hub receives BabbleEvents on an input channel and fans them out as JSON
-// text messages to every connected WebSocket client.
+// text messages to every connected WebSocket client. Each client receives
+// messages in the protocol version it negotiated on connect (see
+// negotiateVersion).
 //
 // Typical usage:
 //
@@ -30,88 +27,263 @@ var upgrader = websocket.Upgrader{
 type Hub struct {
 	eventCh <-chan *events.BabbleEvent
 
-	mu      sync.Mutex
-	clients map[*websocket.Conn]struct{}
+	mu       sync.Mutex
+	clients  map[*client]struct{}
+	subs     map[*subscriber]struct{}
+	timeouts Timeouts
+	nextID   uint64
+	snapshot func() any
+	origin   func(*http.Request) bool // nil: same-origin only
+	closed   bool                     // set once Run has returned; no new clients are accepted
+
+	writers sync.WaitGroup // running writePump goroutines
+	done    chan struct{}  // closed once Run has closed every client
 }
 
-// New creates a Hub that reads from eventCh.
+// New creates a Hub that reads from eventCh, using DefaultTimeouts.
 func New(eventCh <-chan *events.BabbleEvent) *Hub {
 	return &Hub{
-		eventCh: eventCh,
-		clients: make(map[*websocket.Conn]struct{}),
+		eventCh:  eventCh,
+		clients:  make(map[*client]struct{}),
+		subs:     make(map[*subscriber]struct{}),
+		timeouts: DefaultTimeouts(),
+		done:     make(chan struct{}),
 	}
 }
 
-// Run reads BabbleEvents from the event channel and broadcasts each one as a
-// JSON text message to all connected clients. It blocks until eventCh is
-// closed.
+// SetTimeouts changes the keepalive and write timeouts. Zero fields fall back
+// to DefaultTimeouts. The new values apply to clients that connect afterwards.
+func (h *Hub) SetTimeouts(t Timeouts) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.timeouts = t.withDefaults()
+}
+
+// Run reads BabbleEvents from the event channel and broadcasts each one as an
+// "event" message to all connected clients. It blocks until eventCh is
+// closed. Run never waits on network I/O; delivery happens in each client's
+// writer goroutine.
+//
+// Once eventCh is closed, Run shuts the hub down: every client is sent what
+// is left in its queue followed by a "going away" close frame, in-process
+// subscriptions are closed, and further connections are refused. Done is
+// closed when all of that has finished.
 func (h *Hub) Run() {
 	for ev := range h.eventCh {
-		payload, err := json.Marshal(ev)
-		if err != nil {
-			log.Printf("hub: marshal event: %v", err)
-			continue
-		}
-		h.broadcast(payload)
+		eventsBroadcast.Inc()
+		h.broadcast(newEncoder(TypeEvent, ev), ev)
+		h.publish(ev)
+	}
+	h.closeAll()
+	go func() {
+		h.writers.Wait()
+		close(h.done)
+	}()
+}
+
+// Done returns a channel that is closed once Run has returned and every
+// client's final messages and close frame have been written (or timed out).
+func (h *Hub) Done() <-chan struct{} {
+	return h.done
+}
+
+// closeAll disconnects every client with a "going away" close frame, closes
+// every subscription, and stops new clients from registering.
+func (h *Hub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for c := range h.clients {
+		c.closeCode = websocket.CloseGoingAway
+		c.closeText = "server shutting down"
+		h.evictLocked(c)
+	}
+	for sub := range h.subs {
+		h.unsubscribeLocked(sub)
+	}
+}
+
+// Broadcast sends a message of type typ carrying data to every connected
+// client. It is used for messages that originate outside the event stream,
+// such as drop notifications. Legacy-protocol clients do not receive them.
+func (h *Hub) Broadcast(typ string, data any) {
+	h.broadcast(newEncoder(typ, data), nil)
+}
+
+// ClientCount returns the number of currently connected clients.
+func (h *Hub) ClientCount() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients)
+}
+
+// SetSnapshot registers fn to build the data of the "snapshot" message sent to
+// each client as soon as it connects, before any broadcast. A nil fn (the
+// default) disables the snapshot.
+func (h *Hub) SetSnapshot(fn func() any) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.snapshot = fn
+}
+
+// SetCheckOrigin replaces the check applied to a connection's Origin header.
+// By default only pages served from the same host as the WebSocket may
+// connect.
+func (h *Hub) SetCheckOrigin(fn func(r *http.Request) bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.origin = fn
+}
+
+// Clients returns connection details for every connected client, ordered by
+// connection time.
+func (h *Hub) Clients() []ClientInfo {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	infos := make([]ClientInfo, 0, len(h.clients))
+	for c := range h.clients {
+		infos = append(infos, c.info())
 	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
 }
 
-// broadcast sends payload to every registered client. Clients that cannot be
-// written to are closed and removed from the set.
-func (h *Hub) broadcast(payload []byte) {
+// broadcast queues the message held by enc for every registered client whose
+// subscription matches ev. A nil ev marks a control message, which every
+// client receives.
+func (h *Hub) broadcast(enc *encoder, ev *events.BabbleEvent) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	for conn := range h.clients {
-		if err := conn.WriteMessage(websocket.TextMessage, payload); err != nil {
-			log.Printf("hub: write to client: %v — removing", err)
-			conn.Close()
-			delete(h.clients, conn)
+	for c := range h.clients {
+		if ev != nil && !c.wants(ev) {
+			continue
 		}
+		if payload := enc.payload(c.version); payload != nil {
+			h.enqueueLocked(c, payload)
+		}
+	}
+}
+
+// enqueueLocked queues payload for c. A client whose send queue is already
+// full is evicted: its queue is closed, which makes the writer goroutine close
+// the connection. The caller must hold h.mu.
+func (h *Hub) enqueueLocked(c *client, payload []byte) {
+	if _, ok := h.clients[c]; !ok {
+		return
+	}
+	select {
+	case c.send <- payload:
+	default:
+		log.Printf("hub: client %d too slow — evicting", c.id)
+		evictions.Inc()
+		h.evictLocked(c)
 	}
 }
 
+// send queues a message of type typ for c alone.
+func (h *Hub) send(c *client, typ string, data any) {
+	payload := newEncoder(typ, data).payload(c.version)
+	if payload == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.enqueueLocked(c, payload)
+}
+
 // HandleWS upgrades an HTTP request to a WebSocket connection, registers the
-// client, and then reads (and discards) incoming messages until the connection
-// closes. Discarding messages is required so that the gorilla/websocket library
-// can process control frames (ping/pong/close) and detect disconnection.
+// client, and starts its reader and writer goroutines. The writer pings the
+// client periodically; the reader drops the connection if nothing (not even a
+// pong) arrives within the Pong timeout, so half-open connections left behind
+// by a sleeping laptop or dropped VPN do not accumulate.
+//
+// Clients select the enveloped protocol with the babble.v1 subprotocol or a
+// ?v=1 query parameter; without either they get bare events only.
 func (h *Hub) HandleWS(w http.ResponseWriter, r *http.Request) {
+	version, err := negotiateVersion(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.mu.Lock()
+	upgrader := websocket.Upgrader{
+		CheckOrigin:  h.origin,
+		Subprotocols: []string{Subprotocol},
+	}
+	h.mu.Unlock()
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		// Upgrade already wrote an HTTP error response; just log and return.
+		upgradeErrors.Inc()
 		log.Printf("hub: upgrade: %v", err)
 		return
 	}
 
-	h.addClient(conn)
+	c := &client{
+		conn:        conn,
+		send:        make(chan []byte, sendBufferSize),
+		version:     version,
+		userAgent:   r.UserAgent(),
+		connectedAt: time.Now(),
+	}
+	c.lastSeen.Store(c.connectedAt.UnixNano())
+	if !h.addClient(c) {
+		msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+		conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second)) //nolint:errcheck
+		conn.Close()
+		return
+	}
 
-	// Read loop: discard all client-originated messages but keep the connection
-	// alive and detect when the client closes it.
 	go func() {
-		defer h.removeClient(conn)
-		for {
-			if _, _, err := conn.ReadMessage(); err != nil {
-				// Any error here (including normal close) means the connection
-				// is gone.
-				return
-			}
-		}
+		defer h.writers.Done()
+		h.writePump(c)
 	}()
+	go h.readPump(c)
 }
 
-// addClient registers conn in the client set.
-func (h *Hub) addClient(conn *websocket.Conn) {
+// addClient assigns c an ID and the hub's current timeouts, queues the
+// snapshot (if any), then registers it in the client set. Queuing the
+// snapshot under h.mu guarantees it is the first message c receives. It
+// returns false, registering nothing, if the hub has shut down.
+func (h *Hub) addClient(c *client) bool {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	h.clients[conn] = struct{}{}
+	if h.closed {
+		return false
+	}
+	h.writers.Add(1)
+	h.nextID++
+	c.id = h.nextID
+	c.timeouts = h.timeouts
+	if h.snapshot != nil {
+		if payload := newEncoder(TypeSnapshot, h.snapshot()).payload(c.version); payload != nil {
+			c.send <- payload
+		}
+	}
+	h.clients[c] = struct{}{}
+	connections.Inc()
+	clientsGauge.Inc()
+	return true
 }
 
-// removeClient closes conn and removes it from the client set.
-func (h *Hub) removeClient(conn *websocket.Conn) {
+// removeClient unregisters c and closes its send queue, which stops its
+// writer. It is safe to call more than once.
+func (h *Hub) removeClient(c *client) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	if _, ok := h.clients[conn]; ok {
-		conn.Close()
-		delete(h.clients, conn)
+	h.evictLocked(c)
+}
+
+// evictLocked removes c from the client set and closes its send queue if it
+// is still registered. The caller must hold h.mu.
+func (h *Hub) evictLocked(c *client) {
+	if _, ok := h.clients[c]; ok {
+		delete(h.clients, c)
+		close(c.send)
+		clientsGauge.Dec()
 	}
 }
@@ -2,6 +2,7 @@ package hub_test
 
 import (
 	"encoding/json"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -217,3 +218,297 @@ func keys(m map[string]interface{}) []string {
 	}
 	return ks
 }
+
+// TestHubSlowClientDoesNotBlockOthers verifies that a client which never
+// reads is evicted once its send queue fills, while a healthy client keeps
+// receiving events and the broadcast loop never stalls.
+func TestHubSlowClientDoesNotBlockOthers(t *testing.T) {
+	eventCh := make(chan *events.BabbleEvent)
+	h := hub.New(eventCh)
+	go h.Run()
+
+	server := httptest.NewServer(http.HandlerFunc(h.HandleWS))
+	defer server.Close()
+
+	// The slow client connects but never reads. A tiny receive buffer makes
+	// the server's writes back up sooner.
+	slow := dialWS(t, wsURL(server.URL, "/ws"))
+	defer slow.Close()
+	if tcp, ok := slow.UnderlyingConn().(*net.TCPConn); ok {
+		tcp.SetReadBuffer(4096) //nolint:errcheck
+	}
+
+	fast := dialWS(t, wsURL(server.URL, "/ws"))
+	defer fast.Close()
+
+	time.Sleep(50 * time.Millisecond)
+
+	// Drain the fast client concurrently, remembering the last event seen.
+	last := make(chan string, 1)
+	go func() {
+		for {
+			_, msg, err := fast.ReadMessage()
+			if err != nil {
+				return
+			}
+			if strings.Contains(string(msg), `"event":"last"`) {
+				last <- "last"
+				return
+			}
+		}
+	}()
+
+	// Large payloads fill the slow client's socket buffers quickly. The short
+	// pause between events lets the fast client keep pace.
+	detail := strings.Repeat("x", 32*1024)
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		for i := 0; i < 400; i++ {
+			eventCh <- &events.BabbleEvent{Event: "Bash", Detail: detail}
+			time.Sleep(2 * time.Millisecond)
+		}
+		eventCh <- &events.BabbleEvent{Event: "last"}
+	}()
+
+	select {
+	case <-sent:
+	case <-time.After(10 * time.Second):
+		t.Fatal("hub blocked on a slow client")
+	}
+
+	select {
+	case <-last:
+	case <-time.After(10 * time.Second):
+		t.Fatal("fast client did not receive the final event")
+	}
+
+	if n := h.ClientCount(); n != 1 {
+		t.Errorf("ClientCount() = %d, want 1 after evicting the slow client", n)
+	}
+}
+
+// TestHubDropsUnresponsiveClients verifies that a client which never answers
+// pings is removed once the pong timeout elapses, while a client that keeps
+// reading (and therefore auto-replies to pings) stays connected.
+func TestHubDropsUnresponsiveClients(t *testing.T) {
+	eventCh := make(chan *events.BabbleEvent)
+	h := hub.New(eventCh)
+	h.SetTimeouts(hub.Timeouts{Pong: 300 * time.Millisecond, Ping: 100 * time.Millisecond})
+	go h.Run()
+
+	server := httptest.NewServer(http.HandlerFunc(h.HandleWS))
+	defer server.Close()
+
+	// The gorilla client only answers pings while a read is in progress, so a
+	// connection that never reads behaves like a half-open socket.
+	dead := dialWS(t, wsURL(server.URL, "/ws"))
+	defer dead.Close()
+
+	alive := dialWS(t, wsURL(server.URL, "/ws"))
+	defer alive.Close()
+	go func() {
+		for {
+			if _, _, err := alive.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if n := h.ClientCount(); n != 2 {
+		t.Fatalf("ClientCount() = %d, want 2", n)
+	}
+
+	time.Sleep(time.Second)
+	clients := h.Clients()
+	if len(clients) != 1 {
+		t.Fatalf("len(Clients()) = %d, want 1 after pong timeout", len(clients))
+	}
+	if clients[0].IdleSeconds > 0.3 {
+		t.Errorf("IdleSeconds = %v, want < 0.3 for a client answering pings", clients[0].IdleSeconds)
+	}
+	if clients[0].ConnectedAt.IsZero() {
+		t.Error("ConnectedAt is zero")
+	}
+}
+
+// readEnvelope reads one ProtocolV1 message from conn and decodes its data
+// into data (which may be nil), returning the message type.
+func readEnvelope(t *testing.T, conn *websocket.Conn, data any) string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second)) //nolint:errcheck
+	var env struct {
+		V    int             `json:"v"`
+		Type string          `json:"type"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := conn.ReadJSON(&env); err != nil {
+		t.Fatalf("read envelope: %v", err)
+	}
+	if env.V != hub.ProtocolV1 {
+		t.Errorf("envelope v = %d, want %d", env.V, hub.ProtocolV1)
+	}
+	if data != nil {
+		if err := json.Unmarshal(env.Data, data); err != nil {
+			t.Fatalf("unmarshal %s data: %v (raw: %s)", env.Type, err, env.Data)
+		}
+	}
+	return env.Type
+}
+
+// TestHubSubscriptionFiltersEvents verifies the subscribe control message:
+// after subscribing to errors only, a client receives the acknowledgement and
+// then only error events.
+func TestHubSubscriptionFiltersEvents(t *testing.T) {
+	eventCh := make(chan *events.BabbleEvent, 10)
+	h := hub.New(eventCh)
+	go h.Run()
+
+	server := httptest.NewServer(http.HandlerFunc(h.HandleWS))
+	defer server.Close()
+
+	conn := dialWS(t, wsURL(server.URL, "/ws?v=1"))
+	defer conn.Close()
+
+	sub := map[string]any{"type": "subscribe", "categories": []string{"error"}}
+	if err := conn.WriteJSON(sub); err != nil {
+		t.Fatalf("write subscribe: %v", err)
+	}
+
+	var filter hub.Filter
+	if typ := readEnvelope(t, conn, &filter); typ != hub.TypeSubscribed || len(filter.Categories) != 1 {
+		t.Fatalf("ack = %q %+v, want subscribed with one category", typ, filter)
+	}
+
+	eventCh <- &events.BabbleEvent{Category: events.CategoryRead, Event: "Read"}
+	eventCh <- &events.BabbleEvent{Category: events.CategoryError, Event: "tool_result"}
+
+	var got events.BabbleEvent
+	if typ := readEnvelope(t, conn, &got); typ != hub.TypeEvent {
+		t.Fatalf("message type = %q, want %q", typ, hub.TypeEvent)
+	}
+	if got.Category != events.CategoryError {
+		t.Errorf("category = %q, want %q (read event should be filtered)", got.Category, events.CategoryError)
+	}
+
+	// An invalid glob is rejected without changing the filter. The enveloped
+	// form of subscribe is accepted too.
+	bad := map[string]any{"v": 1, "type": "subscribe", "data": map[string]any{"events": []string{"[oops"}}}
+	if err := conn.WriteJSON(bad); err != nil {
+		t.Fatalf("write bad subscribe: %v", err)
+	}
+	if typ := readEnvelope(t, conn, nil); typ != hub.TypeError {
+		t.Errorf("reply type = %q, want %q", typ, hub.TypeError)
+	}
+}
+
+// TestHubSendsSnapshotFirst verifies that a registered snapshot is the first
+// message a v1 client receives, and that legacy clients never receive it.
+func TestHubSendsSnapshotFirst(t *testing.T) {
+	eventCh := make(chan *events.BabbleEvent, 10)
+	h := hub.New(eventCh)
+	h.SetSnapshot(func() any {
+		return map[string]any{"sessions": []string{"api"}}
+	})
+	go h.Run()
+
+	server := httptest.NewServer(http.HandlerFunc(h.HandleWS))
+	defer server.Close()
+
+	// Negotiate v1 via the subprotocol rather than the query parameter.
+	dialer := websocket.Dialer{Subprotocols: []string{hub.Subprotocol}}
+	conn, resp, err := dialer.Dial(wsURL(server.URL, "/ws"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	if got := resp.Header.Get("Sec-WebSocket-Protocol"); got != hub.Subprotocol {
+		t.Errorf("negotiated subprotocol = %q, want %q", got, hub.Subprotocol)
+	}
+
+	var snap struct {
+		Sessions []string `json:"sessions"`
+	}
+	if typ := readEnvelope(t, conn, &snap); typ != hub.TypeSnapshot || len(snap.Sessions) != 1 {
+		t.Errorf("first message = %q %+v, want snapshot with one session", typ, snap)
+	}
+
+	legacy := dialWS(t, wsURL(server.URL, "/ws"))
+	defer legacy.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	eventCh <- &events.BabbleEvent{Event: "Bash"}
+	legacy.SetReadDeadline(time.Now().Add(2 * time.Second)) //nolint:errcheck
+	var ev events.BabbleEvent
+	if err := legacy.ReadJSON(&ev); err != nil {
+		t.Fatalf("legacy read: %v", err)
+	}
+	if ev.Event != "Bash" {
+		t.Errorf("legacy first message event = %q, want the bare Bash event", ev.Event)
+	}
+}
+
+// TestHubRejectsUnknownProtocolVersion verifies that asking for a protocol
+// version the hub does not speak fails the handshake.
+func TestHubRejectsUnknownProtocolVersion(t *testing.T) {
+	h := hub.New(make(chan *events.BabbleEvent))
+	server := httptest.NewServer(http.HandlerFunc(h.HandleWS))
+	defer server.Close()
+
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL(server.URL, "/ws?v=99"), nil)
+	if err == nil {
+		t.Fatal("dial with v=99 succeeded, want handshake failure")
+	}
+	if resp == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("response = %v, want 400", resp)
+	}
+}
+
+// TestHubClosesClientsWhenInputCloses verifies that closing the event channel
+// flushes queued events, sends each client a "going away" close frame,
+// refuses new connections, and closes Done.
+func TestHubClosesClientsWhenInputCloses(t *testing.T) {
+	eventCh := make(chan *events.BabbleEvent, 10)
+	h := hub.New(eventCh)
+	go h.Run()
+
+	server := httptest.NewServer(http.HandlerFunc(h.HandleWS))
+	defer server.Close()
+
+	conn := dialWS(t, wsURL(server.URL, "/ws"))
+	defer conn.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	eventCh <- &events.BabbleEvent{Session: "last", Event: "Stop"}
+	close(eventCh)
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second)) //nolint:errcheck
+	var got events.BabbleEvent
+	if err := conn.ReadJSON(&got); err != nil {
+		t.Fatalf("read final event: %v", err)
+	}
+	if got.Session != "last" {
+		t.Errorf("session = %q, want last", got.Session)
+	}
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatalf("read after close: got %v, want close 1001", err)
+	}
+
+	select {
+	case <-h.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("Done not closed after all clients were closed")
+	}
+
+	late := dialWS(t, wsURL(server.URL, "/ws"))
+	defer late.Close()
+	late.SetReadDeadline(time.Now().Add(2 * time.Second)) //nolint:errcheck
+	if _, _, err := late.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("late client: got %v, want close 1001", err)
+	}
+	if n := h.ClientCount(); n != 0 {
+		t.Errorf("ClientCount = %d, want 0", n)
+	}
+}
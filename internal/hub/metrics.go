@@ -0,0 +1,40 @@
+package hub
+
+import "github.com/dacort/babble/internal/metrics"
+
+var (
+	clientsGauge     = metrics.Default.Gauge("babble_hub_clients", "Connected WebSocket clients.")
+	subscribersGauge = metrics.Default.Gauge("babble_hub_subscribers", "In-process subscribers, such as Server-Sent Events streams.")
+	connections      = metrics.Default.Counter("babble_hub_connections_total", "WebSocket connections accepted.")
+	upgradeErrors    = metrics.Default.Counter("babble_hub_upgrade_errors_total", "WebSocket upgrades that failed.")
+	evictions        = metrics.Default.Counter("babble_hub_evictions_total", "Clients and subscribers cut off for falling behind.")
+	eventsBroadcast  = metrics.Default.Counter("babble_hub_events_broadcast_total", "Events fanned out to clients.")
+	messagesSent     = metrics.Default.Counter("babble_hub_messages_sent_total", "Messages written to WebSocket clients.")
+	writeErrors      = metrics.Default.Counter("babble_hub_write_errors_total", "Failed writes and pings that dropped a client.")
+)
+
+// Stats counts the work of every Hub in the process.
+type Stats struct {
+	Clients         int64  `json:"clients"`
+	Subscribers     int64  `json:"subscribers"`
+	Connections     uint64 `json:"connections"`
+	UpgradeErrors   uint64 `json:"upgradeErrors"`
+	Evictions       uint64 `json:"evictions"`
+	EventsBroadcast uint64 `json:"eventsBroadcast"`
+	MessagesSent    uint64 `json:"messagesSent"`
+	WriteErrors     uint64 `json:"writeErrors"`
+}
+
+// ReadStats returns the current counts.
+func ReadStats() Stats {
+	return Stats{
+		Clients:         clientsGauge.Value(),
+		Subscribers:     subscribersGauge.Value(),
+		Connections:     connections.Value(),
+		UpgradeErrors:   upgradeErrors.Value(),
+		Evictions:       evictions.Value(),
+		EventsBroadcast: eventsBroadcast.Value(),
+		MessagesSent:    messagesSent.Value(),
+		WriteErrors:     writeErrors.Value(),
+	}
+}
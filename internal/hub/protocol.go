@@ -0,0 +1,110 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/websocket"
+)
+
+// Protocol versions understood by the hub.
+const (
+	// ProtocolLegacy is the original protocol: every message is a bare
+	// BabbleEvent and no other message types are sent. It is used when a
+	// client does not ask for a version, so old pages keep working.
+	ProtocolLegacy = 0
+	// ProtocolV1 wraps every message in an Envelope.
+	ProtocolV1 = 1
+
+	// LatestProtocol is the newest version the hub speaks.
+	LatestProtocol = ProtocolV1
+)
+
+// Subprotocol is the WebSocket subprotocol name that selects ProtocolV1.
+const Subprotocol = "babble.v1"
+
+// Message types carried in an Envelope.
+const (
+	TypeEvent      = "event"
+	TypeSnapshot   = "snapshot"
+	TypeDropped    = "dropped"
+	TypeSubscribed = "subscribed"
+	TypeError      = "error"
+	TypeConfig     = "config"
+	TypePacks      = "packs"
+)
+
+// Envelope is the wire format of every ProtocolV1 message:
+//
+//	{"v":1,"type":"event","data":{...}}
+type Envelope struct {
+	V    int    `json:"v"`
+	Type string `json:"type"`
+	Data any    `json:"data,omitempty"`
+}
+
+// negotiateVersion picks the protocol version for r. The babble.v1
+// subprotocol wins; otherwise the "v" query parameter is used, defaulting to
+// ProtocolLegacy when absent.
+func negotiateVersion(r *http.Request) (int, error) {
+	for _, p := range websocket.Subprotocols(r) {
+		if p == Subprotocol {
+			return ProtocolV1, nil
+		}
+	}
+
+	q := r.URL.Query().Get("v")
+	if q == "" {
+		return ProtocolLegacy, nil
+	}
+	v, err := strconv.Atoi(q)
+	if err != nil || v < ProtocolLegacy || v > LatestProtocol {
+		return 0, fmt.Errorf("unsupported protocol version %q (latest is %d)", q, LatestProtocol)
+	}
+	return v, nil
+}
+
+// encode marshals a message of type typ for a client speaking version. It
+// returns nil, nil when the message has no representation in that version
+// (legacy clients only ever see events).
+func encode(version int, typ string, data any) ([]byte, error) {
+	if version == ProtocolLegacy {
+		if typ != TypeEvent {
+			return nil, nil
+		}
+		return json.Marshal(data)
+	}
+	return json.Marshal(Envelope{V: version, Type: typ, Data: data})
+}
+
+// encoder memoises encode results per version so a broadcast marshals each
+// message at most once per protocol version.
+type encoder struct {
+	typ      string
+	data     any
+	payloads map[int][]byte
+}
+
+// newEncoder returns an encoder for a message of type typ.
+func newEncoder(typ string, data any) *encoder {
+	return &encoder{typ: typ, data: data, payloads: make(map[int][]byte, 2)}
+}
+
+// payload returns the encoded message for version, or nil if it has no
+// representation there or cannot be marshalled.
+func (e *encoder) payload(version int) []byte {
+	if p, ok := e.payloads[version]; ok {
+		return p
+	}
+	p, err := encode(version, e.typ, e.data)
+	if err != nil {
+		// A marshal failure is a programming error and equally fatal for
+		// every client; log once per version and drop the message.
+		log.Printf("hub: marshal %s message: %v", e.typ, err)
+	}
+	e.payloads[version] = p
+	return p
+}
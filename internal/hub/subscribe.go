@@ -0,0 +1,74 @@
+package hub
+
+import (
+	"log"
+
+	"github.com/dacort/babble/internal/events"
+)
+
+// subscriberBufferSize is the number of events queued per in-process
+// subscriber before it is considered too slow and cut off.
+const subscriberBufferSize = 256
+
+// subscriber is an in-process consumer of the event stream, such as the
+// Server-Sent Events handler.
+type subscriber struct {
+	ch     chan *events.BabbleEvent
+	filter Filter
+}
+
+// Subscribe registers an in-process consumer for events matching f. Matching
+// events are delivered on the returned channel. The channel is closed when
+// cancel is called, or early if the consumer falls more than
+// subscriberBufferSize events behind; callers should treat an early close as
+// a disconnect. cancel is safe to call more than once. Once the hub has shut
+// down, the channel is returned already closed.
+func (h *Hub) Subscribe(f Filter) (ch <-chan *events.BabbleEvent, cancel func()) {
+	sub := &subscriber{
+		ch:     make(chan *events.BabbleEvent, subscriberBufferSize),
+		filter: f,
+	}
+
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	subscribersGauge.Inc()
+	if h.closed {
+		h.unsubscribeLocked(sub)
+	}
+	h.mu.Unlock()
+
+	return sub.ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.unsubscribeLocked(sub)
+	}
+}
+
+// publish delivers ev to every in-process subscriber whose filter matches.
+func (h *Hub) publish(ev *events.BabbleEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subs {
+		if !sub.filter.Match(ev) {
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+		default:
+			log.Printf("hub: subscriber too slow — cutting off")
+			evictions.Inc()
+			h.unsubscribeLocked(sub)
+		}
+	}
+}
+
+// unsubscribeLocked removes sub and closes its channel if it is still
+// registered. The caller must hold h.mu.
+func (h *Hub) unsubscribeLocked(sub *subscriber) {
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.ch)
+		subscribersGauge.Dec()
+	}
+}
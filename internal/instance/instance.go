@@ -0,0 +1,95 @@
+// Package instance keeps to one babble server per state directory, using a
+// PID file that is locked for as long as the server runs.
+package instance
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// pidFile is the name of the PID file in the state directory.
+const pidFile = "babble.pid"
+
+// RunningError is returned by Acquire when another server holds the lock.
+type RunningError struct {
+	PID int // 0 if the PID file could not be read
+}
+
+// Error implements error.
+func (e *RunningError) Error() string {
+	if e.PID == 0 {
+		return "babble is already running"
+	}
+	return fmt.Sprintf("babble is already running (pid %d)", e.PID)
+}
+
+// Lock is a held instance lock. Release it when the server exits.
+type Lock struct {
+	f    *os.File
+	path string
+}
+
+// Path returns the location of the PID file in dir.
+func Path(dir string) string {
+	return filepath.Join(dir, pidFile)
+}
+
+// Acquire locks the PID file in dir and records the current process's PID
+// in it. If another process holds the lock, it returns a *RunningError. A
+// PID file left behind by a process that exited without releasing it is
+// taken over.
+func Acquire(dir string) (*Lock, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("instance: mkdir %s: %w", dir, err)
+	}
+	path := Path(dir)
+	f, err := lockFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("instance: truncate %s: %w", path, err)
+	}
+	if _, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("instance: write %s: %w", path, err)
+	}
+	return &Lock{f: f, path: path}, nil
+}
+
+// Release removes the PID file and releases the lock. It is safe to call
+// more than once.
+func (l *Lock) Release() error {
+	if l.f == nil {
+		return nil
+	}
+	// Remove before unlocking, so that a process waiting for the lock never
+	// locks a file that is about to disappear.
+	err := os.Remove(l.path)
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	l.f = nil
+	return err
+}
+
+// Running reports the PID of the server holding the lock in dir, if any. It
+// only reads the PID file, never creating, changing or removing it, so it is
+// safe to call while a server is starting.
+func Running(dir string) (pid int, ok bool) {
+	return probe(Path(dir))
+}
+
+// readPID returns the PID recorded in the file at path, or 0.
+func readPID(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid
+}
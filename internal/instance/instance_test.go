@@ -0,0 +1,85 @@
+package instance_test
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/dacort/babble/internal/instance"
+)
+
+// TestAcquire checks that a second Acquire fails while the lock is held,
+// reporting the holder's PID, and succeeds once it is released.
+func TestAcquire(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := instance.Acquire(dir)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	data, err := os.ReadFile(instance.Path(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(data)); got != strconv.Itoa(os.Getpid()) {
+		t.Errorf("PID file = %q, want %d", got, os.Getpid())
+	}
+
+	_, err = instance.Acquire(dir)
+	var running *instance.RunningError
+	if !errors.As(err, &running) || running.PID != os.Getpid() {
+		t.Fatalf("second Acquire: got %v, want RunningError with pid %d", err, os.Getpid())
+	}
+	if pid, ok := instance.Running(dir); !ok || pid != os.Getpid() {
+		t.Errorf("Running = %d, %v; want %d, true", pid, ok, os.Getpid())
+	}
+
+	if err := l.Release(); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if _, err := os.Stat(instance.Path(dir)); !os.IsNotExist(err) {
+		t.Errorf("PID file still present after Release (err %v)", err)
+	}
+	if _, ok := instance.Running(dir); ok {
+		t.Error("Running reports a server after Release")
+	}
+
+	l, err = instance.Acquire(dir)
+	if err != nil {
+		t.Fatalf("Acquire after Release: %v", err)
+	}
+	l.Release()
+}
+
+// TestAcquireStaleFile checks that a PID file nobody holds is taken over,
+// and that Running neither reports it as a server nor touches it.
+func TestAcquireStaleFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stale PID files are only detected where flock is available")
+	}
+	dir := t.TempDir()
+	if _, ok := instance.Running(dir); ok {
+		t.Error("Running reports a server without a PID file")
+	}
+	if _, err := os.Stat(instance.Path(dir)); !os.IsNotExist(err) {
+		t.Errorf("Running created the PID file (err %v)", err)
+	}
+
+	if err := os.WriteFile(instance.Path(dir), []byte("999999\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := instance.Running(dir); ok {
+		t.Error("Running reports a server for a stale PID file")
+	}
+	if data, err := os.ReadFile(instance.Path(dir)); err != nil || string(data) != "999999\n" {
+		t.Errorf("PID file after Running = %q, %v; want it unchanged", data, err)
+	}
+	l, err := instance.Acquire(dir)
+	if err != nil {
+		t.Fatalf("Acquire over stale file: %v", err)
+	}
+	l.Release()
+}
@@ -0,0 +1,32 @@
+//go:build !unix
+
+package instance
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// lockFile creates path exclusively. Without flock, a PID file left by a
+// server that crashed must be removed by hand; its presence is reported as a
+// running server.
+func lockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return nil, &RunningError{PID: readPID(path)}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("instance: create %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// probe reports whether the PID file at path exists, which is all that can
+// be told without flock.
+func probe(path string) (pid int, ok bool) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, false
+	}
+	return readPID(path), true
+}
@@ -0,0 +1,54 @@
+//go:build unix
+
+package instance
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lockFile opens path and takes an exclusive flock on it. The kernel drops
+// the lock when the process exits, however it exits, so a stale PID file
+// never blocks a new server.
+func lockFile(path string) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("instance: open %s: %w", path, err)
+		}
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			f.Close()
+			if errors.Is(err, syscall.EWOULDBLOCK) {
+				return nil, &RunningError{PID: readPID(path)}
+			}
+			return nil, fmt.Errorf("instance: lock %s: %w", path, err)
+		}
+
+		// The previous holder may have removed the file between our open
+		// and our lock, leaving us holding a lock on a file nobody else can
+		// see. Start over if so.
+		opened, err1 := f.Stat()
+		current, err2 := os.Stat(path)
+		if err1 == nil && err2 == nil && os.SameFile(opened, current) {
+			return f, nil
+		}
+		f.Close()
+	}
+}
+
+// probe reports whether some process holds the lock on path by briefly
+// taking a shared lock, which fails while a server holds its exclusive one.
+func probe(path string) (pid int, ok bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_SH|syscall.LOCK_NB); err != nil {
+		return readPID(path), errors.Is(err, syscall.EWOULDBLOCK)
+	}
+	syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	return 0, false
+}
@@ -0,0 +1,404 @@
+// Package jsonpatch applies JSON Merge Patch (RFC 7396) and JSON Patch
+// (RFC 6902) documents to raw JSON.
+//
+// Both operate on the generic decoded form of a document (maps, slices and
+// json.Number), so they work for any JSON value and never lose numeric
+// precision.
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrTestFailed is returned (wrapped) by Apply when a "test" operation does
+// not match the document.
+var ErrTestFailed = errors.New("jsonpatch: test failed")
+
+// MergePatch applies an RFC 7396 merge patch to doc and returns the result.
+// Objects in patch are merged into doc recursively; a null member removes
+// that member from doc; any other value replaces the corresponding value
+// outright (arrays are replaced, never merged).
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, fmt.Errorf("jsonpatch: document: %w", err)
+	}
+	p, err := decode(patch)
+	if err != nil {
+		return nil, fmt.Errorf("jsonpatch: merge patch: %w", err)
+	}
+	return json.Marshal(merge(target, p))
+}
+
+// merge implements the MergePatch algorithm from RFC 7396 section 2.
+func merge(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = merge(t[k], v)
+		}
+	}
+	return t
+}
+
+// Operation is a single RFC 6902 operation.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Apply applies an RFC 6902 JSON Patch (a JSON array of operations) to doc
+// and returns the result. Operations are applied in order and the patch is
+// all-or-nothing: if any operation fails, doc is left untouched and an error
+// naming the failing operation is returned. A failed "test" operation wraps
+// ErrTestFailed.
+func Apply(doc, patch []byte) ([]byte, error) {
+	var ops []Operation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, fmt.Errorf("jsonpatch: patch: %w", err)
+	}
+	root, err := decode(doc)
+	if err != nil {
+		return nil, fmt.Errorf("jsonpatch: document: %w", err)
+	}
+
+	for i, op := range ops {
+		root, err = applyOp(root, op)
+		if err != nil {
+			return nil, fmt.Errorf("jsonpatch: operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return json.Marshal(root)
+}
+
+// applyOp applies a single operation to root and returns the new root.
+func applyOp(root any, op Operation) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if len(op.Value) == 0 {
+			return nil, errors.New(`missing "value"`)
+		}
+		value, err := decode(op.Value)
+		if err != nil {
+			return nil, fmt.Errorf("value: %w", err)
+		}
+		switch op.Op {
+		case "add":
+			return add(root, path, value)
+		case "replace":
+			return replace(root, path, value)
+		default:
+			got, err := get(root, path)
+			if err != nil {
+				return nil, err
+			}
+			if !equal(got, value) {
+				return nil, ErrTestFailed
+			}
+			return root, nil
+		}
+
+	case "remove":
+		root, _, err := remove(root, path)
+		return root, err
+
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, fmt.Errorf("from: %w", err)
+		}
+		if op.Op == "copy" {
+			value, err := get(root, from)
+			if err != nil {
+				return nil, fmt.Errorf("from: %w", err)
+			}
+			return add(root, path, deepCopy(value))
+		}
+		if isProperPrefix(from, path) {
+			return nil, errors.New("cannot move a value into one of its own children")
+		}
+		root, value, err := remove(root, from)
+		if err != nil {
+			return nil, fmt.Errorf("from: %w", err)
+		}
+		return add(root, path, value)
+
+	default:
+		return nil, fmt.Errorf("unknown op %q", op.Op)
+	}
+}
+
+// add implements the "add" operation: it sets an object member, inserts
+// into an array (appending for "-"), or replaces the whole document.
+func add(root any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return update(root, path, func(container any, key string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			c[key] = value
+			return c, nil
+		case []any:
+			i := len(c)
+			if key != "-" {
+				var err error
+				if i, err = index(key, len(c)+1); err != nil {
+					return nil, err
+				}
+			}
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = value
+			return c, nil
+		default:
+			return nil, fmt.Errorf("cannot add %q to a non-container", key)
+		}
+	})
+}
+
+// replace implements the "replace" operation: the target must exist.
+func replace(root any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return update(root, path, func(container any, key string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			if _, ok := c[key]; !ok {
+				return nil, fmt.Errorf("member %q does not exist", key)
+			}
+			c[key] = value
+			return c, nil
+		case []any:
+			i, err := index(key, len(c))
+			if err != nil {
+				return nil, err
+			}
+			c[i] = value
+			return c, nil
+		default:
+			return nil, fmt.Errorf("cannot replace %q in a non-container", key)
+		}
+	})
+}
+
+// remove implements the "remove" operation and returns the removed value.
+func remove(root any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("cannot remove the whole document")
+	}
+	var removed any
+	root, err := update(root, path, func(container any, key string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			v, ok := c[key]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", key)
+			}
+			removed = v
+			delete(c, key)
+			return c, nil
+		case []any:
+			i, err := index(key, len(c))
+			if err != nil {
+				return nil, err
+			}
+			removed = c[i]
+			return append(c[:i], c[i+1:]...), nil
+		default:
+			return nil, fmt.Errorf("cannot remove %q from a non-container", key)
+		}
+	})
+	return root, removed, err
+}
+
+// update walks path from node to the container holding its last token, calls
+// fn with that container and token, and stores the (possibly reallocated)
+// container back into its parent. It returns the new node.
+func update(node any, path []string, fn func(container any, key string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return fn(node, path[0])
+	}
+	child, err := get(node, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = update(child, path[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+	switch c := node.(type) {
+	case map[string]any:
+		c[path[0]] = child
+	case []any:
+		i, _ := index(path[0], len(c)) // validated by get above
+		c[i] = child
+	}
+	return node, nil
+}
+
+// get returns the value at path within node.
+func get(node any, path []string) (any, error) {
+	for _, key := range path {
+		switch c := node.(type) {
+		case map[string]any:
+			v, ok := c[key]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", key)
+			}
+			node = v
+		case []any:
+			i, err := index(key, len(c))
+			if err != nil {
+				return nil, err
+			}
+			node = c[i]
+		default:
+			return nil, fmt.Errorf("cannot index %q into a non-container", key)
+		}
+	}
+	return node, nil
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into unescaped reference
+// tokens. The empty pointer refers to the whole document.
+func parsePointer(ptr string) ([]string, error) {
+	if ptr == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(ptr, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", ptr)
+	}
+	tokens := strings.Split(ptr[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return tokens, nil
+}
+
+// index parses an array index token, which must be less than limit.
+func index(token string, limit int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if i >= limit {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+	return i, nil
+}
+
+// isProperPrefix reports whether prefix is a strict ancestor of path.
+func isProperPrefix(prefix, path []string) bool {
+	if len(prefix) >= len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// equal reports whether two decoded JSON values are equal. Numbers compare
+// by value, so 1 and 1.0 are equal.
+func equal(a, b any) bool {
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, v := range av {
+			w, ok := bv[k]
+			if !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !equal(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		bv, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if av == bv {
+			return true
+		}
+		af, err1 := av.Float64()
+		bf, err2 := bv.Float64()
+		return err1 == nil && err2 == nil && af == bf
+	default:
+		return a == b
+	}
+}
+
+// deepCopy returns a copy of v sharing no maps or slices with it.
+func deepCopy(v any) any {
+	switch c := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(c))
+		for k, v := range c {
+			out[k] = deepCopy(v)
+		}
+		return out
+	case []any:
+		out := make([]any, len(c))
+		for i, v := range c {
+			out[i] = deepCopy(v)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// decode parses a single JSON value, keeping numbers as json.Number.
+func decode(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after JSON value")
+	}
+	return v, nil
+}
@@ -0,0 +1,260 @@
+// Package metrics provides the counters and gauges babble's components update
+// as they work, and writes them in the Prometheus text exposition format.
+//
+// Components register their metrics with Default when their package is
+// initialised, so that one scrape of GET /metrics covers the whole process.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Default is the registry written by GET /metrics.
+var Default = NewRegistry()
+
+// Counter is a count that only goes up, such as lines read.
+type Counter struct {
+	v atomic.Uint64
+}
+
+// Inc adds one to c.
+func (c *Counter) Inc() { c.v.Add(1) }
+
+// Add adds n to c.
+func (c *Counter) Add(n uint64) { c.v.Add(n) }
+
+// Value returns c's current count.
+func (c *Counter) Value() uint64 { return c.v.Load() }
+
+// Gauge is a value that goes up and down, such as connected clients.
+type Gauge struct {
+	v atomic.Int64
+}
+
+// Set sets g to n.
+func (g *Gauge) Set(n int64) { g.v.Store(n) }
+
+// Inc adds one to g.
+func (g *Gauge) Inc() { g.v.Add(1) }
+
+// Dec subtracts one from g.
+func (g *Gauge) Dec() { g.v.Add(-1) }
+
+// Value returns g's current value.
+func (g *Gauge) Value() int64 { return g.v.Load() }
+
+// CounterVec is a family of counters told apart by label values, such as
+// events per category.
+type CounterVec struct {
+	labels []string
+
+	mu       sync.Mutex
+	counters map[string]*Counter // joined label values → counter
+}
+
+// labelSep joins label values into a map key. It cannot appear in UTF-8 text.
+const labelSep = "\xff"
+
+// With returns the counter for the given label values, one per label, creating
+// it at zero if needed.
+func (v *CounterVec) With(values ...string) *Counter {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: got %d label values, want %d", len(values), len(v.labels)))
+	}
+	key := strings.Join(values, labelSep)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c, ok := v.counters[key]
+	if !ok {
+		c = &Counter{}
+		v.counters[key] = c
+	}
+	return c
+}
+
+// Values returns each counter's value by its joined label values. For a
+// single-label family the keys are simply the label values.
+func (v *CounterVec) Values() map[string]uint64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	m := make(map[string]uint64, len(v.counters))
+	for key, c := range v.counters {
+		m[strings.ReplaceAll(key, labelSep, ",")] = c.Value()
+	}
+	return m
+}
+
+// kind is a metric family's Prometheus type.
+type kind string
+
+const (
+	kindCounter kind = "counter"
+	kindGauge   kind = "gauge"
+)
+
+// family is one registered metric name with its help text and a function that
+// reports its samples.
+type family struct {
+	name    string
+	help    string
+	kind    kind
+	samples func() []sample
+}
+
+// sample is one line of output: a value and its label pairs, if any.
+type sample struct {
+	labels []string // alternating names and values
+	value  float64
+}
+
+// Registry is a set of metric families. It is safe for concurrent use.
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Counter registers and returns a new counter.
+func (r *Registry) Counter(name, help string) *Counter {
+	c := &Counter{}
+	r.register(name, help, kindCounter, func() []sample {
+		return []sample{{value: float64(c.Value())}}
+	})
+	return c
+}
+
+// Gauge registers and returns a new gauge.
+func (r *Registry) Gauge(name, help string) *Gauge {
+	g := &Gauge{}
+	r.register(name, help, kindGauge, func() []sample {
+		return []sample{{value: float64(g.Value())}}
+	})
+	return g
+}
+
+// CounterVec registers and returns a new family of counters labelled by
+// labels.
+func (r *Registry) CounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{labels: labels, counters: make(map[string]*Counter)}
+	r.register(name, help, kindCounter, func() []sample {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		keys := make([]string, 0, len(v.counters))
+		for key := range v.counters {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		out := make([]sample, 0, len(keys))
+		for _, key := range keys {
+			values := strings.Split(key, labelSep)
+			pairs := make([]string, 0, 2*len(labels))
+			for i, l := range labels {
+				pairs = append(pairs, l, values[i])
+			}
+			out = append(out, sample{labels: pairs, value: float64(v.counters[key].Value())})
+		}
+		return out
+	})
+	return v
+}
+
+// CounterFunc registers a counter whose value is read from fn at each scrape,
+// for counts kept elsewhere.
+func (r *Registry) CounterFunc(name, help string, fn func() float64) {
+	r.register(name, help, kindCounter, func() []sample {
+		return []sample{{value: fn()}}
+	})
+}
+
+// GaugeFunc registers a gauge whose value is read from fn at each scrape.
+// Extra label name/value pairs may follow, e.g. for an info metric.
+func (r *Registry) GaugeFunc(name, help string, fn func() float64, labels ...string) {
+	r.register(name, help, kindGauge, func() []sample {
+		return []sample{{labels: labels, value: fn()}}
+	})
+}
+
+// register adds a family, panicking if name is already taken: metric names
+// are fixed in code, so a clash is a programming error.
+func (r *Registry) register(name, help string, k kind, samples func() []sample) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, f := range r.families {
+		if f.name == name {
+			panic("metrics: duplicate metric " + name)
+		}
+	}
+	r.families = append(r.families, &family{name: name, help: help, kind: k, samples: samples})
+}
+
+// ContentType is the media type of the output of WriteText.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// WriteText writes every family in the Prometheus text exposition format,
+// ordered by name.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	families := slices.Clone(r.families)
+	r.mu.Unlock()
+	slices.SortFunc(families, func(a, b *family) int { return strings.Compare(a.name, b.name) })
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		fmt.Fprintf(bw, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.name, f.kind)
+		for _, s := range f.samples() {
+			bw.WriteString(f.name)
+			if len(s.labels) > 0 {
+				bw.WriteByte('{')
+				for i := 0; i+1 < len(s.labels); i += 2 {
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+					fmt.Fprintf(bw, "%s=\"%s\"", s.labels[i], escapeLabel(s.labels[i+1]))
+				}
+				bw.WriteByte('}')
+			}
+			bw.WriteByte(' ')
+			bw.WriteString(formatValue(s.value))
+			bw.WriteByte('\n')
+		}
+	}
+	return bw.Flush()
+}
+
+// formatValue formats v as Prometheus expects, including its spellings of
+// infinity and NaN.
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// escapeHelp escapes a help string.
+func escapeHelp(s string) string { return helpEscaper.Replace(s) }
+
+// escapeLabel escapes a label value.
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
@@ -0,0 +1,67 @@
+package metrics_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dacort/babble/internal/metrics"
+)
+
+// TestWriteText checks the exposition format for each kind of metric.
+func TestWriteText(t *testing.T) {
+	r := metrics.NewRegistry()
+	lines := r.Counter("test_lines_total", "Lines read.")
+	clients := r.Gauge("test_clients", "Connected clients.")
+	byCat := r.CounterVec("test_events_total", "Events by category.", "category")
+	r.GaugeFunc("test_build_info", "Build information.", func() float64 { return 1 }, "version", `v1 "beta"`)
+	r.CounterFunc("test_dropped_total", "Dropped events,\nsummed.", func() float64 { return 7 })
+
+	lines.Add(41)
+	lines.Inc()
+	clients.Inc()
+	clients.Inc()
+	clients.Dec()
+	byCat.With("write").Inc()
+	byCat.With("read").Add(3)
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatalf("WriteText: %v", err)
+	}
+	want := `# HELP test_build_info Build information.
+# TYPE test_build_info gauge
+test_build_info{version="v1 \"beta\""} 1
+# HELP test_clients Connected clients.
+# TYPE test_clients gauge
+test_clients 1
+# HELP test_dropped_total Dropped events,\nsummed.
+# TYPE test_dropped_total counter
+test_dropped_total 7
+# HELP test_events_total Events by category.
+# TYPE test_events_total counter
+test_events_total{category="read"} 3
+test_events_total{category="write"} 1
+# HELP test_lines_total Lines read.
+# TYPE test_lines_total counter
+test_lines_total 42
+`
+	if got := b.String(); got != want {
+		t.Errorf("WriteText:\n%s\nwant:\n%s", got, want)
+	}
+
+	if got := byCat.Values(); got["read"] != 3 || got["write"] != 1 || len(got) != 2 {
+		t.Errorf("Values = %v, want read:3 write:1", got)
+	}
+}
+
+// TestDuplicateName checks that registering a name twice panics.
+func TestDuplicateName(t *testing.T) {
+	r := metrics.NewRegistry()
+	r.Counter("test_total", "")
+	defer func() {
+		if recover() == nil {
+			t.Error("registering test_total twice did not panic")
+		}
+	}()
+	r.Gauge("test_total", "")
+}
@@ -0,0 +1,206 @@
+// Package naming gives each Claude session a display name that no other live
+// session shares. By default a session is named after the last component of
+// its working directory, so ~/work/api and ~/oss/api would both be "api";
+// one that starts while the other is live is given a longer path suffix
+// instead. The session that was there first keeps "api" rather than becoming
+// "work/api", so the pair is shown as "api" and "oss/api".
+package naming
+
+import (
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dacort/babble/internal/events"
+	"github.com/dacort/babble/internal/gitinfo"
+	"github.com/dacort/babble/internal/registry"
+)
+
+// idPrefixLen is how much of a session ID the last-resort name includes.
+const idPrefixLen = 8
+
+// Namer assigns session names. It is safe for concurrent use.
+type Namer struct {
+	home string
+	git  func(dir string) (gitinfo.Info, bool)
+	now  func() time.Time
+
+	mu       sync.Mutex
+	aliases  map[string]string // cleaned cwd → name
+	sessions map[string]*session
+}
+
+// session is what a Namer remembers of one session.
+type session struct {
+	cwd      string
+	name     string // "" until named; unused while cwd has an alias
+	lastSeen time.Time
+}
+
+// New returns a Namer that names sessions whose working directory is a key of
+// aliases with the corresponding value. Keys may start with ~ for home, which
+// also stands for home in the path suffixes used to tell sessions apart. git
+// finds a directory's repository and branch; nil means gitinfo.Lookup.
+func New(home string, aliases map[string]string, git func(dir string) (gitinfo.Info, bool)) *Namer {
+	if git == nil {
+		git = gitinfo.Lookup
+	}
+	n := &Namer{
+		home:     home,
+		git:      git,
+		now:      time.Now,
+		sessions: make(map[string]*session),
+	}
+	n.SetAliases(aliases)
+	return n
+}
+
+// SetAliases replaces the aliases given to New.
+func (n *Namer) SetAliases(aliases map[string]string) {
+	m := make(map[string]string, len(aliases))
+	for dir, name := range aliases {
+		m[n.clean(dir)] = name
+	}
+	n.mu.Lock()
+	n.aliases = m
+	n.mu.Unlock()
+}
+
+// Name records that session id, working in cwd, is active and returns its
+// display name. An empty cwd keeps the directory last given for id. Name
+// returns "" if it knows no directory for the session.
+//
+// A session in a directory with an alias is named by the alias. Otherwise it
+// is given a name the first time Name knows its directory, and keeps it until
+// it ends (is not seen within registry.EndedAfter), so that clients which
+// key sessions by name see a session under one name throughout. In order of
+// preference that name is:
+//
+//   - the last component of cwd, unless another live session is already
+//     called that;
+//   - the shortest suffix of cwd ("work/api") that no live session is called
+//     and that is not the same suffix of another live session's directory
+//     with the same last component;
+//   - the repository name and branch, if cwd is in a git working tree and no
+//     such session is called or shares them too ("api@main");
+//   - the last component followed by the start of the session ID
+//     ("api#3f2c9a1e").
+//
+// So when a namesake starts, only the newcomer gets the longer name: the
+// pair above is "api" and "oss/api", not "work/api" and "oss/api". Clients
+// key a session's state, including whether it is muted, by its name, so
+// renaming a running session would show it twice and unmute it.
+func (n *Namer) Name(id, cwd string) string {
+	now := n.now()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	s, ok := n.sessions[id]
+	if !ok {
+		s = &session{}
+		n.sessions[id] = s
+	}
+	if cwd != "" {
+		s.cwd = n.clean(cwd)
+	}
+	s.lastSeen = now
+	for otherID, other := range n.sessions {
+		if now.Sub(other.lastSeen) >= registry.EndedAfter {
+			delete(n.sessions, otherID)
+		}
+	}
+	if s.cwd == "" {
+		return ""
+	}
+	if alias, ok := n.aliases[s.cwd]; ok {
+		return alias
+	}
+	if s.name == "" {
+		s.name = n.newName(id, s)
+	}
+	return s.name
+}
+
+// newName chooses the name for session id, s, which has none yet. It must be
+// called with n.mu held.
+func (n *Namer) newName(id string, s *session) string {
+	base := events.SessionNameFromCwd(s.cwd)
+	taken := make(map[string]bool)
+	var rivals []*session
+	for _, other := range n.sessions {
+		if other == s || other.cwd == "" {
+			continue
+		}
+		if alias, aliased := n.aliases[other.cwd]; aliased {
+			taken[alias] = true
+			continue
+		}
+		if other.name != "" {
+			taken[other.name] = true
+		}
+		if events.SessionNameFromCwd(other.cwd) == base {
+			rivals = append(rivals, other)
+		}
+	}
+	if !taken[base] {
+		return base
+	}
+
+	parts := n.components(s.cwd)
+	for k := 2; k <= len(parts); k++ {
+		name := strings.Join(parts[len(parts)-k:], "/")
+		if !taken[name] && !shared(rivals, name, func(r *session) string { return suffix(n.components(r.cwd), k) }) {
+			return name
+		}
+	}
+	if name := n.gitName(s.cwd); name != "" && !taken[name] && !shared(rivals, name, func(r *session) string { return n.gitName(r.cwd) }) {
+		return name
+	}
+	return base + "#" + id[:min(len(id), idPrefixLen)]
+}
+
+// clean returns dir as an absolute, slash-separated path with ~ expanded.
+func (n *Namer) clean(dir string) string {
+	if n.home != "" && (dir == "~" || strings.HasPrefix(dir, "~/")) {
+		dir = n.home + dir[1:]
+	}
+	return path.Clean(dir)
+}
+
+// components splits cwd into its path components, with the home directory
+// standing as a single "~".
+func (n *Namer) components(cwd string) []string {
+	if n.home != "" && n.home != "/" {
+		if rest, ok := strings.CutPrefix(cwd, n.home); ok && (rest == "" || rest[0] == '/') {
+			cwd = "~" + rest
+		}
+	}
+	return strings.FieldsFunc(cwd, func(r rune) bool { return r == '/' })
+}
+
+// suffix joins the last k of parts, or all of them if there are fewer.
+func suffix(parts []string, k int) string {
+	return strings.Join(parts[max(len(parts)-k, 0):], "/")
+}
+
+// gitName returns "repo@branch" for the git working tree containing cwd, or
+// "" if there is none or HEAD is detached.
+func (n *Namer) gitName(cwd string) string {
+	info, ok := n.git(cwd)
+	if !ok || info.Branch == "" {
+		return ""
+	}
+	return info.Repo + "@" + info.Branch
+}
+
+// shared reports whether nameOf gives name for any of rivals.
+func shared(rivals []*session, name string, nameOf func(*session) string) bool {
+	for _, r := range rivals {
+		if nameOf(r) == name {
+			return true
+		}
+	}
+	return false
+}
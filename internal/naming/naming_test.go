@@ -0,0 +1,98 @@
+package naming_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dacort/babble/internal/naming"
+)
+
+// TestSuffixes checks that sessions in directories with the same name are
+// told apart by the shortest differing suffix, with home shown as ~, and that
+// only the newcomer's name changes.
+func TestSuffixes(t *testing.T) {
+	n := naming.New("/home/u", nil, nil)
+	if got := n.Name("a", "/home/u/work/api"); got != "api" {
+		t.Errorf("lone session = %q, want api", got)
+	}
+	if got := n.Name("b", "/home/u/oss/api/"); got != "oss/api" {
+		t.Errorf("second api = %q, want oss/api", got)
+	}
+	if got := n.Name("a", ""); got != "api" {
+		t.Errorf("first api, once it has a namesake = %q, want api", got)
+	}
+	if got := n.Name("c", "/home/u/api"); got != "~/api" {
+		t.Errorf("api in home = %q, want ~/api", got)
+	}
+	if got := n.Name("d", "/srv/web"); got != "web" {
+		t.Errorf("unrelated session = %q, want web", got)
+	}
+	if got := n.Name("e", ""); got != "" {
+		t.Errorf("session without a directory = %q, want empty", got)
+	}
+}
+
+// TestFirstKeepsName pins that a session keeps its bare name when a
+// namesake starts, rather than both taking their suffixes, and that neither
+// name changes afterwards.
+func TestFirstKeepsName(t *testing.T) {
+	n := naming.New("/home/u", nil, nil)
+	n.Name("a", "/home/u/work/api")
+	n.Name("b", "/home/u/oss/api")
+	for range 3 {
+		if a, b := n.Name("a", ""), n.Name("b", ""); a != "api" || b != "oss/api" {
+			t.Fatalf("names = %q, %q; want api, oss/api", a, b)
+		}
+	}
+	// A third namesake does not disturb either.
+	if got := n.Name("c", "/home/u/x/api"); got != "x/api" {
+		t.Errorf("third api = %q, want x/api", got)
+	}
+	if a, b := n.Name("a", ""), n.Name("b", ""); a != "api" || b != "oss/api" {
+		t.Errorf("after a third namesake = %q, %q; want api, oss/api", a, b)
+	}
+}
+
+// TestAliases checks that aliases win and take the session out of the
+// running for disambiguation, and that they can be replaced.
+func TestAliases(t *testing.T) {
+	n := naming.New("/home/u", map[string]string{"~/work/api": "work-api"}, nil)
+	if got := n.Name("a", "/home/u/work/api"); got != "work-api" {
+		t.Errorf("aliased = %q, want work-api", got)
+	}
+	if got := n.Name("b", "/home/u/oss/api"); got != "api" {
+		t.Errorf("namesake of an aliased session = %q, want api", got)
+	}
+
+	n.SetAliases(nil)
+	if got := n.Name("a", ""); got != "work/api" {
+		t.Errorf("after removing the alias = %q, want work/api", got)
+	}
+}
+
+// TestFallbacks checks the git and session ID fallbacks for sessions whose
+// paths cannot tell them apart.
+func TestFallbacks(t *testing.T) {
+	home := filepath.Join(t.TempDir(), "api")
+	if err := os.MkdirAll(filepath.Join(home, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".git", "HEAD"), []byte("ref: refs/heads/main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Working in home itself, there is no longer suffix than "~".
+	n := naming.New(home, nil, nil)
+	n.Name("other", "/srv/api")
+	if got := n.Name("a", home); got != "api@main" {
+		t.Errorf("session in a repository = %q, want api@main", got)
+	}
+
+	// Two sessions in one directory differ only by ID.
+	n = naming.New("", nil, nil)
+	n.Name("3f2c9a1e-aaaa", "/srv/api")
+	if got := n.Name("77d0b6c2-bbbb", "/srv/api"); got != "api#77d0b6c2" {
+		t.Errorf("session sharing a directory = %q, want api#77d0b6c2", got)
+	}
+}
@@ -0,0 +1,169 @@
+// Package queue provides a bounded event buffer with a configurable policy for
+// what happens when producers outpace the consumer.
+package queue
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dacort/babble/internal/events"
+)
+
+// Policy selects the behaviour of Push when the queue is full.
+type Policy string
+
+const (
+	// PolicyBlock makes Push wait until the consumer frees a slot. No events
+	// are lost, but a slow consumer stalls every producer.
+	PolicyBlock Policy = "block"
+	// PolicyDropOldest discards the oldest queued event to make room.
+	PolicyDropOldest Policy = "drop-oldest"
+	// PolicyDropNewest discards the event being pushed.
+	PolicyDropNewest Policy = "drop-newest"
+	// PolicyCoalesce replaces the most recently queued event of the same
+	// category with the new one, falling back to drop-oldest when no event of
+	// that category is queued.
+	PolicyCoalesce Policy = "coalesce"
+)
+
+// DefaultSize is the buffer capacity used when a non-positive size is given.
+const DefaultSize = 100
+
+// ParsePolicy converts s into a Policy. An empty string selects
+// PolicyDropOldest.
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(s); p {
+	case "":
+		return PolicyDropOldest, nil
+	case PolicyBlock, PolicyDropOldest, PolicyDropNewest, PolicyCoalesce:
+		return p, nil
+	default:
+		return "", fmt.Errorf("queue: unknown drop policy %q", s)
+	}
+}
+
+// Queue is a bounded FIFO of BabbleEvents. It is safe for concurrent use by
+// multiple producers and a single consumer.
+type Queue struct {
+	size   int
+	policy Policy
+
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	buf      []*events.BabbleEvent
+	closed   bool
+
+	dropped atomic.Uint64
+}
+
+// New creates a Queue holding at most size events, applying policy when full.
+func New(size int, policy Policy) *Queue {
+	if size <= 0 {
+		size = DefaultSize
+	}
+	q := &Queue{
+		size:   size,
+		policy: policy,
+		buf:    make([]*events.BabbleEvent, 0, size),
+	}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	return q
+}
+
+// Push appends ev to the queue. It reports whether ev was accepted; false
+// means ev itself was dropped (drop-newest) or the queue is closed. Under
+// PolicyBlock, Push waits for space.
+func (q *Queue) Push(ev *events.BabbleEvent) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.policy == PolicyBlock {
+		for len(q.buf) >= q.size && !q.closed {
+			q.notFull.Wait()
+		}
+	}
+	if q.closed {
+		return false
+	}
+
+	if len(q.buf) >= q.size {
+		switch q.policy {
+		case PolicyDropNewest:
+			q.dropped.Add(1)
+			return false
+		case PolicyCoalesce:
+			if i := q.lastIndexOf(ev.Category); i >= 0 {
+				q.buf = append(q.buf[:i], q.buf[i+1:]...)
+			} else {
+				q.buf = q.buf[1:]
+			}
+		default: // PolicyDropOldest
+			q.buf = q.buf[1:]
+		}
+		q.dropped.Add(1)
+	}
+
+	q.buf = append(q.buf, ev)
+	q.notEmpty.Signal()
+	return true
+}
+
+// Pop removes and returns the oldest event, waiting until one is available.
+// It returns false once the queue has been closed and fully drained.
+func (q *Queue) Pop() (*events.BabbleEvent, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.buf) == 0 && !q.closed {
+		q.notEmpty.Wait()
+	}
+	if len(q.buf) == 0 {
+		return nil, false
+	}
+
+	ev := q.buf[0]
+	q.buf[0] = nil
+	q.buf = q.buf[1:]
+	q.notFull.Signal()
+	return ev, true
+}
+
+// Close marks the queue as closed. Pending events remain available to Pop;
+// subsequent Pushes are rejected and blocked producers are released.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
+
+// Len returns the number of events currently queued.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.buf)
+}
+
+// Size returns the queue's capacity.
+func (q *Queue) Size() int { return q.size }
+
+// Policy returns the queue's drop policy.
+func (q *Queue) Policy() Policy { return q.policy }
+
+// Dropped returns the total number of events discarded since creation.
+func (q *Queue) Dropped() uint64 { return q.dropped.Load() }
+
+// lastIndexOf returns the index of the newest queued event in category c, or
+// -1 if there is none. The caller must hold q.mu.
+func (q *Queue) lastIndexOf(c events.Category) int {
+	for i := len(q.buf) - 1; i >= 0; i-- {
+		if q.buf[i].Category == c {
+			return i
+		}
+	}
+	return -1
+}
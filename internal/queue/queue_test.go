@@ -0,0 +1,169 @@
+package queue_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dacort/babble/internal/events"
+	"github.com/dacort/babble/internal/queue"
+)
+
+// ev returns a minimal BabbleEvent with the given category and event name.
+func ev(cat events.Category, name string) *events.BabbleEvent {
+	return &events.BabbleEvent{Category: cat, Event: name}
+}
+
+// drain pops every queued event without blocking by closing the queue first.
+func drain(q *queue.Queue) []string {
+	q.Close()
+	var names []string
+	for {
+		e, ok := q.Pop()
+		if !ok {
+			return names
+		}
+		names = append(names, e.Event)
+	}
+}
+
+// equal reports whether two string slices have identical contents.
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    queue.Policy
+		wantErr bool
+	}{
+		{"", queue.PolicyDropOldest, false},
+		{"block", queue.PolicyBlock, false},
+		{"drop-oldest", queue.PolicyDropOldest, false},
+		{"drop-newest", queue.PolicyDropNewest, false},
+		{"coalesce", queue.PolicyCoalesce, false},
+		{"yolo", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := queue.ParsePolicy(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueueDropPolicies(t *testing.T) {
+	tests := []struct {
+		policy      queue.Policy
+		want        []string
+		wantDropped uint64
+	}{
+		{queue.PolicyDropOldest, []string{"b", "c", "d"}, 1},
+		{queue.PolicyDropNewest, []string{"a", "b", "c"}, 1},
+		// "d" is a read event, so it replaces "b" (the newest queued read).
+		{queue.PolicyCoalesce, []string{"a", "c", "d"}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			q := queue.New(3, tt.policy)
+			q.Push(ev(events.CategoryRead, "a"))
+			q.Push(ev(events.CategoryRead, "b"))
+			q.Push(ev(events.CategoryWrite, "c"))
+			q.Push(ev(events.CategoryRead, "d"))
+
+			if got := q.Dropped(); got != tt.wantDropped {
+				t.Errorf("Dropped() = %d, want %d", got, tt.wantDropped)
+			}
+			if got := drain(q); !equal(got, tt.want) {
+				t.Errorf("queued = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestQueueCoalesceFallsBackToOldest verifies that coalescing drops the oldest
+// event when no queued event shares the new event's category.
+func TestQueueCoalesceFallsBackToOldest(t *testing.T) {
+	q := queue.New(2, queue.PolicyCoalesce)
+	q.Push(ev(events.CategoryRead, "a"))
+	q.Push(ev(events.CategoryWrite, "b"))
+	q.Push(ev(events.CategoryError, "c"))
+
+	if got, want := drain(q), []string{"b", "c"}; !equal(got, want) {
+		t.Errorf("queued = %v, want %v", got, want)
+	}
+}
+
+// TestQueueBlockWaitsForSpace verifies that PolicyBlock holds the producer
+// until the consumer pops an event, and never drops.
+func TestQueueBlockWaitsForSpace(t *testing.T) {
+	q := queue.New(1, queue.PolicyBlock)
+	q.Push(ev(events.CategoryRead, "a"))
+
+	pushed := make(chan struct{})
+	go func() {
+		q.Push(ev(events.CategoryRead, "b"))
+		close(pushed)
+	}()
+
+	select {
+	case <-pushed:
+		t.Fatal("Push returned while the queue was full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if e, _ := q.Pop(); e.Event != "a" {
+		t.Errorf("Pop() = %q, want %q", e.Event, "a")
+	}
+
+	select {
+	case <-pushed:
+	case <-time.After(time.Second):
+		t.Fatal("Push did not return after space was freed")
+	}
+	if q.Dropped() != 0 {
+		t.Errorf("Dropped() = %d, want 0", q.Dropped())
+	}
+}
+
+// TestQueueCloseReleasesBlockedCallers verifies that Close wakes both a
+// blocked consumer and a blocked producer.
+func TestQueueCloseReleasesBlockedCallers(t *testing.T) {
+	q := queue.New(1, queue.PolicyBlock)
+
+	popped := make(chan bool)
+	go func() {
+		_, ok := q.Pop()
+		popped <- ok
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	q.Close()
+
+	select {
+	case ok := <-popped:
+		if ok {
+			t.Error("Pop() on closed empty queue returned ok = true")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Pop did not return after Close")
+	}
+
+	if q.Push(ev(events.CategoryRead, "late")) {
+		t.Error("Push after Close returned true")
+	}
+}
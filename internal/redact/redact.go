@@ -0,0 +1,186 @@
+// Package redact scrubs secrets and unwanted detail from events before the
+// server broadcasts them, since an event's Detail carries raw Bash commands,
+// file paths, URLs and search queries.
+package redact
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/dacort/babble/internal/events"
+)
+
+// Mask replaces each secret found in a detail.
+const Mask = "[redacted]"
+
+// Level controls how much of an event's Detail is kept.
+type Level string
+
+const (
+	// LevelFull keeps the whole detail (after secrets are masked).
+	LevelFull Level = "full"
+	// LevelBasename keeps only the last element of a path, the host of a
+	// URL, or the program name of a command.
+	LevelBasename Level = "basename"
+	// LevelNone drops the detail entirely.
+	LevelNone Level = "none"
+)
+
+// ParseLevel validates s as a Level. "" is LevelFull.
+func ParseLevel(s string) (Level, error) {
+	switch Level(s) {
+	case "", LevelFull:
+		return LevelFull, nil
+	case LevelBasename, LevelNone:
+		return Level(s), nil
+	}
+	return "", fmt.Errorf("unknown detail level %q (want full, basename or none)", s)
+}
+
+// detector masks one kind of secret. Replacements may refer to groups in re,
+// so that a recognisable prefix such as "Authorization: Bearer " is kept.
+type detector struct {
+	re   *regexp.Regexp
+	repl string
+}
+
+// builtins are the detectors every Redactor applies. Details are truncated
+// before they get here, so key patterns only demand enough characters to be
+// distinctive rather than a key's full length.
+var builtins = []detector{
+	// Authorization headers, with or without a scheme.
+	{regexp.MustCompile(`(?i)(authorization:\s*(?:bearer\s+|basic\s+|token\s+)?)[^\s"']+`), "${1}" + Mask},
+	// Bare bearer tokens, e.g. in scripts that build the header themselves.
+	{regexp.MustCompile(`(?i)(\bbearer\s+)[A-Za-z0-9._~+/=-]{8,}`), "${1}" + Mask},
+	// Well-known API key formats: OpenAI/Anthropic, AWS access keys, GitHub,
+	// Slack, Google, and JWTs.
+	{regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{12,}`), Mask},
+	{regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{12,}`), Mask},
+	{regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{12,}|github_pat_[A-Za-z0-9_]{12,})`), Mask},
+	{regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{8,}`), Mask},
+	{regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{12,}`), Mask},
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]*`), Mask},
+	// Credentials embedded in URLs.
+	{regexp.MustCompile(`(://)[^/\s:@]+:[^/\s@]+@`), "${1}" + Mask + "@"},
+	// Secret-looking URL query parameters.
+	{regexp.MustCompile(`(?i)([?&](?:access_token|api_?key|key|token|secret|password|sig|signature)=)[^&\s"']+`), "${1}" + Mask},
+	// Secret-looking command-line flags.
+	{regexp.MustCompile(`(?i)(--?(?:password|passwd|token|secret|api-key|apikey)[= ])[^\s"']+`), "${1}" + Mask},
+	// Environment assignments (FOO=bar, export AWS_SECRET_ACCESS_KEY=...).
+	{regexp.MustCompile(`\b([A-Z_][A-Z0-9_]*=)("[^"]*"?|'[^']*'?|[^\s;&|]+)`), "${1}" + Mask},
+}
+
+// Redactor masks secrets in event details and trims them to the configured
+// detail level. A Redactor is immutable and safe for concurrent use.
+type Redactor struct {
+	custom []*regexp.Regexp
+	levels map[events.Category]Level
+	home   string // home directory to shorten to "~"; "" to leave paths alone
+}
+
+// New returns a Redactor that applies the built-in detectors plus patterns,
+// whose matches are replaced by Mask, and keeps detail per levels (category →
+// level; unlisted categories keep full detail). Paths under home are
+// shortened to start with "~".
+func New(patterns []string, levels map[string]string, home string) (*Redactor, error) {
+	r := &Redactor{
+		levels: make(map[events.Category]Level, len(levels)),
+		home:   strings.TrimSuffix(home, "/"),
+	}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("redact: pattern %q: %w", p, err)
+		}
+		r.custom = append(r.custom, re)
+	}
+	for cat, s := range levels {
+		lvl, err := ParseLevel(s)
+		if err != nil {
+			return nil, fmt.Errorf("redact: category %s: %w", cat, err)
+		}
+		r.levels[events.Category(cat)] = lvl
+	}
+	return r, nil
+}
+
+// Event redacts ev.Detail and ev.FilePath in place according to ev's
+// category. ev.Cwd and the working tree root in ev.Git are redacted as
+// String does, whatever the category.
+func (r *Redactor) Event(ev *events.BabbleEvent) {
+	ev.Cwd = r.String(ev.Cwd)
+	if ev.Git != nil {
+		ev.Git.Root = r.String(ev.Git.Root)
+	}
+	switch r.levels[ev.Category] {
+	case LevelNone:
+		ev.Detail, ev.FilePath = "", ""
+		return
+	case LevelBasename:
+		ev.Detail, ev.FilePath = basename(ev.Detail), basename(ev.FilePath)
+	}
+	ev.Detail = r.String(ev.Detail)
+	ev.FilePath = r.String(ev.FilePath)
+}
+
+// String masks secrets in s and shortens paths under the home directory.
+func (r *Redactor) String(s string) string {
+	if s == "" {
+		return s
+	}
+	for _, d := range builtins {
+		s = d.re.ReplaceAllString(s, d.repl)
+	}
+	for _, re := range r.custom {
+		s = re.ReplaceAllLiteralString(s, Mask)
+	}
+	return r.shortenHome(s)
+}
+
+// shortenHome replaces each occurrence of the home directory that is a whole
+// path prefix with "~".
+func (r *Redactor) shortenHome(s string) string {
+	if r.home == "" || r.home == "/" {
+		return s
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(s, r.home)
+		if i < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		end := i + len(r.home)
+		b.WriteString(s[:i])
+		if end == len(s) || s[end] == '/' {
+			b.WriteString("~")
+		} else {
+			// A longer name that merely starts the same, e.g. /home/al vs /home/alice.
+			b.WriteString(r.home)
+		}
+		s = s[end:]
+	}
+}
+
+// basename reduces a detail to its last path element, a URL's host, or a
+// command's program name.
+func basename(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return s
+	}
+	if strings.HasPrefix(s, "/") || strings.HasPrefix(s, "~/") || strings.HasPrefix(s, "./") || strings.HasPrefix(s, "../") {
+		// A path whose last element has spaces in it is more likely a
+		// command run by path ("/usr/bin/git push") than a file name.
+		if base := path.Base(s); !strings.ContainsAny(base, " \t") {
+			return base
+		}
+	}
+	if u, err := url.Parse(s); err == nil && u.Scheme != "" && u.Host != "" {
+		return u.Hostname()
+	}
+	return path.Base(strings.Fields(s)[0])
+}
@@ -0,0 +1,219 @@
+// Package registry keeps an in-memory view of the Claude sessions seen by the
+// event pipeline: when each was last active, what it has been doing, and the
+// most recent events across all sessions.
+package registry
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dacort/babble/internal/events"
+	"github.com/dacort/babble/internal/gitinfo"
+)
+
+// State describes how recently a session has produced events.
+type State string
+
+const (
+	// StateActive means the session produced an event within the idle timeout.
+	StateActive State = "active"
+	// StateIdle means the session has been quiet for longer than the idle
+	// timeout but not yet long enough to be considered over.
+	StateIdle State = "idle"
+	// StateEnded means the session has been quiet for longer than EndedAfter.
+	StateEnded State = "ended"
+)
+
+// EndedAfter is how long a session must be silent before it is reported as
+// ended. Claude Code does not log an explicit end-of-session record, so
+// silence is the only signal available.
+const EndedAfter = 30 * time.Minute
+
+// DefaultHistorySize is the number of recent events retained when a
+// non-positive size is given.
+const DefaultHistorySize = 500
+
+// Session summarises one Claude session.
+type Session struct {
+	ID        string                  `json:"id"`
+	Name      string                  `json:"name"`
+	Cwd       string                  `json:"cwd,omitempty"`
+	Host      string                  `json:"host,omitempty"`
+	FirstSeen time.Time               `json:"firstSeen"`
+	LastSeen  time.Time               `json:"lastSeen"`
+	State     State                   `json:"state"`
+	Events    int                     `json:"events"`
+	Subagents int                     `json:"subagents"` // distinct subagents seen
+	Counts    map[events.Category]int `json:"counts"`
+	Git       *gitinfo.Info           `json:"git,omitempty"` // working tree of Cwd, if any
+}
+
+// Registry tracks sessions and recent events. It is safe for concurrent use.
+type Registry struct {
+	idleAfter time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+	agents   map[string]map[string]bool // session ID → IDs of its subagents
+	recent   []*events.BabbleEvent      // ring buffer
+	next     int                        // index of the next write into recent
+	full     bool                       // recent has wrapped at least once
+}
+
+// New creates a Registry that remembers the last historySize events and marks
+// sessions idle after idleAfter without activity.
+func New(historySize int, idleAfter time.Duration) *Registry {
+	if historySize <= 0 {
+		historySize = DefaultHistorySize
+	}
+	return &Registry{
+		idleAfter: idleAfter,
+		now:       time.Now,
+		sessions:  make(map[string]*Session),
+		agents:    make(map[string]map[string]bool),
+		recent:    make([]*events.BabbleEvent, historySize),
+	}
+}
+
+// Observe records ev against its session and appends it to the event history
+// ring buffer. Events are expected to arrive in increasing Seq order.
+func (r *Registry) Observe(ev *events.BabbleEvent) {
+	now := r.now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := ev.SessionID
+	if key == "" {
+		key = ev.Session
+	}
+	s, ok := r.sessions[key]
+	if !ok {
+		s = &Session{
+			ID:        key,
+			FirstSeen: now,
+			Counts:    make(map[events.Category]int),
+		}
+		r.sessions[key] = s
+	}
+	if ev.Session != "" {
+		s.Name = ev.Session
+	}
+	if ev.Cwd != "" && !ev.IsSubagent {
+		// A subagent may work elsewhere; the session's directory is its own.
+		s.Cwd = ev.Cwd
+		s.Git = ev.Git
+	}
+	if ev.Host != "" {
+		s.Host = ev.Host
+	}
+	if ev.AgentID != "" && !r.agents[key][ev.AgentID] {
+		if r.agents[key] == nil {
+			r.agents[key] = make(map[string]bool)
+		}
+		r.agents[key][ev.AgentID] = true
+		s.Subagents++
+	}
+	s.LastSeen = now
+	s.Events++
+	s.Counts[ev.Category]++
+
+	r.recent[r.next] = ev
+	r.next = (r.next + 1) % len(r.recent)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Sessions returns a copy of every known session with its State computed as
+// of now, most recently active first.
+func (r *Registry) Sessions() []Session {
+	now := r.now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]Session, 0, len(r.sessions))
+	for _, s := range r.sessions {
+		out = append(out, r.copyLocked(s, now))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastSeen.After(out[j].LastSeen) })
+	return out
+}
+
+// Session returns a copy of the session with the given ID, with its State
+// computed as of now, and whether it is known.
+func (r *Registry) Session(id string) (Session, bool) {
+	now := r.now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.sessions[id]
+	if !ok {
+		return Session{}, false
+	}
+	return r.copyLocked(s, now), true
+}
+
+// Recent returns up to n of the most recent events, oldest first. A
+// non-positive n returns everything retained.
+func (r *Registry) Recent(n int) []*events.BabbleEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	all := r.historyLocked()
+	if n > 0 && len(all) > n {
+		all = all[len(all)-n:]
+	}
+	return all
+}
+
+// Since returns the retained events whose Seq is greater than seq, oldest
+// first. complete is false when events after seq have already been evicted
+// from the history, i.e. the caller has missed some.
+func (r *Registry) Since(seq uint64) (evs []*events.BabbleEvent, complete bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	all := r.historyLocked()
+	i := sort.Search(len(all), func(i int) bool { return all[i].Seq > seq })
+	complete = i > 0 || len(all) == 0 || all[0].Seq == seq+1
+	return all[i:], complete
+}
+
+// historyLocked returns a copy of the ring buffer in insertion order. The
+// caller must hold r.mu.
+func (r *Registry) historyLocked() []*events.BabbleEvent {
+	if !r.full {
+		return append(make([]*events.BabbleEvent, 0, r.next), r.recent[:r.next]...)
+	}
+	out := make([]*events.BabbleEvent, 0, len(r.recent))
+	out = append(out, r.recent[r.next:]...)
+	return append(out, r.recent[:r.next]...)
+}
+
+// copyLocked returns a deep copy of s with State filled in. The caller must
+// hold r.mu.
+func (r *Registry) copyLocked(s *Session, now time.Time) Session {
+	c := *s
+	c.Counts = make(map[events.Category]int, len(s.Counts))
+	for k, v := range s.Counts {
+		c.Counts[k] = v
+	}
+	if s.Git != nil {
+		git := *s.Git
+		c.Git = &git
+	}
+	switch quiet := now.Sub(s.LastSeen); {
+	case quiet >= EndedAfter:
+		c.State = StateEnded
+	case quiet >= r.idleAfter:
+		c.State = StateIdle
+	default:
+		c.State = StateActive
+	}
+	return c
+}
@@ -0,0 +1,158 @@
+package registry_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dacort/babble/internal/events"
+	"github.com/dacort/babble/internal/gitinfo"
+	"github.com/dacort/babble/internal/registry"
+)
+
+// ev returns a BabbleEvent for session id/name in category cat.
+func ev(id, name string, cat events.Category) *events.BabbleEvent {
+	return &events.BabbleEvent{SessionID: id, Session: name, Category: cat, Event: string(cat)}
+}
+
+func TestRegistryTracksSessions(t *testing.T) {
+	r := registry.New(10, time.Minute)
+	r.Observe(ev("a", "api", events.CategoryRead))
+	r.Observe(ev("a", "api", events.CategoryRead))
+	r.Observe(ev("a", "api", events.CategoryError))
+	r.Observe(ev("b", "web", events.CategoryWrite))
+
+	sessions := r.Sessions()
+	if len(sessions) != 2 {
+		t.Fatalf("len(Sessions()) = %d, want 2", len(sessions))
+	}
+
+	// Most recently active first.
+	if sessions[0].ID != "b" {
+		t.Errorf("sessions[0].ID = %q, want %q", sessions[0].ID, "b")
+	}
+
+	a := sessions[1]
+	if a.Name != "api" {
+		t.Errorf("Name = %q, want %q", a.Name, "api")
+	}
+	if a.Events != 3 {
+		t.Errorf("Events = %d, want 3", a.Events)
+	}
+	if a.Counts[events.CategoryRead] != 2 || a.Counts[events.CategoryError] != 1 {
+		t.Errorf("Counts = %v, want read:2 error:1", a.Counts)
+	}
+	if a.State != registry.StateActive {
+		t.Errorf("State = %q, want %q", a.State, registry.StateActive)
+	}
+
+	// Mutating the returned copy must not affect the registry.
+	a.Counts[events.CategoryRead] = 99
+	if got := r.Sessions()[1].Counts[events.CategoryRead]; got != 2 {
+		t.Errorf("registry Counts mutated through copy: got %d, want 2", got)
+	}
+}
+
+func TestRegistryIdleState(t *testing.T) {
+	r := registry.New(10, 20*time.Millisecond)
+	r.Observe(ev("a", "api", events.CategoryRead))
+
+	time.Sleep(40 * time.Millisecond)
+
+	if got := r.Sessions()[0].State; got != registry.StateIdle {
+		t.Errorf("State = %q, want %q", got, registry.StateIdle)
+	}
+}
+
+func TestRegistryRecentRingBuffer(t *testing.T) {
+	r := registry.New(3, time.Minute)
+
+	if got := r.Recent(0); got == nil || len(got) != 0 {
+		t.Fatalf("Recent(0) on empty registry = %v, want empty non-nil slice", got)
+	}
+
+	for _, name := range []string{"1", "2", "3", "4", "5"} {
+		r.Observe(&events.BabbleEvent{SessionID: "s", Event: name})
+	}
+
+	got := r.Recent(0)
+	want := []string{"3", "4", "5"}
+	if len(got) != len(want) {
+		t.Fatalf("len(Recent(0)) = %d, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Event != want[i] {
+			t.Errorf("Recent(0)[%d] = %q, want %q", i, got[i].Event, want[i])
+		}
+	}
+
+	if got := r.Recent(2); len(got) != 2 || got[0].Event != "4" {
+		t.Errorf("Recent(2) = %d events starting %v, want 2 starting with \"4\"", len(got), got)
+	}
+}
+
+func TestRegistrySince(t *testing.T) {
+	r := registry.New(3, time.Minute)
+	for seq := uint64(1); seq <= 5; seq++ {
+		r.Observe(&events.BabbleEvent{SessionID: "s", Seq: seq})
+	}
+	// History now holds seq 3, 4, 5.
+
+	tests := []struct {
+		since        uint64
+		wantSeqs     []uint64
+		wantComplete bool
+	}{
+		{5, nil, true},
+		{3, []uint64{4, 5}, true},
+		{2, []uint64{3, 4, 5}, true},
+		{1, []uint64{3, 4, 5}, false}, // seq 2 was evicted
+	}
+	for _, tt := range tests {
+		got, complete := r.Since(tt.since)
+		if complete != tt.wantComplete {
+			t.Errorf("Since(%d) complete = %v, want %v", tt.since, complete, tt.wantComplete)
+		}
+		if len(got) != len(tt.wantSeqs) {
+			t.Errorf("Since(%d) returned %d events, want %d", tt.since, len(got), len(tt.wantSeqs))
+			continue
+		}
+		for i, want := range tt.wantSeqs {
+			if got[i].Seq != want {
+				t.Errorf("Since(%d)[%d].Seq = %d, want %d", tt.since, i, got[i].Seq, want)
+			}
+		}
+	}
+}
+
+func TestRegistrySessionDetails(t *testing.T) {
+	r := registry.New(10, time.Minute)
+	main := ev("a", "api", events.CategoryRead)
+	main.Cwd = "~/work/api"
+	main.Git = &gitinfo.Info{Root: "~/work/api", Repo: "api", Branch: "main"}
+	r.Observe(main)
+	for _, agent := range []string{"x", "y", "x"} {
+		sub := ev("a", "api", events.CategoryRead)
+		sub.IsSubagent, sub.AgentID, sub.Cwd = true, agent, "/tmp"
+		r.Observe(sub)
+	}
+
+	s, ok := r.Session("a")
+	if !ok {
+		t.Fatal("Session(a) not found")
+	}
+	if s.Cwd != "~/work/api" {
+		t.Errorf("Cwd = %q, want %q", s.Cwd, "~/work/api")
+	}
+	if s.Git == nil || s.Git.Branch != "main" {
+		t.Errorf("Git = %+v, want branch main", s.Git)
+	}
+	if s.Subagents != 2 {
+		t.Errorf("Subagents = %d, want 2", s.Subagents)
+	}
+	if s.Events != 4 || s.State != registry.StateActive {
+		t.Errorf("Events, State = %d, %q, want 4, active", s.Events, s.State)
+	}
+	if _, ok := r.Session("b"); ok {
+		t.Error("Session(b) found, want unknown")
+	}
+}
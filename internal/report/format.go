@@ -0,0 +1,173 @@
+package report
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dacort/babble/internal/gitinfo"
+)
+
+// maxFilesListed is how many written files the text and Markdown formats
+// list per session before summarising the rest as a count.
+const maxFilesListed = 10
+
+// WriteText writes sums as plain text for a terminal.
+func WriteText(w io.Writer, sums []Summary) error {
+	bw := bufio.NewWriter(w)
+	for i, s := range sums {
+		if i > 0 {
+			bw.WriteString("\n")
+		}
+		fmt.Fprintf(bw, "%s (%s)\n", s.Session, s.SessionID)
+		if s.Git != nil {
+			fmt.Fprintf(bw, "  git       %s\n", formatGit(s.Git))
+		}
+		fmt.Fprintf(bw, "  time      %s – %s (%s)\n", formatTime(s.Start), formatTime(s.End), s.Duration)
+		fmt.Fprintf(bw, "  events    %d%s\n", s.Events, subagentNote(s))
+		fmt.Fprintf(bw, "  by kind   %s\n", joinCounts(categoryCounts(s)))
+		if len(s.Tools) > 0 {
+			fmt.Fprintf(bw, "  tools     %s\n", joinCounts(s.Tools))
+		}
+		if s.ToolResults > 0 {
+			fmt.Fprintf(bw, "  errors    %d of %d tool results (%.0f%%)\n", s.Errors, s.ToolResults, 100*s.ErrorRate)
+		}
+		fmt.Fprintf(bw, "  tokens    %s\n", formatTokens(s.Tokens))
+		if s.LongestIdle != nil {
+			fmt.Fprintf(bw, "  idlest    %s from %s\n", s.LongestIdle.Duration, formatTime(s.LongestIdle.Start))
+		}
+		if len(s.FilesWritten) > 0 {
+			fmt.Fprintf(bw, "  wrote     %s\n", countFiles(len(s.FilesWritten)))
+			files, more := listedFiles(s)
+			for _, f := range files {
+				fmt.Fprintf(bw, "            %s\n", f)
+			}
+			if more > 0 {
+				fmt.Fprintf(bw, "            … and %d more\n", more)
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteMarkdown writes sums as a Markdown document, one section per session.
+func WriteMarkdown(w io.Writer, sums []Summary) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("# Claude sessions\n")
+	if len(sums) == 0 {
+		bw.WriteString("\nNo sessions.\n")
+	}
+	for _, s := range sums {
+		fmt.Fprintf(bw, "\n## %s\n\n", s.Session)
+		fmt.Fprintf(bw, "| | |\n|---|---|\n")
+		fmt.Fprintf(bw, "| Session | `%s` |\n", s.SessionID)
+		if s.Git != nil {
+			fmt.Fprintf(bw, "| Git | %s |\n", formatGit(s.Git))
+		}
+		fmt.Fprintf(bw, "| Time | %s – %s (%s) |\n", formatTime(s.Start), formatTime(s.End), s.Duration)
+		fmt.Fprintf(bw, "| Events | %d%s |\n", s.Events, subagentNote(s))
+		fmt.Fprintf(bw, "| By kind | %s |\n", joinCounts(categoryCounts(s)))
+		if len(s.Tools) > 0 {
+			fmt.Fprintf(bw, "| Tools | %s |\n", joinCounts(s.Tools))
+		}
+		if s.ToolResults > 0 {
+			fmt.Fprintf(bw, "| Errors | %d of %d tool results (%.0f%%) |\n", s.Errors, s.ToolResults, 100*s.ErrorRate)
+		}
+		fmt.Fprintf(bw, "| Tokens | %s |\n", formatTokens(s.Tokens))
+		if s.LongestIdle != nil {
+			fmt.Fprintf(bw, "| Longest idle | %s from %s |\n", s.LongestIdle.Duration, formatTime(s.LongestIdle.Start))
+		}
+		if len(s.FilesWritten) > 0 {
+			fmt.Fprintf(bw, "\nFiles written:\n\n")
+			files, more := listedFiles(s)
+			for _, f := range files {
+				fmt.Fprintf(bw, "- `%s`\n", f)
+			}
+			if more > 0 {
+				fmt.Fprintf(bw, "- … and %d more\n", more)
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// formatTime formats t in local time, or "?" if it is unknown.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "?"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// formatGit formats g as "repo on branch (remote)".
+func formatGit(g *gitinfo.Info) string {
+	s := g.Repo
+	if g.Branch != "" {
+		s += " on " + g.Branch
+	} else {
+		s += " (detached HEAD)"
+	}
+	if g.Remote != "" {
+		s += " (" + g.Remote + ")"
+	}
+	return s
+}
+
+// subagentNote notes how many of s's events came from subagents, if any.
+func subagentNote(s Summary) string {
+	if s.SubagentEvents == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%d from subagents)", s.SubagentEvents)
+}
+
+// categoryCounts returns s's category counts keyed by name.
+func categoryCounts(s Summary) map[string]int {
+	m := make(map[string]int, len(s.Categories))
+	for cat, n := range s.Categories {
+		m[string(cat)] = n
+	}
+	return m
+}
+
+// joinCounts formats counts as "name n", most frequent first.
+func joinCounts(counts map[string]int) string {
+	names := slices.Collect(maps.Keys(counts))
+	slices.SortFunc(names, func(a, b string) int {
+		if c := cmp.Compare(counts[b], counts[a]); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s %d", name, counts[name])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatTokens formats t as its uncached and cached totals.
+func formatTokens(t Tokens) string {
+	return fmt.Sprintf("%d in, %d out, %d cache read, %d cache write", t.Input, t.Output, t.CacheRead, t.CacheCreation)
+}
+
+// countFiles formats n as "n file" or "n files".
+func countFiles(n int) string {
+	if n == 1 {
+		return "1 file"
+	}
+	return fmt.Sprintf("%d files", n)
+}
+
+// listedFiles returns the files of s to list and how many were left out.
+func listedFiles(s Summary) ([]string, int) {
+	if len(s.FilesWritten) <= maxFilesListed {
+		return s.FilesWritten, 0
+	}
+	return s.FilesWritten[:maxFilesListed], len(s.FilesWritten) - maxFilesListed
+}
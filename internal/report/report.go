@@ -0,0 +1,222 @@
+// Package report summarises what each Claude session did: how long it ran,
+// what kinds of events it produced, which tools it used, how often they
+// failed, which files it wrote, how many tokens it spent, its longest pause
+// and, where known, the git branch it was on.
+package report
+
+import (
+	"cmp"
+	"encoding/json"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/dacort/babble/internal/events"
+	"github.com/dacort/babble/internal/gitinfo"
+)
+
+// Duration is a time.Duration that is encoded in JSON as seconds.
+type Duration time.Duration
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).Seconds())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var secs float64
+	if err := json.Unmarshal(data, &secs); err != nil {
+		return err
+	}
+	*d = Duration(secs * float64(time.Second))
+	return nil
+}
+
+// String formats d rounded to the second, e.g. "1h2m3s".
+func (d Duration) String() string {
+	return time.Duration(d).Round(time.Second).String()
+}
+
+// Tokens totals the token usage of a session.
+type Tokens struct {
+	Input         int `json:"input"`
+	Output        int `json:"output"`
+	CacheCreation int `json:"cacheCreation"`
+	CacheRead     int `json:"cacheRead"`
+}
+
+// Total returns every token counted, cached or not.
+func (t Tokens) Total() int {
+	return t.Input + t.Output + t.CacheCreation + t.CacheRead
+}
+
+// Gap is a pause between two consecutive events.
+type Gap struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Duration Duration  `json:"duration"`
+}
+
+// Summary describes one session.
+type Summary struct {
+	SessionID      string                  `json:"sessionId"`
+	Session        string                  `json:"session"`
+	Start          time.Time               `json:"start"`
+	End            time.Time               `json:"end"`
+	Duration       Duration                `json:"duration"`
+	Events         int                     `json:"events"`
+	SubagentEvents int                     `json:"subagentEvents"`
+	Categories     map[events.Category]int `json:"categories"`
+	Tools          map[string]int          `json:"tools"`
+	ToolResults    int                     `json:"toolResults"`
+	Errors         int                     `json:"errors"`
+	ErrorRate      float64                 `json:"errorRate"` // Errors / ToolResults
+	FilesWritten   []string                `json:"filesWritten"`
+	Tokens         Tokens                  `json:"tokens"`
+	LongestIdle    *Gap                    `json:"longestIdle,omitempty"` // nil with fewer than two timed events
+	Git            *gitinfo.Info           `json:"git,omitempty"`         // as of the session's latest event that has it
+}
+
+// Builder accumulates events into per-session summaries. Events may be added
+// in any order. A Builder is not safe for concurrent use.
+type Builder struct {
+	sessions map[string]*session
+}
+
+// session is a Summary under construction.
+type session struct {
+	sum     Summary
+	times   []time.Time
+	files   map[string]bool
+	tokens  map[string]events.Usage // message ID → usage, to count each response once
+	unkeyed Tokens                  // usage without a message ID
+	gitAt   time.Time               // timestamp of the event sum.Git came from
+}
+
+// NewBuilder returns an empty Builder.
+func NewBuilder() *Builder {
+	return &Builder{sessions: make(map[string]*session)}
+}
+
+// Add counts ev towards its session, identified by SessionID (or by name for
+// events that lack one).
+func (b *Builder) Add(ev *events.BabbleEvent) {
+	key := ev.SessionID
+	if key == "" {
+		key = ev.Session
+	}
+	s, ok := b.sessions[key]
+	if !ok {
+		s = &session{
+			sum: Summary{
+				SessionID:  ev.SessionID,
+				Session:    ev.Session,
+				Categories: make(map[events.Category]int),
+				Tools:      make(map[string]int),
+			},
+			files:  make(map[string]bool),
+			tokens: make(map[string]events.Usage),
+		}
+		b.sessions[key] = s
+	}
+	sum := &s.sum
+	if sum.Session == "" {
+		sum.Session = ev.Session
+	}
+
+	sum.Events++
+	if ev.IsSubagent {
+		sum.SubagentEvents++
+	}
+	sum.Categories[ev.Category]++
+	if ev.ToolUse {
+		sum.Tools[ev.Event]++
+	}
+	switch ev.Category {
+	case events.CategoryError:
+		sum.ToolResults++
+		sum.Errors++
+	case events.CategorySuccess:
+		sum.ToolResults++
+	case events.CategoryWrite:
+		if ev.ToolUse && ev.FilePath != "" {
+			s.files[ev.FilePath] = true
+		}
+	}
+
+	if ev.Git != nil && !ev.IsSubagent {
+		if t, err := time.Parse(time.RFC3339Nano, ev.Timestamp); sum.Git == nil || (err == nil && !t.Before(s.gitAt)) {
+			git := *ev.Git
+			sum.Git, s.gitAt = &git, t
+		}
+	}
+
+	if u := ev.Usage; u != nil {
+		if u.MessageID == "" {
+			s.unkeyed.add(*u)
+		} else if prev, ok := s.tokens[u.MessageID]; !ok || u.Output > prev.Output {
+			// Later lines of a streamed response may carry the final count.
+			s.tokens[u.MessageID] = *u
+		}
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, ev.Timestamp); err == nil {
+		s.times = append(s.times, t)
+	}
+}
+
+// add adds u to t.
+func (t *Tokens) add(u events.Usage) {
+	t.Input += u.Input
+	t.Output += u.Output
+	t.CacheCreation += u.CacheCreation
+	t.CacheRead += u.CacheRead
+}
+
+// Summaries returns a summary of every session seen, in order of when each
+// started.
+func (b *Builder) Summaries() []Summary {
+	out := make([]Summary, 0, len(b.sessions))
+	for _, s := range b.sessions {
+		out = append(out, s.summary())
+	}
+	slices.SortFunc(out, func(a, b Summary) int {
+		if c := a.Start.Compare(b.Start); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.SessionID, b.SessionID)
+	})
+	return out
+}
+
+// summary completes s's Summary.
+func (s *session) summary() Summary {
+	sum := s.sum
+	sum.Categories = maps.Clone(sum.Categories)
+	sum.Tools = maps.Clone(sum.Tools)
+
+	if sum.ToolResults > 0 {
+		sum.ErrorRate = float64(sum.Errors) / float64(sum.ToolResults)
+	}
+	sum.FilesWritten = slices.Sorted(maps.Keys(s.files))
+
+	sum.Tokens = s.unkeyed
+	for _, u := range s.tokens {
+		sum.Tokens.add(u)
+	}
+
+	times := slices.Clone(s.times)
+	slices.SortFunc(times, time.Time.Compare)
+	if len(times) > 0 {
+		sum.Start, sum.End = times[0], times[len(times)-1]
+		sum.Duration = Duration(sum.End.Sub(sum.Start))
+	}
+	for i := 1; i < len(times); i++ {
+		gap := times[i].Sub(times[i-1])
+		if sum.LongestIdle == nil || gap > time.Duration(sum.LongestIdle.Duration) {
+			sum.LongestIdle = &Gap{Start: times[i-1], End: times[i], Duration: Duration(gap)}
+		}
+	}
+	return sum
+}
@@ -0,0 +1,247 @@
+package report_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dacort/babble/internal/events"
+	"github.com/dacort/babble/internal/gitinfo"
+	"github.com/dacort/babble/internal/report"
+)
+
+// base is the timestamp of the first test event.
+var base = time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+// at returns base plus d, formatted as a log timestamp.
+func at(d time.Duration) string {
+	return base.Add(d).Format(time.RFC3339Nano)
+}
+
+// TestBuilder checks each field of a summary built from one session's events
+// added out of order.
+func TestBuilder(t *testing.T) {
+	evs := []*events.BabbleEvent{
+		{SessionID: "s1", Session: "api", Category: events.CategoryWrite, Event: "Edit", ToolUse: true, Detail: "/src/b.go", FilePath: "/src/b.go", Timestamp: at(2 * time.Minute),
+			Git: &gitinfo.Info{Root: "/src", Repo: "src", Branch: "next"}},
+		{SessionID: "s1", Session: "api", Category: events.CategoryAmbient, Event: "thinking", Timestamp: at(0),
+			Usage: &events.Usage{MessageID: "m1", Input: 10, Output: 1, CacheRead: 100}},
+		// A later line of the same streamed response, with the final count.
+		{SessionID: "s1", Session: "api", Category: events.CategoryRead, Event: "Read", ToolUse: true, Detail: "/src/a.go", Timestamp: at(time.Minute),
+			Usage: &events.Usage{MessageID: "m1", Input: 10, Output: 50, CacheRead: 100}},
+		{SessionID: "s1", Session: "api", Category: events.CategorySuccess, Event: "tool_result", Timestamp: at(3 * time.Minute)},
+		// Added after the checkout but logged before it.
+		{SessionID: "s1", Session: "api", Category: events.CategoryAction, Event: "Bash", ToolUse: true, Timestamp: at(90 * time.Second),
+			Git: &gitinfo.Info{Root: "/src", Repo: "src", Branch: "main"}},
+		{SessionID: "s1", Session: "api", Category: events.CategoryError, Event: "tool_result", Timestamp: at(13 * time.Minute), IsSubagent: true},
+		{SessionID: "s1", Session: "api", Category: events.CategoryWrite, Event: "Write", ToolUse: true, Detail: "/src/a.go", FilePath: "/src/a.go", Timestamp: at(14 * time.Minute),
+			Usage: &events.Usage{MessageID: "m2", Input: 5, Output: 20, CacheCreation: 7}},
+		{SessionID: "s1", Session: "api", Category: events.CategoryWrite, Event: "Edit", ToolUse: true, Detail: "/src/b.go", FilePath: "/src/b.go", Timestamp: at(15 * time.Minute)},
+	}
+	b := report.NewBuilder()
+	for _, ev := range evs {
+		b.Add(ev)
+	}
+	sums := b.Summaries()
+	if len(sums) != 1 {
+		t.Fatalf("got %d summaries, want 1", len(sums))
+	}
+	s := sums[0]
+
+	if s.SessionID != "s1" || s.Session != "api" {
+		t.Errorf("session = %q (%q), want api (s1)", s.Session, s.SessionID)
+	}
+	if !s.Start.Equal(base) || !s.End.Equal(base.Add(15*time.Minute)) {
+		t.Errorf("start, end = %v, %v", s.Start, s.End)
+	}
+	if got := time.Duration(s.Duration); got != 15*time.Minute {
+		t.Errorf("Duration = %v, want 15m", got)
+	}
+	if s.Events != 8 || s.SubagentEvents != 1 {
+		t.Errorf("Events, SubagentEvents = %d, %d, want 8, 1", s.Events, s.SubagentEvents)
+	}
+	if got := s.Categories[events.CategoryWrite]; got != 3 {
+		t.Errorf("Categories[write] = %d, want 3", got)
+	}
+	if want := map[string]int{"Bash": 1, "Edit": 2, "Read": 1, "Write": 1}; !maps.Equal(s.Tools, want) {
+		t.Errorf("Tools = %v, want %v", s.Tools, want)
+	}
+	if s.ToolResults != 2 || s.Errors != 1 || s.ErrorRate != 0.5 {
+		t.Errorf("ToolResults, Errors, ErrorRate = %d, %d, %v, want 2, 1, 0.5", s.ToolResults, s.Errors, s.ErrorRate)
+	}
+	if want := []string{"/src/a.go", "/src/b.go"}; !slices.Equal(s.FilesWritten, want) {
+		t.Errorf("FilesWritten = %v, want %v", s.FilesWritten, want)
+	}
+	if s.Git == nil || s.Git.Branch != "next" {
+		t.Errorf("Git = %+v, want the branch of the latest event, next", s.Git)
+	}
+	want := report.Tokens{Input: 15, Output: 70, CacheCreation: 7, CacheRead: 100}
+	if s.Tokens != want {
+		t.Errorf("Tokens = %+v, want %+v", s.Tokens, want)
+	}
+	if s.LongestIdle == nil || time.Duration(s.LongestIdle.Duration) != 10*time.Minute || !s.LongestIdle.Start.Equal(base.Add(3*time.Minute)) {
+		t.Errorf("LongestIdle = %+v, want 10m from 09:03", s.LongestIdle)
+	}
+}
+
+// TestSummariesOrder checks that sessions are kept apart and ordered by when
+// they started, and that a single event has no idle gap.
+func TestSummariesOrder(t *testing.T) {
+	b := report.NewBuilder()
+	b.Add(&events.BabbleEvent{SessionID: "late", Session: "web", Timestamp: at(time.Hour)})
+	b.Add(&events.BabbleEvent{SessionID: "early", Session: "api", Timestamp: at(0)})
+	b.Add(&events.BabbleEvent{SessionID: "early", Session: "api", Timestamp: at(time.Minute)})
+
+	sums := b.Summaries()
+	if len(sums) != 2 || sums[0].SessionID != "early" || sums[1].SessionID != "late" {
+		t.Fatalf("got %+v, want early then late", sums)
+	}
+	if sums[1].LongestIdle != nil {
+		t.Errorf("LongestIdle of a single event = %+v, want nil", sums[1].LongestIdle)
+	}
+	if sums[1].ErrorRate != 0 {
+		t.Errorf("ErrorRate without tool results = %v, want 0", sums[1].ErrorRate)
+	}
+}
+
+// TestDurationJSON checks that durations are encoded as seconds and decode
+// back.
+func TestDurationJSON(t *testing.T) {
+	data, err := json.Marshal(report.Duration(90 * time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "90" {
+		t.Errorf("got %s, want 90", data)
+	}
+	var d report.Duration
+	if err := json.Unmarshal([]byte("1.5"), &d); err != nil {
+		t.Fatal(err)
+	}
+	if time.Duration(d) != 1500*time.Millisecond {
+		t.Errorf("decoded %v, want 1.5s", time.Duration(d))
+	}
+}
+
+// logLine returns a Claude Code log line recording a Bash tool use.
+func logLine(sessionID string, ts time.Time) string {
+	return `{"type":"assistant","sessionId":"` + sessionID + `","cwd":"/home/u/proj","timestamp":"` + ts.Format(time.RFC3339Nano) +
+		`","message":{"id":"m","content":[{"type":"tool_use","name":"Bash","input":{"command":"ls"}}]}}`
+}
+
+// TestReadLogs checks that ReadLogs finds logs and subagent logs, skips
+// events before since and lines that do not parse, and applies keep.
+func TestReadLogs(t *testing.T) {
+	root := t.TempDir()
+	now := time.Now().UTC()
+	write := func(rel string, lines ...string) {
+		t.Helper()
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("proj/s1.jsonl",
+		logLine("s1", now.Add(-48*time.Hour)),
+		"not json",
+		logLine("s1", now.Add(-time.Hour)),
+		logLine("s1", now.Add(-time.Minute)), // no trailing newline
+	)
+	write("proj/s1/subagents/agent-x.jsonl", logLine("s1", now.Add(-30*time.Minute)))
+	write("proj/s2.jsonl", logLine("s2", now.Add(-2*time.Hour)))
+	write("proj/notes.txt", logLine("s3", now))
+
+	b := report.NewBuilder()
+	keep := func(ev *events.BabbleEvent) bool { return ev.SessionID == "s1" }
+	if err := report.ReadLogs(root, now.Add(-24*time.Hour), keep, b); err != nil {
+		t.Fatalf("ReadLogs: %v", err)
+	}
+	sums := b.Summaries()
+	if len(sums) != 1 {
+		t.Fatalf("got %d summaries, want 1", len(sums))
+	}
+	s := sums[0]
+	if s.Session != "proj" || s.Events != 3 || s.SubagentEvents != 1 || s.Tools["Bash"] != 3 {
+		t.Errorf("got %+v, want 3 Bash events in proj, 1 from a subagent", s)
+	}
+
+	if err := report.ReadLogs(filepath.Join(root, "missing"), time.Time{}, nil, report.NewBuilder()); err != nil {
+		t.Errorf("ReadLogs of a missing root: %v", err)
+	}
+}
+
+// TestReadSession checks that ReadSession reads a session's own log and
+// subagent logs, and opens no other: the other logs here cannot be opened.
+func TestReadSession(t *testing.T) {
+	root := t.TempDir()
+	now := time.Now().UTC()
+	write := func(rel string, lines ...string) {
+		t.Helper()
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("proj/s1.jsonl", logLine("s1", now.Add(-time.Hour)), logLine("s1", now.Add(-time.Minute)))
+	write("proj/s1/subagents/agent-x.jsonl", logLine("s1", now.Add(-30*time.Minute)))
+	for _, rel := range []string{"proj/s2.jsonl", "proj/s2/subagents/agent-y.jsonl", "other/s3.jsonl"} {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(filepath.Join(root, "missing"), path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := report.NewBuilder()
+	if err := report.ReadSession(root, "s1", time.Time{}, b); err != nil {
+		t.Fatalf("ReadSession: %v", err)
+	}
+	sums := b.Summaries()
+	if len(sums) != 1 || sums[0].SessionID != "s1" || sums[0].Events != 3 || sums[0].SubagentEvents != 1 {
+		t.Errorf("got %+v, want 3 events of s1, 1 from a subagent", sums)
+	}
+
+	for _, id := range []string{"*", "s?", "../proj/s1", ""} {
+		b := report.NewBuilder()
+		if err := report.ReadSession(root, id, time.Time{}, b); err != nil || len(b.Summaries()) != 0 {
+			t.Errorf("ReadSession(%q) = %v, %d summaries; want nothing", id, err, len(b.Summaries()))
+		}
+	}
+}
+
+// TestWrite checks that the text and Markdown formats include the session
+// and its files.
+func TestWrite(t *testing.T) {
+	b := report.NewBuilder()
+	b.Add(&events.BabbleEvent{SessionID: "s1", Session: "api", Category: events.CategoryWrite, Event: "Edit", ToolUse: true, Detail: "/src/a.go", FilePath: "/src/a.go", Timestamp: at(0)})
+	sums := b.Summaries()
+
+	for name, write := range map[string]func(*bytes.Buffer) error{
+		"text":     func(buf *bytes.Buffer) error { return report.WriteText(buf, sums) },
+		"markdown": func(buf *bytes.Buffer) error { return report.WriteMarkdown(buf, sums) },
+	} {
+		var buf bytes.Buffer
+		if err := write(&buf); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, want := range []string{"api", "s1", "Edit 1", "/src/a.go"} {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("%s output lacks %q:\n%s", name, want, buf.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package report
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dacort/babble/internal/events"
+)
+
+// ReadLogs parses every Claude Code session log under root (laid out as the
+// session manager expects, subagent logs included) with events.Parse and
+// adds each event from since onwards that keep accepts to b. A zero since
+// reads everything; a nil keep accepts every event. Lines that do not parse
+// are skipped. A missing root is not an error.
+func ReadLogs(root string, since time.Time, keep func(*events.BabbleEvent) bool, b *Builder) error {
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".jsonl") {
+			return nil
+		}
+		if !since.IsZero() {
+			// A log last written before since holds nothing newer.
+			if info, err := d.Info(); err == nil && info.ModTime().Before(since) {
+				return nil
+			}
+		}
+		return readLog(path, since, keep, b)
+	})
+	if err != nil {
+		return fmt.Errorf("report: %w", err)
+	}
+	return nil
+}
+
+// ReadSession is like ReadLogs for the session with ID id alone, but opens
+// only that session's own logs, <project>/<id>.jsonl and
+// <project>/<id>/subagents/*.jsonl, in each project directory under root.
+// An id that is not a plain file name matches nothing.
+func ReadSession(root, id string, since time.Time, b *Builder) error {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\*?[`) {
+		return nil
+	}
+	main, err := filepath.Glob(filepath.Join(root, "*", id+".jsonl"))
+	if err != nil {
+		return fmt.Errorf("report: %w", err)
+	}
+	subagents, err := filepath.Glob(filepath.Join(root, "*", id, "subagents", "*.jsonl"))
+	if err != nil {
+		return fmt.Errorf("report: %w", err)
+	}
+	keep := func(ev *events.BabbleEvent) bool { return ev.SessionID == id }
+	for _, path := range append(main, subagents...) {
+		if !since.IsZero() {
+			if info, err := os.Stat(path); err == nil && info.ModTime().Before(since) {
+				continue
+			}
+		}
+		if err := readLog(path, since, keep, b); err != nil {
+			return fmt.Errorf("report: %w", err)
+		}
+	}
+	return nil
+}
+
+// readLog adds the events of the log at path to b.
+func readLog(path string, since time.Time, keep func(*events.BabbleEvent) bool, b *Builder) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	isSubagent := strings.Contains(filepath.ToSlash(path), "/subagents/")
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if trimmed := strings.TrimSpace(string(line)); trimmed != "" {
+			if ev, perr := events.Parse([]byte(trimmed)); perr == nil {
+				ev.IsSubagent = isSubagent
+				if wanted(ev, since, keep) {
+					b.Add(ev)
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read %s: %w", path, err)
+		}
+	}
+}
+
+// wanted reports whether ev is from since onwards and accepted by keep.
+func wanted(ev *events.BabbleEvent, since time.Time, keep func(*events.BabbleEvent) bool) bool {
+	if !since.IsZero() {
+		t, err := time.Parse(time.RFC3339Nano, ev.Timestamp)
+		if err != nil || t.Before(since) {
+			return false
+		}
+	}
+	return keep == nil || keep(ev)
+}
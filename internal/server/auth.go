@@ -0,0 +1,222 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/dacort/babble/internal/config"
+)
+
+// tokenCookie is the cookie a browser presents its auth token in, set once it
+// has opened the UI with ?token=.
+const tokenCookie = "babble_token"
+
+// tokenFile is the name of the file in the state directory that holds the
+// token generated when the server listens beyond loopback and no authToken
+// is configured.
+const tokenFile = "token"
+
+// isLoopback reports whether bind only accepts connections from this machine.
+func isLoopback(bind string) bool {
+	if strings.EqualFold(bind, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(bind)
+	return ip != nil && ip.IsLoopback()
+}
+
+// isUnspecified reports whether bind listens on every interface.
+func isUnspecified(bind string) bool {
+	ip := net.ParseIP(bind)
+	return ip != nil && ip.IsUnspecified()
+}
+
+// resolveToken returns the token clients must present: cfg.AuthToken if set,
+// otherwise "" (no auth) when bound to loopback. A server reachable from
+// other machines never runs without a token: one is generated and kept in
+// stateDir so that it survives restarts.
+func resolveToken(cfg *config.Config, stateDir string) (token string, generated bool, err error) {
+	if cfg.AuthToken != "" {
+		return cfg.AuthToken, false, nil
+	}
+	if isLoopback(cfg.BindAddress) {
+		return "", false, nil
+	}
+
+	path := filepath.Join(stateDir, tokenFile)
+	if data, err := os.ReadFile(path); err == nil {
+		if t := strings.TrimSpace(string(data)); t != "" {
+			return t, true, nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", false, fmt.Errorf("server: read token: %w", err)
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", false, fmt.Errorf("server: generate token: %w", err)
+	}
+	token = hex.EncodeToString(buf)
+	if err := os.MkdirAll(stateDir, 0o700); err != nil {
+		return "", false, fmt.Errorf("server: mkdir %s: %w", stateDir, err)
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0o600); err != nil {
+		return "", false, fmt.Errorf("server: write token: %w", err)
+	}
+	return token, true, nil
+}
+
+// ReadToken returns the token a client should send to a server using cfg and
+// stateDir: the configured authToken, or the one the server generated. It
+// returns "" when there is neither.
+func ReadToken(cfg *config.Config, stateDir string) string {
+	if cfg.AuthToken != "" {
+		return cfg.AuthToken
+	}
+	data, err := os.ReadFile(filepath.Join(stateDir, tokenFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// allowedHosts returns the host names requests may be addressed to: the
+// loopback names, the bind address, the machine's host name when listening
+// on every interface, and cfg.AllowedHosts.
+func allowedHosts(cfg *config.Config) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if !isUnspecified(cfg.BindAddress) {
+		hosts = append(hosts, cfg.BindAddress)
+	} else if name, err := os.Hostname(); err == nil {
+		hosts = append(hosts, name, name+".local")
+	}
+	hosts = append(hosts, cfg.AllowedHosts...)
+	for i, h := range hosts {
+		hosts[i] = strings.ToLower(h)
+	}
+	return hosts
+}
+
+// hostAllowed reports whether hostport (a Host header or the host part of an
+// Origin) names this server. Checking it defeats DNS rebinding, where a web
+// page on another domain resolves that domain to this machine. When
+// listening on every interface, any of the machine's current addresses is
+// accepted, so a laptop that changes networks keeps working.
+func (s *Server) hostAllowed(hostport string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	if slices.Contains(s.hosts, host) {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	// Loopback and unspecified literals only ever reach this machine's own
+	// listeners, and a rebinding attack always arrives under a domain name.
+	if ip.IsLoopback() || ip.IsUnspecified() {
+		return true
+	}
+	if !isUnspecified(s.bindAddr) {
+		return false
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// originAllowed reports whether r may be served given its Origin header.
+// Requests without one (curl, the CLI, same-origin GETs) are allowed; a
+// browser request from a page served by any other host is not.
+func (s *Server) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	return s.hostAllowed(u.Host)
+}
+
+// requestToken returns the token r carries, from the Authorization header,
+// the token cookie or the token query parameter, and whether it came from
+// the query.
+func requestToken(r *http.Request) (token string, fromQuery bool) {
+	if auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(auth), false
+	}
+	if c, err := r.Cookie(tokenCookie); err == nil {
+		return c.Value, false
+	}
+	return r.URL.Query().Get("token"), true
+}
+
+// guard wraps next with the checks every request must pass: the Host header
+// and any Origin must name this server, and when a token is required it must
+// be presented. A browser that opens the UI with ?token= is given a cookie
+// holding it, then redirected to the same page without the token in the URL.
+func (s *Server) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.hostAllowed(r.Host) {
+			http.Error(w, fmt.Sprintf("host %q not allowed; add it to allowedHosts", r.Host), http.StatusForbidden)
+			return
+		}
+		if !s.originAllowed(r) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+		if s.token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, fromQuery := requestToken(r)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="babble"`)
+			http.Error(w, "unauthorized: open the URL printed by babble serve, or send an Authorization: Bearer header", http.StatusUnauthorized)
+			return
+		}
+		if fromQuery {
+			http.SetCookie(w, &http.Cookie{
+				Name:     tokenCookie,
+				Value:    token,
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteStrictMode,
+			})
+			if r.Method == http.MethodGet && !strings.HasPrefix(r.URL.Path, "/api/") && r.URL.Path != "/ws" {
+				u := *r.URL
+				q := u.Query()
+				q.Del("token")
+				u.RawQuery = q.Encode()
+				http.Redirect(w, r, u.RequestURI(), http.StatusSeeOther)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
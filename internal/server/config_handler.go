@@ -1,45 +1,75 @@
 package server
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/dacort/babble/internal/config"
+	"github.com/dacort/babble/internal/jsonpatch"
 )
 
-// ConfigHandler serves GET and PUT /api/config, persisting configuration to
-// and from a JSON file on disk.
+// ConfigHandler serves GET, PUT and PATCH /api/config, persisting
+// configuration to and from a JSON file on disk.
+//
+// Responses carry an ETag derived from the config's contents. A PUT with an
+// If-Match header is only applied if the config has not changed since that
+// ETag was issued, so two tabs editing at once cannot silently overwrite
+// each other. The same applies to PATCH.
 type ConfigHandler struct {
 	configPath string
+	packsDir   string
+	onChange   func(*config.Config) // called after each successful save; may be nil
+
+	// mu serialises load-modify-save cycles within this process.
+	mu sync.Mutex
 }
 
 // NewConfigHandler returns a ConfigHandler that reads from and writes to the
-// file at configPath.
-func NewConfigHandler(configPath string) *ConfigHandler {
-	return &ConfigHandler{configPath: configPath}
+// file at configPath and validates activePack against the packs installed in
+// packsDir.
+func NewConfigHandler(configPath, packsDir string) *ConfigHandler {
+	return &ConfigHandler{configPath: configPath, packsDir: packsDir}
 }
 
 // HandleGet handles GET /api/config. It loads the current config from disk
 // (returning defaults when the file is absent) and writes it as JSON.
 func (h *ConfigHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
 	cfg, err := config.Load(h.configPath)
+	h.mu.Unlock()
 	if err != nil {
 		log.Printf("config: load %s: %v", h.configPath, err)
 		http.Error(w, "failed to load config", http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(cfg); err != nil {
-		log.Printf("config: encode response: %v", err)
-	}
+	writeConfig(w, cfg)
 }
 
 // HandleUpdate handles PUT /api/config. It decodes the JSON request body,
 // saves it to disk, and returns the updated config as JSON. Unknown fields in
-// the request body are silently ignored.
+// the request body are silently ignored. Once saved, the new config is passed to
+// onChange so that connected clients can be told about it.
+//
+// If the request has an If-Match header that does not match the current
+// ETag, nothing is saved and 412 Precondition Failed is returned. A config
+// that fails validation is rejected with 422 Unprocessable Entity and a JSON
+// body listing the offending fields:
+//
+//	{"errors":[{"field":"port","message":"must be between 1 and 65535, got 0"}]}
 func (h *ConfigHandler) HandleUpdate(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
 	cfg, err := config.Load(h.configPath)
 	if err != nil {
 		log.Printf("config: load for update %s: %v", h.configPath, err)
@@ -47,6 +77,10 @@ func (h *ConfigHandler) HandleUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !checkIfMatch(w, r, cfg) {
+		return
+	}
+
 	dec := json.NewDecoder(r.Body)
 	dec.DisallowUnknownFields()
 	if err := dec.Decode(cfg); err != nil {
@@ -54,14 +88,168 @@ func (h *ConfigHandler) HandleUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.save(w, cfg)
+}
+
+// Patch media types accepted by HandlePatch.
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+// HandlePatch handles PATCH /api/config, applying a targeted edit to the
+// current config rather than replacing it. The Content-Type selects the
+// patch format:
+//
+//   - application/merge-patch+json (or plain application/json): an RFC 7396
+//     merge patch, e.g. {"categoryVolumes":{"write":null}} removes one
+//     volume override.
+//   - application/json-patch+json: an RFC 6902 JSON Patch, e.g.
+//     [{"op":"add","path":"/mutedSessions/-","value":"api"}].
+//
+// Removing a top-level setting restores its default. The result is validated
+// and saved exactly as for PUT, including If-Match handling. A JSON Patch
+// whose "test" operation fails is rejected with 409 Conflict.
+func (h *ConfigHandler) HandlePatch(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var apply func(doc, patch []byte) ([]byte, error)
+	switch mediaType {
+	case mergePatchType, "application/json", "":
+		apply = jsonpatch.MergePatch
+	case jsonPatchType:
+		apply = jsonpatch.Apply
+	default:
+		w.Header().Set("Accept-Patch", mergePatchType+", "+jsonPatchType)
+		http.Error(w, "unsupported patch type "+strconv.Quote(mediaType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cfg, err := config.Load(h.configPath)
+	if err != nil {
+		log.Printf("config: load for patch %s: %v", h.configPath, err)
+		http.Error(w, "failed to load config", http.StatusInternalServerError)
+		return
+	}
+
+	if !checkIfMatch(w, r, cfg) {
+		return
+	}
+
+	doc, err := json.Marshal(cfg)
+	if err != nil {
+		log.Printf("config: marshal for patch: %v", err)
+		http.Error(w, "failed to load config", http.StatusInternalServerError)
+		return
+	}
+	patched, err := apply(doc, patch)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	cfg, err = config.Parse(patched)
+	if err != nil {
+		http.Error(w, "invalid patch result: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.save(w, cfg)
+}
+
+// save validates cfg, writes it to disk, notifies onChange, and responds
+// with the saved config. The caller must hold h.mu.
+func (h *ConfigHandler) save(w http.ResponseWriter, cfg *config.Config) {
+	if h.commit(w, cfg) {
+		writeConfig(w, cfg)
+	}
+}
+
+// commit validates cfg, writes it to disk and notifies onChange. On failure
+// it writes an error response and returns false. The caller must hold h.mu.
+func (h *ConfigHandler) commit(w http.ResponseWriter, cfg *config.Config) bool {
+	if err := cfg.Validate(h.packsDir); err != nil {
+		writeValidationError(w, err)
+		return false
+	}
+
 	if err := config.Save(cfg, h.configPath); err != nil {
 		log.Printf("config: save %s: %v", h.configPath, err)
 		http.Error(w, "failed to save config", http.StatusInternalServerError)
-		return
+		return false
 	}
+	if h.onChange != nil {
+		h.onChange(cfg)
+	}
+	return true
+}
 
+// writeConfig writes cfg as the JSON response body along with its ETag.
+func writeConfig(w http.ResponseWriter, cfg *config.Config) {
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", configETag(cfg))
 	if err := json.NewEncoder(w).Encode(cfg); err != nil {
-		log.Printf("config: encode update response: %v", err)
+		log.Printf("config: encode response: %v", err)
+	}
+}
+
+// writeValidationError reports err as 422 with the field-level errors as
+// JSON. Errors other than *config.ValidationError are reported as 400.
+func writeValidationError(w http.ResponseWriter, err error) {
+	var verr *config.ValidationError
+	if !errors.As(err, &verr) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	if err := json.NewEncoder(w).Encode(verr); err != nil {
+		log.Printf("config: encode validation errors: %v", err)
+	}
+}
+
+// configETag returns a strong ETag for cfg: a quoted hash of its JSON form.
+func configETag(cfg *config.Config) string {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return `""`
+	}
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// checkIfMatch reports whether r may modify cfg. When r carries an If-Match
+// header that does not match cfg's ETag it responds with 412 and the current
+// ETag, and returns false.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, cfg *config.Config) bool {
+	match := r.Header.Get("If-Match")
+	if match == "" || etagMatches(match, configETag(cfg)) {
+		return true
+	}
+	w.Header().Set("ETag", configETag(cfg))
+	http.Error(w, "config has changed since it was read", http.StatusPreconditionFailed)
+	return false
+}
+
+// etagMatches reports whether an If-Match header value matches etag. It
+// accepts "*" and comma-separated lists.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
 	}
+	return false
 }
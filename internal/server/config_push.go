@@ -0,0 +1,106 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/dacort/babble/internal/config"
+	"github.com/dacort/babble/internal/hub"
+	"github.com/dacort/babble/internal/redact"
+)
+
+// configPusher broadcasts a "config" message to every client whenever the
+// config changes, whether through PUT /api/config or an edit to the file on
+// disk. A save through the API also trips the file watcher, so each change is
+// compared with the last one sent and duplicates are suppressed.
+type configPusher struct {
+	hub *hub.Hub
+
+	mu   sync.Mutex
+	last []byte // JSON of the last config broadcast (or loaded at startup)
+}
+
+// newConfigPusher returns a configPusher that treats initial as already known
+// to clients, so nothing is broadcast until the config actually changes.
+func newConfigPusher(h *hub.Hub, initial *config.Config) *configPusher {
+	p := &configPusher{hub: h}
+	p.last, _ = json.Marshal(initial)
+	return p
+}
+
+// push broadcasts cfg unless it is identical to the last config pushed.
+func (p *configPusher) push(cfg *config.Config) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		log.Printf("server: marshal config: %v", err)
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if bytes.Equal(data, p.last) {
+		return
+	}
+	p.last = data
+	p.hub.Broadcast(hub.TypeConfig, json.RawMessage(data))
+}
+
+// applyConfig puts a changed config into effect: the redaction settings and
+// session aliases are swapped in for subsequent events, the event log's
+// retention is updated and the config is pushed to clients.
+func (s *Server) applyConfig(cfg *config.Config) {
+	s.redactor.Store(newRedactor(cfg))
+	s.namer.SetAliases(cfg.SessionAliases)
+	if s.store != nil {
+		s.store.SetRetention(retention(cfg))
+	}
+	s.config.push(cfg)
+}
+
+// newRedactor builds the redaction stage for cfg. Invalid settings, which
+// validation normally rules out, are logged and leave only the built-in
+// detectors in place.
+func newRedactor(cfg *config.Config) *redact.Redactor {
+	r, err := redact.New(cfg.RedactPatterns, cfg.DetailLevels, homeDir())
+	if err != nil {
+		log.Printf("server: %v — using built-in redaction only", err)
+		r, _ = redact.New(nil, nil, homeDir())
+	}
+	return r
+}
+
+// homeDir returns the user's home directory, or "" if it is unknown.
+func homeDir() string {
+	home, _ := os.UserHomeDir()
+	return home
+}
+
+// watchConfig starts reloading the config file whenever it changes on disk
+// and pushing the result to clients. Edits that fail validation are logged
+// and not pushed. Failure to watch is logged, not fatal: API updates are
+// still pushed.
+func (s *Server) watchConfig() {
+	w, err := config.Watch(s.configPath, func(cfg *config.Config) {
+		if err := cfg.Validate(s.packsDir); err != nil {
+			log.Printf("server: ignoring config file change: %v", err)
+			return
+		}
+		s.applyConfig(cfg)
+	})
+	if err != nil {
+		log.Printf("server: %v — config file edits will not be pushed to clients", err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.stop:
+		// Shutdown got here first.
+		w.Close()
+	default:
+		s.watcher = w
+	}
+}
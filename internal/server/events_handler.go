@@ -0,0 +1,140 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/dacort/babble/internal/config"
+	"github.com/dacort/babble/internal/events"
+	"github.com/dacort/babble/internal/hub"
+	"github.com/dacort/babble/internal/store"
+)
+
+// eventsDir is the directory in the state directory that holds the event log.
+const eventsDir = "events"
+
+const (
+	// defaultQueryLimit is the page size of GET /api/events without a limit.
+	defaultQueryLimit = 100
+	// maxQueryLimit is the largest page GET /api/events returns.
+	maxQueryLimit = 1000
+)
+
+// openStore opens the event log in stateDir if cfg enables it. Failure is
+// logged rather than fatal: the server still runs, without history.
+func openStore(cfg *config.Config, stateDir string) *store.Store {
+	if !cfg.EventLog {
+		return nil
+	}
+	st, err := store.Open(filepath.Join(stateDir, eventsDir), retention(cfg))
+	if err != nil {
+		log.Printf("server: %v — events will not be stored", err)
+		return nil
+	}
+	return st
+}
+
+// retention returns the event log retention policy set by cfg. Invalid
+// durations, which validation normally rules out, mean no age limit.
+func retention(cfg *config.Config) store.Retention {
+	return store.Retention{
+		MaxAge:   parseDuration("eventLogMaxAge", cfg.EventLogMaxAge),
+		MaxBytes: int64(cfg.EventLogMaxMB) << 20,
+	}
+}
+
+// eventsResponse is the JSON body returned by GET /api/events.
+type eventsResponse struct {
+	Events     []*events.BabbleEvent `json:"events"`
+	NextCursor string                `json:"nextCursor,omitempty"` // "" when there are no more
+}
+
+// handleEvents handles GET /api/events, a query over the event log. It takes
+// the event stream's filter parameters (session, category, host, event)
+// plus:
+//
+//   - since, until: a time range, as RFC 3339 times or as durations before
+//     now (since=2h);
+//   - limit: the page size, default 100, at most 1000;
+//   - cursor: the nextCursor of the previous page.
+//
+// Events are returned oldest first.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if s.store == nil {
+		http.Error(w, "the event log is disabled (eventLog is false)", http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+	filter := hub.FilterFromQuery(q)
+	if err := filter.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query := store.Query{Match: filter.Match, Limit: defaultQueryLimit}
+
+	var err error
+	now := time.Now()
+	if query.Since, err = timeParam(q, "since", now); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if query.Until, err = timeParam(q, "until", now); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxQueryLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxQueryLimit), http.StatusBadRequest)
+			return
+		}
+		query.Limit = n
+	}
+	if v := q.Get("cursor"); v != "" {
+		if query.After, err = strconv.ParseUint(v, 10, 64); err != nil {
+			http.Error(w, "invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	evs, more, err := s.store.Query(query)
+	if err != nil {
+		log.Printf("events: query: %v", err)
+		http.Error(w, "cannot read the event log", http.StatusInternalServerError)
+		return
+	}
+	resp := eventsResponse{Events: evs}
+	if resp.Events == nil {
+		resp.Events = []*events.BabbleEvent{}
+	}
+	if more {
+		resp.NextCursor = strconv.FormatUint(evs[len(evs)-1].Seq, 10)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("events: encode response: %v", err)
+	}
+}
+
+// timeParam parses the query parameter key as an RFC 3339 time or as a
+// duration before now. It returns the zero time if key is absent.
+func timeParam(q url.Values, key string, now time.Time) (time.Time, error) {
+	v := q.Get(key)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("%s must be an RFC 3339 time or a duration such as 2h, got %q", key, v)
+}
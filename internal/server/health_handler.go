@@ -0,0 +1,74 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Health is the JSON body returned by GET /api/health.
+type Health struct {
+	Status        string    `json:"status"`
+	Version       string    `json:"version"`
+	PID           int       `json:"pid"`
+	StartedAt     time.Time `json:"startedAt"`
+	Uptime        string    `json:"uptime"`
+	UptimeSeconds int64     `json:"uptimeSeconds"`
+	URL           string    `json:"url,omitempty"`    // where to open the UI; "" without TCP
+	Socket        string    `json:"socket,omitempty"` // "" without a Unix socket
+	Clients       int       `json:"clients"`
+}
+
+// SetVersion sets the version reported by GET /api/health.
+func (s *Server) SetVersion(v string) {
+	s.version = v
+}
+
+// handleHealth handles GET /api/health. It identifies the process as a
+// babble server and reports its version, PID, uptime and where to reach it,
+// so that a second babble serve or babble status can tell a running babble
+// from some other program holding the port.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	uptime := time.Since(s.started)
+	resp := Health{
+		Status:        "ok",
+		Version:       s.version,
+		PID:           os.Getpid(),
+		StartedAt:     s.started,
+		Uptime:        uptime.Round(time.Second).String(),
+		UptimeSeconds: int64(uptime.Seconds()),
+		URL:           s.BrowserURL(),
+		Clients:       s.hub.ClientCount(),
+	}
+	if s.listenUnix {
+		resp.Socket = s.socketPath
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("health: encode response: %v", err)
+	}
+}
+
+// shutdownRequest is closed when a client asks the server to stop.
+type shutdownRequest struct {
+	once sync.Once
+	ch   chan struct{}
+}
+
+// ShutdownRequested returns a channel that is closed when a client calls
+// POST /api/shutdown. The server does not stop by itself: whoever started
+// it should stop the event sources and call Shutdown, as on SIGTERM.
+func (s *Server) ShutdownRequested() <-chan struct{} {
+	return s.shutdownReq.ch
+}
+
+// handleShutdown handles POST /api/shutdown, used by babble stop.
+func (s *Server) handleShutdown(w http.ResponseWriter, r *http.Request) {
+	log.Printf("server: shutdown requested by client")
+	s.shutdownReq.once.Do(func() { close(s.shutdownReq.ch) })
+	w.WriteHeader(http.StatusAccepted)
+}
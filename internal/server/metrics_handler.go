@@ -0,0 +1,150 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dacort/babble/internal/metrics"
+	"github.com/dacort/babble/internal/registry"
+)
+
+var (
+	httpRequests = metrics.Default.CounterVec("babble_http_requests_total", "HTTP requests served, by route and status code.", "route", "code")
+	httpInFlight = metrics.Default.Gauge("babble_http_requests_in_flight", "HTTP requests being served, including open WebSocket and event streams.")
+)
+
+// unmatchedRoute labels requests that no route handled, such as those turned
+// away by the host, origin or token checks.
+const unmatchedRoute = "none"
+
+// newMetrics returns the registry of metrics that belong to s rather than to
+// the process: its queue, session registry, event log and start time.
+// GET /metrics writes them after metrics.Default.
+func (s *Server) newMetrics() *metrics.Registry {
+	r := metrics.NewRegistry()
+	r.GaugeFunc("babble_queue_length", "Events waiting in the server's queue.", func() float64 {
+		return float64(s.queue.Len())
+	})
+	r.GaugeFunc("babble_queue_capacity", "Capacity of the server's event queue (eventBuffer).", func() float64 {
+		return float64(s.queue.Size())
+	})
+	r.CounterFunc("babble_queue_dropped_total", "Events discarded by the queue's drop policy.", func() float64 {
+		return float64(s.queue.Dropped())
+	})
+	r.GaugeFunc("babble_registry_sessions", "Sessions seen since the server started.", func() float64 {
+		return float64(len(s.registry.Sessions()))
+	})
+	r.GaugeFunc("babble_registry_active_sessions", "Sessions that produced an event within idleTimeout.", func() float64 {
+		return float64(countActive(s.registry.Sessions()))
+	})
+	if s.store != nil {
+		r.GaugeFunc("babble_store_bytes", "Size of the event log on disk.", func() float64 {
+			return float64(s.store.Size())
+		})
+	}
+	r.GaugeFunc("babble_start_time_seconds", "When the server started, in seconds since the Unix epoch.", func() float64 {
+		return float64(s.started.UnixNano()) / float64(time.Second)
+	})
+	return r
+}
+
+// countActive returns how many of sessions are active.
+func countActive(sessions []registry.Session) int {
+	n := 0
+	for _, sess := range sessions {
+		if sess.State == registry.StateActive {
+			n++
+		}
+	}
+	return n
+}
+
+// handleMetrics handles GET /metrics, serving every metric in the Prometheus
+// text format.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metrics.ContentType)
+	if err := metrics.Default.WriteText(w); err != nil {
+		log.Printf("metrics: write response: %v", err)
+		return
+	}
+	if err := s.metrics.WriteText(w); err != nil {
+		log.Printf("metrics: write response: %v", err)
+	}
+}
+
+// instrument counts the requests next serves by route and status code.
+func instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpInFlight.Inc()
+		defer httpInFlight.Dec()
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		// ServeMux records the matched pattern on the request it routes.
+		route := r.Pattern
+		if route == "" {
+			route = unmatchedRoute
+		}
+		code := rec.code
+		if code == 0 {
+			code = http.StatusOK
+		}
+		httpRequests.With(route, strconv.Itoa(code)).Inc()
+	})
+}
+
+// statusRecorder remembers the status code written through it. It passes
+// Flush and Hijack through, which the event stream and WebSocket handlers
+// rely on.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (rec *statusRecorder) WriteHeader(code int) {
+	if rec.code == 0 {
+		rec.code = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+// Write implements http.ResponseWriter.
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.code == 0 {
+		rec.code = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher.
+func (rec *statusRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker. A hijacked connection is recorded as
+// 101 Switching Protocols, since that is what a WebSocket upgrade writes.
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("server: response does not support hijacking")
+	}
+	conn, rw, err := hj.Hijack()
+	if err == nil && rec.code == 0 {
+		rec.code = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
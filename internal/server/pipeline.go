@@ -0,0 +1,156 @@
+package server
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/dacort/babble/internal/events"
+	"github.com/dacort/babble/internal/hub"
+	"github.com/dacort/babble/internal/registry"
+)
+
+// dropReportInterval is how often the server checks the queue's drop counter
+// and notifies clients of newly dropped events.
+const dropReportInterval = time.Second
+
+// droppedData is the payload of the "dropped" message broadcast to clients
+// when events have been discarded by the queue's drop policy.
+type droppedData struct {
+	Count uint64 `json:"count"` // dropped since the previous notification
+	Total uint64 `json:"total"` // dropped since the server started
+}
+
+// snapshotData is the payload of the "snapshot" message sent to each client
+// when it connects, so that it can render known sessions and recent history
+// without waiting for new events.
+type snapshotData struct {
+	Sessions []registry.Session    `json:"sessions"`
+	Events   []*events.BabbleEvent `json:"events"`
+}
+
+// startPipeline launches the goroutines that move events from EventCh through
+// the bounded queue to the hub, plus the hub's own broadcast loop.
+//
+//	EventCh → pump → queue → drain (git, name, redact, seq, registry, store) → hub
+//
+// The pump never blocks on the hub, so a slow client cannot stall the session
+// manager's tailers (unless the drop policy is "block").
+func (s *Server) startPipeline() {
+	go s.hub.Run()
+	go s.pump()
+	go s.drain()
+	go s.reportDrops()
+}
+
+// pump moves events from EventCh into the queue until EventCh is closed.
+func (s *Server) pump() {
+	for ev := range s.eventCh {
+		s.queue.Push(ev)
+	}
+	s.queue.Close()
+}
+
+// drain adds git context to queued events, names their sessions, redacts and
+// numbers them, records them in the registry and the event log, and forwards
+// them to the hub. It closes the event log and the
+// hub's input channel once the queue has been closed and emptied.
+func (s *Server) drain() {
+	defer close(s.hubCh)
+	storeFailing := false
+	for {
+		ev, ok := s.queue.Pop()
+		if !ok {
+			break
+		}
+		s.addGit(ev)
+		s.nameSession(ev)
+		s.redactor.Load().Event(ev)
+		ev.Seq = s.seq.Add(1)
+		s.registry.Observe(ev)
+		if s.store != nil {
+			// Log only the first of a run of failures, such as a full disk.
+			err := s.store.Append(ev)
+			if err != nil && !storeFailing {
+				log.Printf("server: event log: %v", err)
+			}
+			storeFailing = err != nil
+		}
+		s.hubCh <- ev
+	}
+	if s.store != nil {
+		if err := s.store.Close(); err != nil {
+			log.Printf("server: event log: %v", err)
+		}
+	}
+}
+
+// addGit sets ev.Git to the working tree ev.Cwd is in, from s.git. A Bash
+// command that may switch branches makes the next event in that tree look
+// again: the command has not run yet when its tool_use is logged.
+func (s *Server) addGit(ev *events.BabbleEvent) {
+	if ev.Cwd == "" {
+		return
+	}
+	if info, ok := s.git.Lookup(ev.Cwd); ok {
+		ev.Git = &info
+	}
+	if switchesBranch(ev) {
+		s.git.Forget(ev.Cwd)
+	}
+}
+
+// switchesBranch reports whether ev runs git checkout or git switch.
+func switchesBranch(ev *events.BabbleEvent) bool {
+	if ev.Event != "Bash" || !ev.ToolUse {
+		return false
+	}
+	fields := strings.Fields(ev.Detail)
+	return len(fields) >= 2 && fields[0] == "git" && (fields[1] == "checkout" || fields[1] == "switch")
+}
+
+// nameSession replaces ev.Session, the last component of the working
+// directory, with a name no other live session shares. It runs before
+// redaction because it needs the real directory.
+func (s *Server) nameSession(ev *events.BabbleEvent) {
+	if ev.SessionID == "" {
+		return
+	}
+	cwd := ev.Cwd
+	if ev.IsSubagent {
+		cwd = "" // a subagent may work elsewhere; keep the session's own directory
+	}
+	if name := s.namer.Name(ev.SessionID, cwd); name != "" {
+		ev.Session = name
+	}
+}
+
+// reportDrops periodically broadcasts a "dropped" message whenever the queue's
+// drop counter has advanced, until Shutdown is called.
+func (s *Server) reportDrops() {
+	ticker := time.NewTicker(dropReportInterval)
+	defer ticker.Stop()
+
+	var last uint64
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+		total := s.queue.Dropped()
+		if total == last {
+			continue
+		}
+		s.hub.Broadcast(hub.TypeDropped, droppedData{Count: total - last, Total: total})
+		last = total
+	}
+}
+
+// snapshot builds the snapshot sent to newly connected clients.
+func (s *Server) snapshot() any {
+	return snapshotData{
+		Sessions: s.registry.Sessions(),
+		Events:   s.registry.Recent(s.snapEvents),
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/dacort/babble/internal/config"
+)
+
+// profilesData is the body of GET and PUT /api/profiles.
+type profilesData struct {
+	Active   string                    `json:"active"`
+	Profiles map[string]config.Profile `json:"profiles"`
+}
+
+// profilesResponse is the response to every /api/profiles request: the
+// profiles, plus the settings in effect with the active one applied.
+type profilesResponse struct {
+	profilesData
+	Effective *config.Config `json:"effective"`
+}
+
+// activateRequest is the body of PUT /api/profiles/active.
+type activateRequest struct {
+	Name string `json:"name"`
+}
+
+// HandleGetProfiles handles GET /api/profiles. It returns every profile, the
+// name of the active one ("" when none is) and the effective config, which is
+// the base config with that profile applied (see config.Config.Effective).
+func (h *ConfigHandler) HandleGetProfiles(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	cfg, err := config.Load(h.configPath)
+	h.mu.Unlock()
+	if err != nil {
+		log.Printf("config: load %s: %v", h.configPath, err)
+		http.Error(w, "failed to load config", http.StatusInternalServerError)
+		return
+	}
+
+	writeProfiles(w, cfg)
+}
+
+// HandlePutProfiles handles PUT /api/profiles, replacing every profile and
+// the active profile name with those in the request body. It is validated,
+// saved and pushed to clients like PUT /api/config, and honours If-Match
+// against the config's ETag.
+func (h *ConfigHandler) HandlePutProfiles(w http.ResponseWriter, r *http.Request) {
+	var body profilesData
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.Profiles == nil {
+		body.Profiles = map[string]config.Profile{}
+	}
+
+	h.updateProfiles(w, r, func(cfg *config.Config) {
+		cfg.Profiles = body.Profiles
+		cfg.ActiveProfile = body.Active
+	})
+}
+
+// HandleActivateProfile handles PUT /api/profiles/active, switching the
+// active profile live: {"name":"focus"} activates one and {"name":""} returns
+// to the base settings. Connected clients are sent the new config.
+func (h *ConfigHandler) HandleActivateProfile(w http.ResponseWriter, r *http.Request) {
+	var body activateRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.updateProfiles(w, r, func(cfg *config.Config) {
+		cfg.ActiveProfile = body.Name
+	})
+}
+
+// updateProfiles applies edit to the current config under h.mu, commits it,
+// and responds with the resulting profiles.
+func (h *ConfigHandler) updateProfiles(w http.ResponseWriter, r *http.Request, edit func(*config.Config)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cfg, err := config.Load(h.configPath)
+	if err != nil {
+		log.Printf("config: load for update %s: %v", h.configPath, err)
+		http.Error(w, "failed to load config", http.StatusInternalServerError)
+		return
+	}
+	if !checkIfMatch(w, r, cfg) {
+		return
+	}
+
+	edit(cfg)
+	if h.commit(w, cfg) {
+		writeProfiles(w, cfg)
+	}
+}
+
+// writeProfiles writes cfg's profiles and effective config as the JSON
+// response body, along with the config's ETag.
+func writeProfiles(w http.ResponseWriter, cfg *config.Config) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", configETag(cfg))
+	if err := json.NewEncoder(w).Encode(profilesResponse{
+		profilesData: profilesData{Active: cfg.ActiveProfile, Profiles: cfg.Profiles},
+		Effective:    cfg.Effective(),
+	}); err != nil {
+		log.Printf("config: encode profiles response: %v", err)
+	}
+}
@@ -3,14 +3,29 @@
 package server
 
 import (
-	"fmt"
+	"errors"
 	"io/fs"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/dacort/babble/internal/config"
 	"github.com/dacort/babble/internal/events"
+	"github.com/dacort/babble/internal/gitinfo"
 	"github.com/dacort/babble/internal/hub"
+	"github.com/dacort/babble/internal/metrics"
+	"github.com/dacort/babble/internal/naming"
+	"github.com/dacort/babble/internal/queue"
+	"github.com/dacort/babble/internal/redact"
+	"github.com/dacort/babble/internal/registry"
+	"github.com/dacort/babble/internal/store"
 )
 
 // Server holds the HTTP server configuration and the components it connects.
@@ -18,26 +33,173 @@ type Server struct {
 	port       int
 	hub        *hub.Hub
 	eventCh    chan *events.BabbleEvent
+	hubCh      chan *events.BabbleEvent
+	queue      *queue.Queue
+	registry   *registry.Registry
+	namer      *naming.Namer
+	git        *gitinfo.Cache
+	store      *store.Store  // nil if the event log is disabled or failed to open
+	seq        atomic.Uint64 // last Seq assigned; only the drain goroutine writes it
+	redactor   atomic.Pointer[redact.Redactor]
+	metrics    *metrics.Registry // per-server metrics; see newMetrics
+	snapEvents int
 	staticFS   fs.FS
 	packsDir   string
 	configPath string
+	stateDir   string
+	logsDir    string // Claude Code session logs; see SetLogsDir
+	config     *configPusher
+
+	// Listener settings, fixed at startup.
+	bindAddr      string
+	hosts         []string // host names requests may be addressed to
+	token         string   // required from clients unless ""
+	tlsCert       string
+	tlsKey        string
+	tlsSelfSigned bool
+	listenTCP     bool
+	listenUnix    bool
+	socketPath    string
+	setupErr      error // failure to prepare the token; returned by Start
+
+	version     string
+	started     time.Time
+	shutdownReq shutdownRequest
+
+	httpSrv   *http.Server  // TCP: guarded by host, origin and token checks
+	unixSrv   *http.Server  // Unix socket: protected by file permissions
+	stop      chan struct{} // closed by Shutdown to stop background goroutines
+	closeOnce sync.Once
+
+	mu      sync.Mutex
+	watcher *config.Watcher // nil until watching starts, or if it failed
 }
 
 // New creates a Server that listens on port, serves static files from
 // staticFS, serves sound packs from packsDir, and persists user configuration
-// to configPath. It allocates a buffered event channel (capacity 100) and
-// constructs the Hub that reads from it.
-func New(port int, staticFS fs.FS, packsDir string, configPath string) *Server {
-	eventCh := make(chan *events.BabbleEvent, 100)
-	h := hub.New(eventCh)
-	return &Server{
+// to configPath. Events sent on EventCh pass through a bounded queue, sized
+// and governed by the eventBuffer and dropPolicy settings in the config file,
+// before reaching the Hub. Each event is tagged with the git branch its
+// session is on, and sessions are named apart (see package naming), with the
+// sessionAliases setting. A session registry observes every event so that
+// newly connected clients can be sent a snapshot of current state. Event
+// details are redacted per the redactPatterns and detailLevels settings
+// before any of that happens. Unless the eventLog setting turns it off, every
+// event is also appended to a log in stateDir that GET /api/events queries.
+// Changes to the config, through the API or the file itself, are pushed to
+// all clients.
+//
+// The listen, bindAddress, TLS and authToken settings decide where and how it
+// listens; the Unix socket, a generated token and a self-signed certificate
+// are kept in stateDir by default. They take effect only at startup.
+func New(port int, staticFS fs.FS, packsDir, configPath, stateDir string) *Server {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		log.Printf("server: %v — using defaults", err)
+		cfg = config.Default()
+	}
+	policy, err := queue.ParsePolicy(cfg.DropPolicy)
+	if err != nil {
+		log.Printf("server: %v — using %s", err, queue.PolicyDropOldest)
+		policy = queue.PolicyDropOldest
+	}
+
+	hubCh := make(chan *events.BabbleEvent)
+	h := hub.New(hubCh)
+	h.SetTimeouts(hub.Timeouts{
+		Write: parseDuration("writeTimeout", cfg.WriteTimeout),
+		Pong:  parseDuration("pongTimeout", cfg.PongTimeout),
+		Ping:  parseDuration("pingInterval", cfg.PingInterval),
+	})
+
+	idleAfter := parseDuration("idleTimeout", cfg.IdleTimeout)
+	if idleAfter == 0 {
+		idleAfter = 5 * time.Minute
+	}
+
+	s := &Server{
 		port:       port,
 		hub:        h,
-		eventCh:    eventCh,
+		eventCh:    make(chan *events.BabbleEvent),
+		hubCh:      hubCh,
+		queue:      queue.New(cfg.EventBuffer, policy),
+		registry:   registry.New(cfg.HistoryEvents, idleAfter),
+		git:        gitinfo.NewCache(),
+		snapEvents: cfg.SnapshotEvents,
 		staticFS:   staticFS,
 		packsDir:   packsDir,
 		configPath: configPath,
+		stateDir:   stateDir,
+		stop:       make(chan struct{}),
+		started:    time.Now(),
+
+		bindAddr:      cfg.BindAddress,
+		hosts:         allowedHosts(cfg),
+		tlsCert:       cfg.TLSCert,
+		tlsKey:        cfg.TLSKey,
+		tlsSelfSigned: cfg.TLSSelfSigned,
+		listenTCP:     cfg.Listen != "unix",
+		listenUnix:    cfg.Listen != "tcp",
+		socketPath:    SocketPath(cfg, stateDir),
+	}
+	s.shutdownReq.ch = make(chan struct{})
+	s.namer = naming.New(homeDir(), cfg.SessionAliases, s.git.Lookup)
+	token, generated, err := resolveToken(cfg, stateDir)
+	if err != nil {
+		s.setupErr = err
+	}
+	s.token = token
+	if generated {
+		log.Printf("server: listening beyond loopback; clients must present the token in %s", filepath.Join(stateDir, tokenFile))
+	}
+
+	if s.store = openStore(cfg, stateDir); s.store != nil {
+		s.seq.Store(s.store.LastSeq())
+	}
+	s.redactor.Store(newRedactor(cfg))
+	s.metrics = s.newMetrics()
+	s.config = newConfigPusher(h, cfg)
+	mux := s.buildMux()
+	s.httpSrv = &http.Server{Handler: instrument(s.guard(mux))}
+	s.unixSrv = &http.Server{Handler: instrument(mux)}
+	h.SetSnapshot(s.snapshot)
+	h.SetCheckOrigin(s.originAllowed)
+	return s
+}
+
+// BrowserURL returns the URL to open the UI at, including the auth token
+// when one is required, or "" if the server only listens on its Unix socket.
+func (s *Server) BrowserURL() string {
+	if !s.listenTCP {
+		return ""
+	}
+	scheme := "http"
+	if s.tlsCert != "" || s.tlsSelfSigned {
+		scheme = "https"
+	}
+	host := s.bindAddr
+	if isLoopback(host) || isUnspecified(host) {
+		host = "localhost"
+	}
+	u := url.URL{Scheme: scheme, Host: net.JoinHostPort(host, strconv.Itoa(s.port)), Path: "/"}
+	if s.token != "" {
+		u.RawQuery = url.Values{"token": {s.token}}.Encode()
+	}
+	return u.String()
+}
+
+// parseDuration parses the config setting named name. Invalid values are
+// logged and returned as zero so that the consumer's default applies.
+func parseDuration(name, value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("server: invalid %s %q: %v — using default", name, value, err)
+		return 0
 	}
+	return d
 }
 
 // EventCh returns a send-only channel that callers (e.g. the session manager)
@@ -49,40 +211,138 @@ func (s *Server) EventCh() chan<- *events.BabbleEvent {
 // buildMux constructs the HTTP multiplexer with all routes registered.
 func (s *Server) buildMux() *http.ServeMux {
 	packsHandler := NewPacksHandler(s.packsDir)
-	configHandler := NewConfigHandler(s.configPath)
+	configHandler := NewConfigHandler(s.configPath, s.packsDir)
+	configHandler.onChange = s.applyConfig
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/ws", s.hub.HandleWS)
 	mux.HandleFunc("GET /api/config", configHandler.HandleGet)
 	mux.HandleFunc("PUT /api/config", configHandler.HandleUpdate)
+	mux.HandleFunc("PATCH /api/config", configHandler.HandlePatch)
+	mux.HandleFunc("GET /api/profiles", configHandler.HandleGetProfiles)
+	mux.HandleFunc("PUT /api/profiles", configHandler.HandlePutProfiles)
+	mux.HandleFunc("PUT /api/profiles/active", configHandler.HandleActivateProfile)
 	mux.HandleFunc("GET /api/packs", packsHandler.HandleList)
 	mux.HandleFunc("GET /api/packs/{name}/manifest", packsHandler.HandleManifest)
+	mux.HandleFunc("GET /api/health", s.handleHealth)
+	mux.HandleFunc("POST /api/shutdown", s.handleShutdown)
+	mux.HandleFunc("GET /api/stats", s.handleStats)
+	mux.HandleFunc("GET /api/clients", s.handleClients)
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+	mux.HandleFunc("GET /api/events", s.handleEvents)
+	mux.HandleFunc("GET /api/events/stream", s.handleEventStream)
+	mux.HandleFunc("GET /api/sessions", s.handleSessions)
+	mux.HandleFunc("GET /api/sessions/{id}", s.handleSession)
+	mux.HandleFunc("GET /api/sessions/{id}/summary", s.handleSessionSummary)
 	mux.Handle("/sounds/", packsHandler.SoundsFS())
 	mux.Handle("/", http.FileServer(http.FS(s.staticFS)))
 	return mux
 }
 
-// Start launches the hub's broadcast loop in a background goroutine, registers
-// the HTTP routes, and begins listening on s.port. It blocks until the server
-// encounters a fatal error, which it returns.
+// Start launches the event pipeline and the hub's broadcast loop, registers
+// the HTTP routes, and begins listening on the configured bind address and
+// s.port, on the Unix socket, or both, per the listen setting. It blocks
+// until the server encounters a fatal error, which it returns, or until
+// Shutdown is called, in which case it returns nil.
 func (s *Server) Start() error {
-	go s.hub.Run()
-
-	addr := fmt.Sprintf(":%d", s.port)
-	ln, err := net.Listen("tcp", addr)
-	if err != nil {
-		return err
+	if s.setupErr != nil {
+		return s.setupErr
 	}
-	log.Printf("server: listening on http://localhost%s", addr)
-	return http.Serve(ln, s.buildMux())
+	var ln net.Listener
+	if s.listenTCP {
+		var err error
+		ln, err = net.Listen("tcp", net.JoinHostPort(s.bindAddr, strconv.Itoa(s.port)))
+		if err != nil {
+			return err
+		}
+	}
+	return s.serve(ln)
 }
 
-// StartWithListener launches the hub's broadcast loop in a background
-// goroutine, registers the HTTP routes, and serves requests using ln. This
+// StartWithListener launches the event pipeline and the hub's broadcast loop,
+// registers the HTTP routes, and serves requests using ln in place of the
+// TCP listener (plus the Unix socket, if configured). This
 // allows tests to supply a net.Listener on a random OS-assigned port (":0").
-// It blocks until the server encounters a fatal error, which it returns.
+// It blocks until the server encounters a fatal error, which it returns, or
+// until Shutdown is called, in which case it returns nil.
 func (s *Server) StartWithListener(ln net.Listener) error {
-	go s.hub.Run()
-	log.Printf("server: listening on http://%s", ln.Addr())
-	return http.Serve(ln, s.buildMux())
+	if s.setupErr != nil {
+		return s.setupErr
+	}
+	return s.serve(ln)
+}
+
+// serve starts the pipeline and config watcher, then serves HTTP on tcp (if
+// not nil), over TLS if configured, and on the Unix socket if configured.
+// tcp is closed if serving cannot start, and both servers are closed as soon
+// as either fails.
+func (s *Server) serve(tcp net.Listener) error {
+	fail := func(err error) error {
+		if tcp != nil {
+			tcp.Close()
+		}
+		return err
+	}
+	certFile, keyFile, err := s.tlsFiles()
+	if err != nil {
+		return fail(err)
+	}
+	var unix net.Listener
+	if s.listenUnix {
+		if unix, err = listenUnix(s.socketPath); err != nil {
+			return fail(err)
+		}
+	}
+
+	s.startPipeline()
+	s.watchConfig()
+
+	errc := make(chan error, 2)
+	running := 0
+	if tcp != nil {
+		scheme := "http"
+		if certFile != "" {
+			scheme = "https"
+		}
+		log.Printf("server: listening on %s://%s", scheme, tcp.Addr())
+		running++
+		go func() {
+			if certFile != "" {
+				errc <- s.httpSrv.ServeTLS(tcp, certFile, keyFile)
+			} else {
+				errc <- s.httpSrv.Serve(tcp)
+			}
+		}()
+	}
+	if unix != nil {
+		log.Printf("server: listening on %s", s.socketPath)
+		running++
+		go func() { errc <- s.unixSrv.Serve(unix) }()
+	}
+
+	for range running {
+		if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+			// Leave neither listener serving a server that has failed.
+			s.httpSrv.Close()
+			s.unixSrv.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+// tlsFiles returns the certificate and key to serve with, generating a
+// self-signed pair in the state directory if configured, or "" for plain
+// HTTP.
+func (s *Server) tlsFiles() (certFile, keyFile string, err error) {
+	switch {
+	case s.tlsCert != "":
+		return s.tlsCert, s.tlsKey, nil
+	case s.tlsSelfSigned:
+		hosts := slices.DeleteFunc(slices.Clone(s.hosts), func(h string) bool {
+			return isUnspecified(h)
+		})
+		return ensureSelfSignedCert(s.stateDir, hosts)
+	}
+	return "", "", nil
 }
@@ -1,12 +1,20 @@
 package server_test
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
+	"io"
+	"maps"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
 	"testing"
 	"testing/fstest"
@@ -14,7 +22,10 @@ import (
 
 	"github.com/gorilla/websocket"
 
+	"github.com/dacort/babble/internal/config"
 	"github.com/dacort/babble/internal/events"
+	"github.com/dacort/babble/internal/registry"
+	"github.com/dacort/babble/internal/report"
 	"github.com/dacort/babble/internal/server"
 	"github.com/dacort/babble/internal/sessions"
 )
@@ -88,7 +99,7 @@ func TestEndToEnd(t *testing.T) {
 	staticFS := fstest.MapFS{
 		"index.html": &fstest.MapFile{Data: []byte("<html><body>babble</body></html>")},
 	}
-	srv := server.New(0, staticFS, packsDir, configPath)
+	srv := server.New(0, staticFS, packsDir, configPath, t.TempDir())
 
 	// --- 6 & 7. Start session manager and server ----------------------------
 	// Bind the listener first so we know the actual port before starting.
@@ -112,6 +123,29 @@ func TestEndToEnd(t *testing.T) {
 	// --- 8. Connect a WebSocket client --------------------------------------
 	conn := dialWS(t, wsURL(addr, "/ws"))
 
+	// A second client negotiates protocol v1, so every message arrives in an
+	// envelope and the first one is the snapshot of current state — empty,
+	// because no events have been written yet.
+	connV1 := dialWS(t, wsURL(addr, "/ws?v=1"))
+	connV1.SetReadDeadline(time.Now().Add(5 * time.Second)) //nolint:errcheck
+	var snap struct {
+		V    int    `json:"v"`
+		Type string `json:"type"`
+		Data struct {
+			Sessions []json.RawMessage `json:"sessions"`
+			Events   []json.RawMessage `json:"events"`
+		} `json:"data"`
+	}
+	if err := connV1.ReadJSON(&snap); err != nil {
+		t.Fatalf("read snapshot: %v", err)
+	}
+	if snap.V != 1 || snap.Type != "snapshot" {
+		t.Fatalf("first v1 message = v%d %q, want v1 %q", snap.V, snap.Type, "snapshot")
+	}
+	if len(snap.Data.Sessions) != 0 || len(snap.Data.Events) != 0 {
+		t.Errorf("snapshot = %d sessions, %d events; want empty", len(snap.Data.Sessions), len(snap.Data.Events))
+	}
+
 	// Give the hub a moment to register the new client before writing an event.
 	time.Sleep(50 * time.Millisecond)
 
@@ -151,6 +185,19 @@ func TestEndToEnd(t *testing.T) {
 		t.Errorf("detail = %q, want %q", got.Detail, "main.go")
 	}
 
+	// The v1 client receives the same event wrapped in an envelope.
+	var env struct {
+		V    int                `json:"v"`
+		Type string             `json:"type"`
+		Data events.BabbleEvent `json:"data"`
+	}
+	if err := connV1.ReadJSON(&env); err != nil {
+		t.Fatalf("read v1 event: %v", err)
+	}
+	if env.V != 1 || env.Type != "event" || env.Data.Event != "Edit" {
+		t.Errorf("v1 message = v%d %q %q, want v1 \"event\" \"Edit\"", env.V, env.Type, env.Data.Event)
+	}
+
 	// --- 12. HTTP endpoint checks -------------------------------------------
 	t.Run("GET / returns 200", func(t *testing.T) {
 		resp, err := http.Get(httpURL(addr, "/"))
@@ -187,6 +234,53 @@ func TestEndToEnd(t *testing.T) {
 		}
 	})
 
+	t.Run("GET /api/stats reports queue", func(t *testing.T) {
+		resp, err := http.Get(httpURL(addr, "/api/stats"))
+		if err != nil {
+			t.Fatalf("GET /api/stats: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+		}
+		var stats struct {
+			Queue struct {
+				Size    int    `json:"size"`
+				Policy  string `json:"policy"`
+				Dropped uint64 `json:"dropped"`
+			} `json:"queue"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+			t.Fatalf("decode stats: %v", err)
+		}
+		if stats.Queue.Size != 100 {
+			t.Errorf("queue.size = %d, want 100", stats.Queue.Size)
+		}
+		if stats.Queue.Policy != "drop-oldest" {
+			t.Errorf("queue.policy = %q, want %q", stats.Queue.Policy, "drop-oldest")
+		}
+	})
+
+	t.Run("GET /api/clients lists the WebSocket clients", func(t *testing.T) {
+		resp, err := http.Get(httpURL(addr, "/api/clients"))
+		if err != nil {
+			t.Fatalf("GET /api/clients: %v", err)
+		}
+		defer resp.Body.Close()
+		var clients []map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&clients); err != nil {
+			t.Fatalf("decode clients: %v", err)
+		}
+		if len(clients) != 2 {
+			t.Fatalf("len(clients) = %d, want 2", len(clients))
+		}
+		for _, field := range []string{"id", "remoteAddr", "connectedAt", "lastSeen", "idleSeconds"} {
+			if _, ok := clients[0][field]; !ok {
+				t.Errorf("client missing field %q", field)
+			}
+		}
+	})
+
 	t.Run("GET /api/config returns JSON object", func(t *testing.T) {
 		resp, err := http.Get(httpURL(addr, "/api/config"))
 		if err != nil {
@@ -211,3 +305,1449 @@ func TestEndToEnd(t *testing.T) {
 		}
 	})
 }
+
+// startTestServer starts a Server with empty temp packs and config
+// directories on a random port and returns it with its address.
+func startTestServer(t *testing.T) (*server.Server, string) {
+	t.Helper()
+	return startTestServerWithConfig(t, filepath.Join(t.TempDir(), "config.json"))
+}
+
+// startTestServerWithConfig is like startTestServer but persists config to
+// configPath.
+func startTestServerWithConfig(t *testing.T, configPath string) (*server.Server, string) {
+	t.Helper()
+	staticFS := fstest.MapFS{
+		"index.html": &fstest.MapFile{Data: []byte("<html></html>")},
+	}
+	packsDir := t.TempDir()
+	writeTestPacks(t, packsDir, "default", "retro")
+	srv := server.New(0, staticFS, packsDir, configPath, t.TempDir())
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() { _ = srv.StartWithListener(ln) }()
+	return srv, ln.Addr().String()
+}
+
+// writeTestPacks installs a minimal pack for each name under packsDir.
+func writeTestPacks(t *testing.T, packsDir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		dir := filepath.Join(packsDir, name)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("mkdir pack %s: %v", name, err)
+		}
+		manifest := fmt.Sprintf(`{"name":%q,"categories":{}}`, name)
+		if err := os.WriteFile(filepath.Join(dir, "pack.json"), []byte(manifest), 0o644); err != nil {
+			t.Fatalf("write pack.json: %v", err)
+		}
+	}
+}
+
+// sseMessage is one parsed Server-Sent Events message.
+type sseMessage struct {
+	id, event, data string
+}
+
+// readSSE reads the next non-comment message from an event stream.
+func readSSE(t *testing.T, r *bufio.Reader) sseMessage {
+	t.Helper()
+	var msg sseMessage
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read event stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			if msg != (sseMessage{}) {
+				return msg
+			}
+		case strings.HasPrefix(line, ":"):
+			// Comment (keepalive).
+		case strings.HasPrefix(line, "id: "):
+			msg.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			msg.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			msg.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+// TestEventStream verifies GET /api/events/stream: query-string filtering of
+// live events and Last-Event-ID resume from the server's history.
+func TestEventStream(t *testing.T) {
+	srv, addr := startTestServer(t)
+
+	send := func(cat events.Category, name string) {
+		srv.EventCh() <- &events.BabbleEvent{Session: "api", Category: cat, Event: name}
+	}
+
+	// Seed some history before anyone is listening: seq 1..3.
+	send(events.CategoryRead, "Read")
+	send(events.CategoryError, "tool_result")
+	send(events.CategoryWrite, "Edit")
+	// Wait until they have been recorded, so the first stream sees them as
+	// history rather than live.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp, err := http.Get(httpURL(addr, "/api/events"))
+		if err != nil {
+			t.Fatalf("GET /api/events: %v", err)
+		}
+		var page struct {
+			Events []events.BabbleEvent `json:"events"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("decode events: %v", err)
+		}
+		if len(page.Events) == 3 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Run("filters live events", func(t *testing.T) {
+		resp, err := http.Get(httpURL(addr, "/api/events/stream?category=error"))
+		if err != nil {
+			t.Fatalf("GET stream: %v", err)
+		}
+		defer resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Errorf("Content-Type = %q, want text/event-stream", ct)
+		}
+
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			send(events.CategoryRead, "Grep")
+			send(events.CategoryError, "tool_result")
+		}()
+
+		msg := readSSE(t, bufio.NewReader(resp.Body))
+		var got events.BabbleEvent
+		if err := json.Unmarshal([]byte(msg.data), &got); err != nil {
+			t.Fatalf("unmarshal data: %v (raw: %s)", err, msg.data)
+		}
+		if got.Category != events.CategoryError {
+			t.Errorf("category = %q, want %q", got.Category, events.CategoryError)
+		}
+		if msg.id != fmt.Sprint(got.Seq) || got.Seq != 5 {
+			t.Errorf("id = %q, seq = %d; want both 5", msg.id, got.Seq)
+		}
+	})
+
+	t.Run("resumes from Last-Event-ID", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, httpURL(addr, "/api/events/stream"), nil)
+		req.Header.Set("Last-Event-ID", "3")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET stream: %v", err)
+		}
+		defer resp.Body.Close()
+
+		r := bufio.NewReader(resp.Body)
+		for _, want := range []string{"4", "5"} {
+			if msg := readSSE(t, r); msg.id != want {
+				t.Errorf("replayed id = %q, want %q", msg.id, want)
+			}
+		}
+	})
+
+	t.Run("resets on an id from a previous run", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, httpURL(addr, "/api/events/stream"), nil)
+		req.Header.Set("Last-Event-ID", "5000")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET stream: %v", err)
+		}
+		defer resp.Body.Close()
+
+		r := bufio.NewReader(resp.Body)
+		if msg := readSSE(t, r); msg.event != "gap" {
+			t.Errorf("first message = %+v, want a gap event", msg)
+		}
+		for _, want := range []string{"1", "2", "3", "4", "5"} {
+			if msg := readSSE(t, r); msg.id != want {
+				t.Errorf("replayed id = %q, want %q", msg.id, want)
+			}
+		}
+		send(events.CategoryAction, "Bash")
+		if msg := readSSE(t, r); msg.id != "6" {
+			t.Errorf("live id = %q, want 6", msg.id)
+		}
+	})
+
+	t.Run("rejects malformed Last-Event-ID", func(t *testing.T) {
+		resp, err := http.Get(httpURL(addr, "/api/events/stream?lastEventId=abc"))
+		if err != nil {
+			t.Fatalf("GET stream: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+		}
+	})
+}
+
+// TestConfigPush verifies that config changes made through PUT /api/config
+// and by editing the file directly are both pushed to WebSocket clients, and
+// that the API save is not pushed a second time when the watcher sees it.
+func TestConfigPush(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	_, addr := startTestServerWithConfig(t, configPath)
+
+	conn := dialWS(t, wsURL(addr, "/ws?v=1"))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second)) //nolint:errcheck
+
+	nextConfig := func() map[string]any {
+		t.Helper()
+		for {
+			var env struct {
+				Type string         `json:"type"`
+				Data map[string]any `json:"data"`
+			}
+			if err := conn.ReadJSON(&env); err != nil {
+				t.Fatalf("read config message: %v", err)
+			}
+			if env.Type == "config" {
+				return env.Data
+			}
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodPut, httpURL(addr, "/api/config"),
+		strings.NewReader(`{"activePack":"retro"}`))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PUT /api/config: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT /api/config: status %d", resp.StatusCode)
+	}
+	if got := nextConfig()["activePack"]; got != "retro" {
+		t.Errorf("after PUT: activePack = %v, want retro", got)
+	}
+
+	// Let the watcher see (and suppress) the API save before editing by hand.
+	time.Sleep(300 * time.Millisecond)
+	if err := os.WriteFile(configPath, []byte(`{"activePack":"default","idleTimeout":"2m"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := nextConfig()["idleTimeout"]; got != "2m" {
+		t.Errorf("after file edit: idleTimeout = %v, want 2m", got)
+	}
+}
+
+// TestConfigUpdate verifies ETag/If-Match concurrency control and
+// field-level validation errors on PUT /api/config.
+func TestConfigUpdate(t *testing.T) {
+	_, addr := startTestServer(t)
+
+	put := func(body, ifMatch string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPut, httpURL(addr, "/api/config"), strings.NewReader(body))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("PUT /api/config: %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp, err := http.Get(httpURL(addr, "/api/config"))
+	if err != nil {
+		t.Fatalf("GET /api/config: %v", err)
+	}
+	resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("GET /api/config: missing ETag")
+	}
+
+	t.Run("If-Match current ETag succeeds", func(t *testing.T) {
+		resp := put(`{"activePack":"retro"}`, etag)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+		}
+		if got := resp.Header.Get("ETag"); got == "" || got == etag {
+			t.Errorf("ETag after update = %q, want a new value", got)
+		}
+	})
+
+	t.Run("stale If-Match is rejected", func(t *testing.T) {
+		resp := put(`{"activePack":"default"}`, etag)
+		if resp.StatusCode != http.StatusPreconditionFailed {
+			t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusPreconditionFailed)
+		}
+	})
+
+	t.Run("invalid values are reported per field", func(t *testing.T) {
+		resp := put(`{"port":70000,"activePack":"missing","idleTimeout":"soon","categoryVolumes":{"write":1.5}}`, "")
+		if resp.StatusCode != http.StatusUnprocessableEntity {
+			t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusUnprocessableEntity)
+		}
+		var body struct {
+			Errors []struct {
+				Field string `json:"field"`
+			} `json:"errors"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("decode errors: %v", err)
+		}
+		var fields []string
+		for _, e := range body.Errors {
+			fields = append(fields, e.Field)
+		}
+		want := []string{"port", "categoryVolumes.write", "idleTimeout", "activePack"}
+		if strings.Join(fields, ",") != strings.Join(want, ",") {
+			t.Errorf("fields = %v, want %v", fields, want)
+		}
+	})
+}
+
+// TestConfigPatch verifies PATCH /api/config with merge patches and JSON
+// Patches.
+func TestConfigPatch(t *testing.T) {
+	_, addr := startTestServer(t)
+
+	patch := func(contentType, body string) (*http.Response, map[string]any) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPatch, httpURL(addr, "/api/config"), strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("PATCH /api/config: %v", err)
+		}
+		defer resp.Body.Close()
+		var cfg map[string]any
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&cfg); err != nil {
+				t.Fatalf("decode config: %v", err)
+			}
+		}
+		return resp, cfg
+	}
+
+	t.Run("merge patch sets and removes map keys", func(t *testing.T) {
+		resp, _ := patch("application/merge-patch+json", `{"categoryVolumes":{"write":0.2,"error":0.9}}`)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+		}
+		resp, cfg := patch("application/merge-patch+json", `{"categoryVolumes":{"write":null}}`)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+		}
+		vols := cfg["categoryVolumes"].(map[string]any)
+		if _, ok := vols["write"]; ok || vols["error"] != 0.9 {
+			t.Errorf("categoryVolumes = %v, want only error: 0.9", vols)
+		}
+	})
+
+	t.Run("plain JSON is a merge patch", func(t *testing.T) {
+		resp, cfg := patch("application/json", `{"activePack":"retro"}`)
+		if resp.StatusCode != http.StatusOK || cfg["activePack"] != "retro" {
+			t.Errorf("status = %d, activePack = %v; want 200, retro", resp.StatusCode, cfg["activePack"])
+		}
+	})
+
+	t.Run("JSON Patch appends to a list", func(t *testing.T) {
+		body := `[{"op":"add","path":"/mutedSessions/-","value":"api"},{"op":"add","path":"/mutedSessions/-","value":"web"}]`
+		resp, cfg := patch("application/json-patch+json", body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+		}
+		if got := fmt.Sprint(cfg["mutedSessions"]); got != "[api web]" {
+			t.Errorf("mutedSessions = %s, want [api web]", got)
+		}
+	})
+
+	t.Run("failed test op conflicts", func(t *testing.T) {
+		resp, _ := patch("application/json-patch+json", `[{"op":"test","path":"/activePack","value":"default"},{"op":"replace","path":"/port","value":4000}]`)
+		if resp.StatusCode != http.StatusConflict {
+			t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusConflict)
+		}
+	})
+
+	t.Run("result is validated", func(t *testing.T) {
+		for _, body := range []string{`{"categoryVolumes":{"warn":2}}`, `{"dropPolicy":"bogus"}`, `{"historyEvents":-1}`} {
+			resp, _ := patch("application/merge-patch+json", body)
+			if resp.StatusCode != http.StatusUnprocessableEntity {
+				t.Errorf("%s: status = %d, want %d", body, resp.StatusCode, http.StatusUnprocessableEntity)
+			}
+		}
+	})
+
+	t.Run("unknown fields are rejected", func(t *testing.T) {
+		resp, _ := patch("application/merge-patch+json", `{"prot":4000}`)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("unsupported media type", func(t *testing.T) {
+		resp, _ := patch("text/plain", `port=4000`)
+		if resp.StatusCode != http.StatusUnsupportedMediaType {
+			t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusUnsupportedMediaType)
+		}
+	})
+}
+
+// TestProfiles verifies GET/PUT /api/profiles and that switching the active
+// profile is pushed to WebSocket clients.
+func TestProfiles(t *testing.T) {
+	_, addr := startTestServer(t)
+
+	conn := dialWS(t, wsURL(addr, "/ws?v=1"))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second)) //nolint:errcheck
+
+	put := func(path, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPut, httpURL(addr, path), strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("PUT %s: %v", path, err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp := put("/api/profiles", `{"profiles":{"focus":{"categoryVolumes":{"read":0}},"demo":{"activePack":"retro"}}}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT /api/profiles: status %d", resp.StatusCode)
+	}
+
+	resp = put("/api/profiles/active", `{"name":"demo"}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT /api/profiles/active: status %d", resp.StatusCode)
+	}
+
+	// The client sees the profile edit, then the switch.
+	var active any
+	for active != "demo" {
+		var env struct {
+			Type string         `json:"type"`
+			Data map[string]any `json:"data"`
+		}
+		if err := conn.ReadJSON(&env); err != nil {
+			t.Fatalf("waiting for profile switch: %v", err)
+		}
+		if env.Type == "config" {
+			active = env.Data["activeProfile"]
+		}
+	}
+
+	t.Run("GET lists profiles", func(t *testing.T) {
+		resp, err := http.Get(httpURL(addr, "/api/profiles"))
+		if err != nil {
+			t.Fatalf("GET /api/profiles: %v", err)
+		}
+		defer resp.Body.Close()
+		var body struct {
+			Active    string                    `json:"active"`
+			Profiles  map[string]map[string]any `json:"profiles"`
+			Effective config.Config             `json:"effective"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if body.Active != "demo" || len(body.Profiles) != 2 || body.Profiles["demo"]["activePack"] != "retro" {
+			t.Errorf("got %+v", body)
+		}
+
+		// The effective config is the base config with the profile applied.
+		resp, err = http.Get(httpURL(addr, "/api/config"))
+		if err != nil {
+			t.Fatalf("GET /api/config: %v", err)
+		}
+		defer resp.Body.Close()
+		var base config.Config
+		if err := json.NewDecoder(resp.Body).Decode(&base); err != nil {
+			t.Fatalf("decode config: %v", err)
+		}
+		if base.ActivePack == "retro" || body.Effective.ActivePack != "retro" {
+			t.Errorf("activePack: base %q, effective %q; want only the effective one retro", base.ActivePack, body.Effective.ActivePack)
+		}
+		if want := base.Effective(); !reflect.DeepEqual(&body.Effective, want) {
+			t.Errorf("effective = %+v, want %+v", body.Effective, *want)
+		}
+	})
+
+	t.Run("unknown profile is rejected", func(t *testing.T) {
+		if resp := put("/api/profiles/active", `{"name":"nope"}`); resp.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusUnprocessableEntity)
+		}
+	})
+
+	t.Run("deactivate", func(t *testing.T) {
+		if resp := put("/api/profiles/active", `{"name":""}`); resp.StatusCode != http.StatusOK {
+			t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+		}
+	})
+}
+
+// TestShutdown verifies that Shutdown delivers events already sent on
+// EventCh, closes WebSocket clients with "going away", and makes Start return
+// nil.
+func TestShutdown(t *testing.T) {
+	staticFS := fstest.MapFS{"index.html": &fstest.MapFile{Data: []byte("<html></html>")}}
+	packsDir := t.TempDir()
+	writeTestPacks(t, packsDir, "default")
+	srv := server.New(0, staticFS, packsDir, filepath.Join(t.TempDir(), "config.json"), t.TempDir())
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	started := make(chan error, 1)
+	go func() { started <- srv.StartWithListener(ln) }()
+
+	conn := dialWS(t, wsURL(ln.Addr().String(), "/ws"))
+	time.Sleep(50 * time.Millisecond)
+
+	srv.EventCh() <- &events.BabbleEvent{Session: "last", Event: "Stop"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second)) //nolint:errcheck
+	var got events.BabbleEvent
+	if err := conn.ReadJSON(&got); err != nil {
+		t.Fatalf("read final event: %v", err)
+	}
+	if got.Session != "last" {
+		t.Errorf("session = %q, want last", got.Session)
+	}
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("read after shutdown: got %v, want close 1001", err)
+	}
+
+	select {
+	case err := <-started:
+		if err != nil {
+			t.Errorf("StartWithListener returned %v, want nil", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("StartWithListener did not return after Shutdown")
+	}
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Errorf("second Shutdown: %v", err)
+	}
+}
+
+// TestReload verifies that Reload pushes newly installed packs and config
+// changes to clients.
+func TestReload(t *testing.T) {
+	staticFS := fstest.MapFS{"index.html": &fstest.MapFile{Data: []byte("<html></html>")}}
+	packsDir := t.TempDir()
+	writeTestPacks(t, packsDir, "default")
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	srv := server.New(0, staticFS, packsDir, configPath, t.TempDir())
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() { _ = srv.StartWithListener(ln) }()
+
+	conn := dialWS(t, wsURL(ln.Addr().String(), "/ws?v=1"))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second)) //nolint:errcheck
+	time.Sleep(50 * time.Millisecond)
+
+	writeTestPacks(t, packsDir, "chiptune")
+	if err := os.WriteFile(configPath, []byte(`{"activePack":"chiptune"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	var sawPacks, sawConfig bool
+	for !sawPacks || !sawConfig {
+		var env struct {
+			Type string          `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}
+		if err := conn.ReadJSON(&env); err != nil {
+			t.Fatalf("read message (packs=%v config=%v): %v", sawPacks, sawConfig, err)
+		}
+		switch env.Type {
+		case "packs":
+			var ps []struct {
+				Name string `json:"name"`
+			}
+			if err := json.Unmarshal(env.Data, &ps); err != nil {
+				t.Fatalf("unmarshal packs: %v", err)
+			}
+			if len(ps) != 2 {
+				t.Errorf("packs = %+v, want default and chiptune", ps)
+			}
+			sawPacks = true
+		case "config":
+			var cfg struct {
+				ActivePack string `json:"activePack"`
+			}
+			if err := json.Unmarshal(env.Data, &cfg); err != nil {
+				t.Fatalf("unmarshal config: %v", err)
+			}
+			if cfg.ActivePack != "chiptune" {
+				t.Errorf("activePack = %q, want chiptune", cfg.ActivePack)
+			}
+			sawConfig = true
+		}
+	}
+}
+
+// TestAuth verifies the request guard: Host and Origin must name the server,
+// and with an authToken configured, requests need it as a bearer token, a
+// cookie or (once, from the browser) a query parameter.
+func TestAuth(t *testing.T) {
+	const token = "0123456789abcdef-test"
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"version":1,"authToken":"`+token+`"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, addr := startTestServerWithConfig(t, configPath)
+
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	get := func(path string, modify func(*http.Request)) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, httpURL(addr, path), nil)
+		if modify != nil {
+			modify(req)
+		}
+		var resp *http.Response
+		var err error
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			resp, err = noRedirect.Do(req)
+			if err == nil || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	bearer := func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+
+	if resp := get("/api/config", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("no token: status %d, want 401", resp.StatusCode)
+	}
+	if resp := get("/api/config", func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") }); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("wrong token: status %d, want 401", resp.StatusCode)
+	}
+	if resp := get("/api/config", bearer); resp.StatusCode != http.StatusOK {
+		t.Errorf("bearer token: status %d, want 200", resp.StatusCode)
+	}
+
+	resp := get("/?token="+token, nil)
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/" {
+		t.Errorf("query token: status %d to %q, want 303 to /", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	var cookie *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == "babble_token" {
+			cookie = c
+		}
+	}
+	if cookie == nil || !cookie.HttpOnly {
+		t.Fatalf("query token: cookie %+v, want an HttpOnly babble_token", cookie)
+	}
+	if resp := get("/api/config", func(r *http.Request) { r.AddCookie(cookie) }); resp.StatusCode != http.StatusOK {
+		t.Errorf("cookie: status %d, want 200", resp.StatusCode)
+	}
+
+	if resp := get("/api/config", func(r *http.Request) { bearer(r); r.Host = "evil.example" }); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("foreign Host: status %d, want 403", resp.StatusCode)
+	}
+	if resp := get("/api/config", func(r *http.Request) { bearer(r); r.Header.Set("Origin", "http://evil.example") }); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("foreign Origin: status %d, want 403", resp.StatusCode)
+	}
+	if resp := get("/api/config", func(r *http.Request) { bearer(r); r.Header.Set("Origin", "http://localhost:3333") }); resp.StatusCode != http.StatusOK {
+		t.Errorf("local Origin: status %d, want 200", resp.StatusCode)
+	}
+
+	header := http.Header{"Authorization": {"Bearer " + token}, "Origin": {"http://evil.example"}}
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL(addr, "/ws"), header); err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("WebSocket from foreign origin: err %v, want 403", err)
+	}
+	header.Set("Origin", "http://"+addr)
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(addr, "/ws"), header)
+	if err != nil {
+		t.Fatalf("WebSocket with token: %v", err)
+	}
+	conn.Close()
+}
+
+// TestSelfSignedTLS verifies that tlsSelfSigned serves HTTPS with a generated
+// certificate that clients can trust via CertFile, and that a server bound
+// beyond loopback generates a token.
+func TestSelfSignedTLS(t *testing.T) {
+	staticFS := fstest.MapFS{"index.html": &fstest.MapFile{Data: []byte("<html></html>")}}
+	packsDir := t.TempDir()
+	writeTestPacks(t, packsDir, "default")
+	stateDir := t.TempDir()
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"version":1,"bindAddress":"0.0.0.0","tlsSelfSigned":true}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	srv := server.New(0, staticFS, packsDir, configPath, stateDir)
+	if u := srv.BrowserURL(); !strings.HasPrefix(u, "https://localhost:0/?token=") {
+		t.Errorf("BrowserURL = %q, want https with a token", u)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() { _ = srv.StartWithListener(ln) }()
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := server.CertFile(cfg, stateDir)
+	var pemData []byte
+	deadline := time.Now().Add(2 * time.Second)
+	for pemData == nil && time.Now().Before(deadline) {
+		pemData, _ = os.ReadFile(certFile)
+		time.Sleep(10 * time.Millisecond)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemData) {
+		t.Fatalf("no certificate in %s", certFile)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://"+ln.Addr().String()+"/api/config", nil)
+	req.Header.Set("Authorization", "Bearer "+server.ReadToken(cfg, stateDir))
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("GET over TLS: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET over TLS: status %d, want 200", resp.StatusCode)
+	}
+}
+
+// TestRedaction verifies that event details are redacted before broadcast,
+// and that changes to the redaction settings apply to subsequent events.
+func TestRedaction(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"version":1,"redactPatterns":["acme-\\d+"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	srv, addr := startTestServerWithConfig(t, configPath)
+	conn := dialWS(t, wsURL(addr, "/ws"))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second)) //nolint:errcheck
+	time.Sleep(50 * time.Millisecond)
+
+	next := func(category events.Category, detail string) string {
+		t.Helper()
+		srv.EventCh() <- &events.BabbleEvent{Session: "s", Category: category, Event: "Bash", Detail: detail}
+		var got events.BabbleEvent
+		if err := conn.ReadJSON(&got); err != nil {
+			t.Fatalf("read event: %v", err)
+		}
+		return got.Detail
+	}
+
+	if got, want := next(events.CategoryAction, "TOKEN=s3cret deploy acme-42"), "TOKEN=[redacted] deploy [redacted]"; got != want {
+		t.Errorf("detail = %q, want %q", got, want)
+	}
+
+	req, _ := http.NewRequest(http.MethodPatch, httpURL(addr, "/api/config"),
+		strings.NewReader(`{"detailLevels":{"action":"none"}}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PATCH /api/config: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PATCH /api/config: status %d", resp.StatusCode)
+	}
+
+	if got := next(events.CategoryAction, "go test ./..."); got != "" {
+		t.Errorf("detail at level none = %q, want empty", got)
+	}
+	if got := next(events.CategoryRead, "main.go"); got != "main.go" {
+		t.Errorf("other category detail = %q, want main.go", got)
+	}
+}
+
+// TestUnixSocket verifies serving on only a Unix socket: the socket is
+// private to the user, needs no token, and is removed on shutdown.
+func TestUnixSocket(t *testing.T) {
+	staticFS := fstest.MapFS{"index.html": &fstest.MapFile{Data: []byte("<html></html>")}}
+	packsDir := t.TempDir()
+	writeTestPacks(t, packsDir, "default")
+	stateDir := t.TempDir()
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"version":1,"listen":"unix","authToken":"0123456789abcdef-test"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	srv := server.New(0, staticFS, packsDir, configPath, stateDir)
+	if u := srv.BrowserURL(); u != "" {
+		t.Errorf("BrowserURL = %q, want empty without TCP", u)
+	}
+	started := make(chan error, 1)
+	go func() { started <- srv.Start() }()
+
+	socket := filepath.Join(stateDir, "babble.sock")
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	var resp *http.Response
+	var err error
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if resp, err = client.Get("http://babble/api/config"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("GET over socket: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET over socket without token: status %d, want 200", resp.StatusCode)
+	}
+
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("socket mode = %v, want 0600", perm)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := <-started; err != nil {
+		t.Errorf("Start returned %v, want nil", err)
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("socket still present after shutdown (err %v)", err)
+	}
+}
+
+// TestListenFailure checks that when one listener cannot be served the
+// other is closed rather than left accepting connections.
+func TestListenFailure(t *testing.T) {
+	staticFS := fstest.MapFS{"index.html": &fstest.MapFile{Data: []byte("<html></html>")}}
+	packsDir := t.TempDir()
+	writeTestPacks(t, packsDir, "default")
+	start := func(config string) (net.Listener, error) {
+		t.Helper()
+		configPath := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		srv := server.New(0, staticFS, packsDir, configPath, t.TempDir())
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("net.Listen: %v", err)
+		}
+		t.Cleanup(func() { ln.Close() })
+		done := make(chan error, 1)
+		go func() { done <- srv.StartWithListener(ln) }()
+		select {
+		case err := <-done:
+			return ln, err
+		case <-time.After(5 * time.Second):
+			t.Fatal("StartWithListener did not return")
+			return nil, nil
+		}
+	}
+
+	t.Run("socket", func(t *testing.T) {
+		notDir := filepath.Join(t.TempDir(), "file")
+		if err := os.WriteFile(notDir, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		ln, err := start(fmt.Sprintf(`{"version":1,"socketPath":%q}`, filepath.Join(notDir, "babble.sock")))
+		if err == nil {
+			t.Fatal("StartWithListener succeeded with an unusable socket path")
+		}
+		if conn, err := net.Dial("tcp", ln.Addr().String()); err == nil {
+			conn.Close()
+			t.Error("TCP listener still accepting after the socket failed")
+		}
+	})
+
+	t.Run("tls", func(t *testing.T) {
+		dir := t.TempDir()
+		socket := filepath.Join(dir, "babble.sock")
+		_, err := start(fmt.Sprintf(`{"version":1,"socketPath":%q,"tlsCert":%q,"tlsKey":%q}`,
+			socket, filepath.Join(dir, "missing.pem"), filepath.Join(dir, "missing-key.pem")))
+		if err == nil {
+			t.Fatal("StartWithListener succeeded without a certificate")
+		}
+		if conn, err := net.Dial("unix", socket); err == nil {
+			conn.Close()
+			t.Error("Unix socket still accepting after TLS failed")
+		}
+	})
+}
+
+// TestHealth checks GET /api/health and that POST /api/shutdown signals
+// ShutdownRequested without stopping the server itself.
+func TestHealth(t *testing.T) {
+	srv, addr := startTestServer(t)
+	srv.SetVersion("v9.9.9")
+
+	resp, err := http.Get(httpURL(addr, "/api/health"))
+	if err != nil {
+		t.Fatalf("GET /api/health: %v", err)
+	}
+	var h server.Health
+	err = json.NewDecoder(resp.Body).Decode(&h)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("decode health: %v", err)
+	}
+	if h.Status != "ok" || h.Version != "v9.9.9" || h.PID != os.Getpid() {
+		t.Errorf("health = %+v, want status ok, version v9.9.9, pid %d", h, os.Getpid())
+	}
+	if h.StartedAt.IsZero() || time.Since(h.StartedAt) > time.Minute {
+		t.Errorf("startedAt = %v, want just now", h.StartedAt)
+	}
+
+	select {
+	case <-srv.ShutdownRequested():
+		t.Fatal("ShutdownRequested closed before any request")
+	default:
+	}
+	for range 2 {
+		resp, err = http.Post(httpURL(addr, "/api/shutdown"), "", nil)
+		if err != nil {
+			t.Fatalf("POST /api/shutdown: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("POST /api/shutdown: status %d, want 202", resp.StatusCode)
+		}
+	}
+	select {
+	case <-srv.ShutdownRequested():
+	case <-time.After(time.Second):
+		t.Fatal("ShutdownRequested not closed after POST /api/shutdown")
+	}
+
+	// The server keeps serving until its owner calls Shutdown.
+	resp, err = http.Get(httpURL(addr, "/api/health"))
+	if err != nil {
+		t.Fatalf("GET /api/health after shutdown request: %v", err)
+	}
+	resp.Body.Close()
+}
+
+// TestMetrics checks that GET /metrics serves the process and per-server
+// metrics in the Prometheus text format and that GET /api/stats reports the
+// same counters.
+func TestMetrics(t *testing.T) {
+	srv, addr := startTestServer(t)
+
+	conn := dialWS(t, wsURL(addr, "/ws"))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second)) //nolint:errcheck
+	srv.EventCh() <- &events.BabbleEvent{Session: "api", Category: events.CategoryWrite, Event: "Edit"}
+	var ev events.BabbleEvent
+	if err := conn.ReadJSON(&ev); err != nil {
+		t.Fatalf("read event: %v", err)
+	}
+
+	resp, err := http.Get(httpURL(addr, "/metrics"))
+	if err != nil {
+		t.Fatalf("GET /metrics: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("read /metrics: %v", err)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the Prometheus text format", ct)
+	}
+	for _, want := range []string{
+		"# TYPE babble_hub_events_broadcast_total counter\n",
+		"# TYPE babble_hub_clients gauge\n",
+		"babble_sessions_tailed_files ",
+		"babble_parse_errors_total ",
+		`babble_http_requests_total{route="/ws",code="101"} `,
+		"babble_queue_capacity ",
+		"babble_registry_sessions 1\n",
+		"babble_start_time_seconds ",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("/metrics lacks %q", want)
+		}
+	}
+
+	resp, err = http.Get(httpURL(addr, "/api/stats"))
+	if err != nil {
+		t.Fatalf("GET /api/stats: %v", err)
+	}
+	var stats struct {
+		Registry struct {
+			Sessions int `json:"sessions"`
+		} `json:"registry"`
+		Hub struct {
+			Clients         int64  `json:"clients"`
+			EventsBroadcast uint64 `json:"eventsBroadcast"`
+			MessagesSent    uint64 `json:"messagesSent"`
+		} `json:"hub"`
+		HTTP struct {
+			ByRoute map[string]map[string]uint64 `json:"byRoute"`
+		} `json:"http"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&stats)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("decode stats: %v", err)
+	}
+	if stats.Registry.Sessions != 1 {
+		t.Errorf("registry.sessions = %d, want 1", stats.Registry.Sessions)
+	}
+	if stats.Hub.Clients < 1 || stats.Hub.EventsBroadcast < 1 || stats.Hub.MessagesSent < 1 {
+		t.Errorf("hub = %+v, want at least one client, broadcast and message", stats.Hub)
+	}
+	if stats.HTTP.ByRoute["GET /metrics"]["200"] < 1 {
+		t.Errorf("http.byRoute = %v, want GET /metrics counted", stats.HTTP.ByRoute)
+	}
+}
+
+// TestEventLog checks that events are stored, that GET /api/events filters
+// and pages through them, and that a restarted server keeps both the events
+// and its numbering.
+func TestEventLog(t *testing.T) {
+	staticFS := fstest.MapFS{"index.html": &fstest.MapFile{Data: []byte("<html></html>")}}
+	packsDir := t.TempDir()
+	writeTestPacks(t, packsDir, "default")
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	stateDir := t.TempDir()
+
+	start := func() (*server.Server, string) {
+		srv := server.New(0, staticFS, packsDir, configPath, stateDir)
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("net.Listen: %v", err)
+		}
+		go func() { _ = srv.StartWithListener(ln) }()
+		return srv, ln.Addr().String()
+	}
+	type page struct {
+		Events     []events.BabbleEvent `json:"events"`
+		NextCursor string               `json:"nextCursor"`
+	}
+	get := func(addr, query string) page {
+		t.Helper()
+		resp, err := http.Get(httpURL(addr, "/api/events?"+query))
+		if err != nil {
+			t.Fatalf("GET /api/events?%s: %v", query, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET /api/events?%s: status %d", query, resp.StatusCode)
+		}
+		var p page
+		if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return p
+	}
+	stop := func(srv *server.Server) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			t.Fatalf("Shutdown: %v", err)
+		}
+	}
+
+	srv, addr := start()
+	base := time.Now().Add(-time.Hour).UTC()
+	for i, cat := range []events.Category{"read", "write", "read", "error", "read"} {
+		srv.EventCh() <- &events.BabbleEvent{
+			Session:   "api",
+			Category:  cat,
+			Event:     "Tool",
+			Timestamp: base.Add(time.Duration(i) * time.Minute).Format(time.RFC3339Nano),
+		}
+	}
+	stop(srv) // drains the pipeline, so every event has been stored
+
+	srv, addr = start()
+	defer stop(srv)
+
+	p := get(addr, "category=read&limit=2")
+	if len(p.Events) != 2 || p.Events[0].Seq != 1 || p.Events[1].Seq != 3 || p.NextCursor == "" {
+		t.Fatalf("first page = %+v, want seq 1 and 3 and a cursor", p)
+	}
+	p = get(addr, "category=read&limit=2&cursor="+p.NextCursor)
+	if len(p.Events) != 1 || p.Events[0].Seq != 5 || p.NextCursor != "" {
+		t.Errorf("second page = %+v, want seq 5 and no cursor", p)
+	}
+	p = get(addr, "since="+base.Add(90*time.Second).Format(time.RFC3339)+"&until=55m")
+	if len(p.Events) != 3 || p.Events[0].Seq != 3 {
+		t.Errorf("since/until = %+v, want seq 3 to 5", p)
+	}
+
+	srv.EventCh() <- &events.BabbleEvent{Session: "api", Category: "write", Event: "Edit"}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		p = get(addr, "cursor=5")
+		if len(p.Events) > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(p.Events) != 1 || p.Events[0].Seq != 6 {
+		t.Errorf("after restart = %+v, want the new event numbered 6", p)
+	}
+
+	for _, bad := range []string{"limit=0", "limit=5000", "cursor=x", "since=yesterday"} {
+		resp, err := http.Get(httpURL(addr, "/api/events?"+bad))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("?%s: status %d, want 400", bad, resp.StatusCode)
+		}
+	}
+}
+
+// TestSessionSummary checks that GET /api/sessions/{id}/summary summarises
+// only the named session, from its session logs, with written files redacted
+// as events are, and returns 404 for an unknown one.
+func TestSessionSummary(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	cfg := config.Default()
+	cfg.DetailLevels = map[string]string{"write": "basename"}
+	if err := config.Save(cfg, configPath); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	srv, addr := startTestServerWithConfig(t, configPath)
+	logsDir := t.TempDir()
+	srv.SetLogsDir(logsDir)
+
+	base := time.Now().Add(-time.Hour).UTC()
+	line := func(i int, id, typ, content string) string {
+		return fmt.Sprintf(`{"type":%q,"sessionId":%q,"cwd":"/src/api","timestamp":%q,"message":{"content":[%s]}}`,
+			typ, id, base.Add(time.Duration(i)*time.Minute).Format(time.RFC3339Nano), content)
+	}
+	write := func(rel string, lines ...string) {
+		t.Helper()
+		path := filepath.Join(logsDir, "-src-api", rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("s1.jsonl",
+		line(0, "s1", "assistant", `{"type":"tool_use","name":"Edit","input":{"file_path":"/src/api/a.go"}}`),
+		line(1, "s1", "user", `{"type":"tool_result","is_error":true}`),
+		line(2, "s1", "user", `{"type":"tool_result"}`),
+		line(3, "s1", "assistant", `{"type":"tool_use","name":"Write","input":{"file_path":"/src/api/sub/b.go"}}`),
+	)
+	write("s2.jsonl", line(0, "s2", "assistant", `{"type":"tool_use","name":"Read","input":{"file_path":"/src/api/a.go"}}`))
+	// Other sessions' logs are not opened; if they were, these would fail.
+	for _, rel := range []string{"-src-api/s3.jsonl", "-src-web/s4.jsonl", "-src-web/s4/subagents/agent-x.jsonl"} {
+		path := filepath.Join(logsDir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(filepath.Join(logsDir, "missing"), path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	before := events.ReadParseStats()
+	resp, err := http.Get(httpURL(addr, "/api/sessions/s1/summary"))
+	if err != nil {
+		t.Fatalf("GET summary: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET summary: status %d", resp.StatusCode)
+	}
+	var sum report.Summary
+	err = json.NewDecoder(resp.Body).Decode(&sum)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("decode summary: %v", err)
+	}
+	if sum.SessionID != "s1" || sum.Session != "api" || sum.Events != 4 || sum.Errors != 1 || sum.ErrorRate != 0.5 {
+		t.Errorf("summary = %+v, want 4 events of s1 (api) with 1 error in 2 results", sum)
+	}
+	if want := []string{"a.go", "b.go"}; !slices.Equal(sum.FilesWritten, want) {
+		t.Errorf("FilesWritten = %v, want %v", sum.FilesWritten, want)
+	}
+	if time.Duration(sum.Duration) != 3*time.Minute {
+		t.Errorf("Duration = %v, want 3m", sum.Duration)
+	}
+	// Reading the logs is not live traffic, so the parse metrics do not count it.
+	if after := events.ReadParseStats(); !reflect.DeepEqual(after, before) {
+		t.Errorf("parse stats changed from %+v to %+v", before, after)
+	}
+
+	for path, want := range map[string]int{
+		"/api/sessions/nope/summary":           http.StatusNotFound,
+		"/api/sessions/s1/summary?since=1m":    http.StatusNotFound,
+		"/api/sessions/s1/summary?since=never": http.StatusBadRequest,
+	} {
+		resp, err := http.Get(httpURL(addr, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("GET %s: status %d, want %d", path, resp.StatusCode, want)
+		}
+	}
+}
+
+// TestSessionsAPI checks that GET /api/sessions lists the sessions seen, with
+// their directory and subagents, and that GET /api/sessions/{id} describes
+// one.
+func TestSessionsAPI(t *testing.T) {
+	srv, addr := startTestServer(t)
+	srv.EventCh() <- &events.BabbleEvent{SessionID: "s1", Session: "api", Cwd: "/src/api", Category: "read", Event: "Read"}
+	srv.EventCh() <- &events.BabbleEvent{SessionID: "s1", Session: "api", IsSubagent: true, AgentID: "x", Category: "read", Event: "Grep"}
+	srv.EventCh() <- &events.BabbleEvent{SessionID: "s2", Session: "web", Category: "write", Event: "Edit"}
+
+	getJSON := func(path string, v any) int {
+		t.Helper()
+		resp, err := http.Get(httpURL(addr, path))
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				t.Fatalf("GET %s: decode: %v", path, err)
+			}
+		}
+		return resp.StatusCode
+	}
+
+	var list []registry.Session
+	deadline := time.Now().Add(2 * time.Second)
+	for len(list) < 2 && time.Now().Before(deadline) {
+		getJSON("/api/sessions", &list)
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(list) != 2 || list[0].ID != "s2" || list[1].ID != "s1" {
+		t.Fatalf("sessions = %+v, want s2 then s1", list)
+	}
+
+	var sess registry.Session
+	if code := getJSON("/api/sessions/s1", &sess); code != http.StatusOK {
+		t.Fatalf("GET /api/sessions/s1: status %d", code)
+	}
+	if sess.Name != "api" || sess.Cwd != "/src/api" || sess.Events != 2 || sess.Subagents != 1 ||
+		sess.State != registry.StateActive || sess.Counts[events.CategoryRead] != 2 {
+		t.Errorf("session = %+v, want api in /src/api, active, 2 reads, 1 subagent", sess)
+	}
+
+	if code := getJSON("/api/sessions?state=ended", &list); code != http.StatusOK || len(list) != 0 {
+		t.Errorf("?state=ended: status %d, %d sessions, want none", code, len(list))
+	}
+	for path, want := range map[string]int{
+		"/api/sessions/nope":       http.StatusNotFound,
+		"/api/sessions?state=gone": http.StatusBadRequest,
+	} {
+		if code := getJSON(path, &sess); code != want {
+			t.Errorf("GET %s: status %d, want %d", path, code, want)
+		}
+	}
+}
+
+// TestSessionNames checks that sessions in directories with the same name are
+// told apart, that a session keeps its name when a namesake starts, and that
+// sessionAliases names a directory's sessions.
+func TestSessionNames(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	cfg := config.Default()
+	cfg.SessionAliases = map[string]string{"/srv/web": "prod-web"}
+	if err := config.Save(cfg, configPath); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	srv, addr := startTestServerWithConfig(t, configPath)
+
+	for _, ev := range []events.BabbleEvent{
+		{SessionID: "s1", Cwd: "/src/work/api"},
+		{SessionID: "s2", Cwd: "/src/oss/api"},
+		{SessionID: "s1", Cwd: "/src/work/api"},
+		{SessionID: "s3", Cwd: "/srv/web"},
+		{SessionID: "s2", IsSubagent: true, AgentID: "x", Cwd: "/tmp/scratch"},
+	} {
+		ev.Session = events.SessionNameFromCwd(ev.Cwd)
+		ev.Category, ev.Event = "read", "Read"
+		srv.EventCh() <- &ev
+	}
+
+	want := map[string]string{"s1": "api", "s2": "oss/api", "s3": "prod-web"}
+	got := map[string]string{}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp, err := http.Get(httpURL(addr, "/api/sessions"))
+		if err != nil {
+			t.Fatalf("GET /api/sessions: %v", err)
+		}
+		var list []registry.Session
+		err = json.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		clear(got)
+		seen := 0
+		for _, sess := range list {
+			got[sess.ID] = sess.Name
+			seen += sess.Events
+		}
+		if seen == 5 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("names = %v, want %v", got, want)
+	}
+
+	// Both of s1's events, before and after s2 started, went out as "api".
+	resp, err := http.Get(httpURL(addr, "/api/events?session=api"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var page struct {
+		Events []events.BabbleEvent `json:"events"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&page)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("decode events: %v", err)
+	}
+	var ids []string
+	for _, ev := range page.Events {
+		ids = append(ids, ev.SessionID)
+	}
+	if want := []string{"s1", "s1"}; !slices.Equal(ids, want) {
+		t.Errorf("events named api came from %v, want %v", ids, want)
+	}
+}
+
+// TestGitContext checks that events and sessions carry the branch of their
+// working tree, and that it is read again after git checkout.
+func TestGitContext(t *testing.T) {
+	srv, addr := startTestServer(t)
+
+	repo := filepath.Join(t.TempDir(), "api")
+	head := filepath.Join(repo, ".git", "HEAD")
+	if err := os.MkdirAll(filepath.Dir(head), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	setHead := func(branch string) {
+		t.Helper()
+		if err := os.WriteFile(head, []byte("ref: refs/heads/"+branch+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	send := func(event, detail string) {
+		srv.EventCh() <- &events.BabbleEvent{
+			SessionID: "s1", Session: "api", Cwd: repo,
+			Category: "action", Event: event, Detail: detail, ToolUse: event == "Bash",
+		}
+	}
+	// waitBranch polls GET /api/sessions/s1 until the session is on branch.
+	waitBranch := func(branch string) registry.Session {
+		t.Helper()
+		var sess registry.Session
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			resp, err := http.Get(httpURL(addr, "/api/sessions/s1"))
+			if err != nil {
+				t.Fatalf("GET /api/sessions/s1: %v", err)
+			}
+			if resp.StatusCode == http.StatusOK {
+				sess = registry.Session{}
+				err = json.NewDecoder(resp.Body).Decode(&sess)
+			}
+			resp.Body.Close()
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if sess.Git != nil && sess.Git.Branch == branch {
+				return sess
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Fatalf("session git = %+v, want branch %s", sess.Git, branch)
+		return sess
+	}
+
+	setHead("main")
+	send("Bash", "ls")
+	sess := waitBranch("main")
+	if sess.Git.Repo != "api" || sess.Git.Root != repo {
+		t.Errorf("git = %+v, want repo api at %s", sess.Git, repo)
+	}
+
+	send("Bash", "git checkout -b feature")
+	setHead("feature")
+	send("tool_result", "")
+	waitBranch("feature")
+
+	resp, err := http.Get(httpURL(addr, "/api/events?session=api"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var page struct {
+		Events []events.BabbleEvent `json:"events"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&page)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("decode events: %v", err)
+	}
+	var branches []string
+	for _, ev := range page.Events {
+		if ev.Git != nil {
+			branches = append(branches, ev.Git.Branch)
+		}
+	}
+	if want := []string{"main", "main", "feature"}; !slices.Equal(branches, want) {
+		t.Errorf("event branches = %v, want %v", branches, want)
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/dacort/babble/internal/events"
+	"github.com/dacort/babble/internal/registry"
+	"github.com/dacort/babble/internal/report"
+)
+
+// handleSessions handles GET /api/sessions, listing the sessions seen since
+// the server started, most recently active first. ?state=active, idle or
+// ended lists only sessions in that state.
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	state := registry.State(r.URL.Query().Get("state"))
+	switch state {
+	case "", registry.StateActive, registry.StateIdle, registry.StateEnded:
+	default:
+		http.Error(w, "state must be active, idle or ended", http.StatusBadRequest)
+		return
+	}
+	sessions := []registry.Session{}
+	for _, sess := range s.registry.Sessions() {
+		if state == "" || sess.State == state {
+			sessions = append(sessions, sess)
+		}
+	}
+	writeSessionJSON(w, sessions)
+}
+
+// handleSession handles GET /api/sessions/{id}, describing one session.
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	sess, ok := s.registry.Session(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "unknown session "+r.PathValue("id"), http.StatusNotFound)
+		return
+	}
+	writeSessionJSON(w, sess)
+}
+
+// writeSessionJSON writes v as the JSON response to a sessions request.
+func writeSessionJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("sessions: encode response: %v", err)
+	}
+}
+
+// SetLogsDir sets the directory of Claude Code session logs, normally
+// ~/.claude/projects, that GET /api/sessions/{id}/summary reads.
+func (s *Server) SetLogsDir(dir string) {
+	s.logsDir = dir
+}
+
+// handleSessionSummary handles GET /api/sessions/{id}/summary, summarising
+// the session with that ID as "babble report --format json" does: from its
+// own session logs, which unlike the event log and the in-memory history hold
+// every event it produced. The files written are redacted as the events
+// sent to clients are, and the session is given the name clients know it
+// by. The optional since parameter, an RFC 3339 time or a duration before
+// now, limits the summary to later events.
+func (s *Server) handleSessionSummary(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	since, err := timeParam(r.URL.Query(), "since", time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	b := report.NewBuilder()
+	if err := report.ReadSession(s.logsDir, id, since, b); err != nil {
+		log.Printf("sessions: %v", err)
+		http.Error(w, "cannot read the session logs", http.StatusInternalServerError)
+		return
+	}
+	sums := b.Summaries()
+	if len(sums) == 0 {
+		http.Error(w, "no events for session "+id, http.StatusNotFound)
+		return
+	}
+
+	sum := sums[0]
+	if sess, ok := s.registry.Session(id); ok {
+		sum.Session = sess.Name
+		if sum.Git == nil {
+			sum.Git = sess.Git // already redacted
+		}
+	}
+	s.redactFiles(&sum)
+	writeSessionJSON(w, sum)
+}
+
+// redactFiles redacts sum.FilesWritten as the write events that named them
+// are redacted, dropping files left with no name and any duplicates.
+func (s *Server) redactFiles(sum *report.Summary) {
+	r := s.redactor.Load()
+	seen := make(map[string]bool, len(sum.FilesWritten))
+	for _, file := range sum.FilesWritten {
+		ev := &events.BabbleEvent{Category: events.CategoryWrite, FilePath: file}
+		r.Event(ev)
+		if ev.FilePath != "" {
+			seen[ev.FilePath] = true
+		}
+	}
+	sum.FilesWritten = slices.Sorted(maps.Keys(seen))
+}
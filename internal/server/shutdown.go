@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/dacort/babble/internal/config"
+	"github.com/dacort/babble/internal/hub"
+	"github.com/dacort/babble/internal/packs"
+)
+
+// Shutdown stops the server gracefully. Events already sent on EventCh are
+// delivered to clients, every WebSocket client is sent a "going away" close
+// frame, and then the HTTP server stops accepting connections and waits for
+// in-flight requests to finish. If ctx expires first, the remaining
+// connections are closed and ctx's error is returned.
+//
+// Callers must stop sending on EventCh before calling Shutdown, since it
+// closes the channel. Start returns nil once Shutdown has been called.
+// Shutdown is safe to call more than once.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.closeOnce.Do(func() {
+		close(s.eventCh)
+		s.mu.Lock()
+		close(s.stop)
+		if s.watcher != nil {
+			s.watcher.Close()
+		}
+		s.mu.Unlock()
+	})
+
+	// Closing EventCh drains the pipeline into the hub, which closes its
+	// clients once the last event has been broadcast.
+	var err error
+	select {
+	case <-s.hub.Done():
+	case <-ctx.Done():
+		err = fmt.Errorf("server: waiting for clients to disconnect: %w", ctx.Err())
+	}
+
+	for _, srv := range []*http.Server{s.httpSrv, s.unixSrv} {
+		if serr := srv.Shutdown(ctx); serr != nil {
+			srv.Close()
+			if err == nil {
+				err = fmt.Errorf("server: shutdown: %w", serr)
+			}
+		}
+	}
+	return err
+}
+
+// Reload re-reads the config file and the packs directory and pushes any
+// changes to clients: the config as a "config" message and the list of
+// installed packs as a "packs" message, so that newly installed packs appear
+// without a restart. WebSocket timeouts take effect for new connections.
+// Settings that size the event pipeline (eventBuffer, dropPolicy,
+// historyEvents) still require a restart.
+//
+// An invalid config is reported and not applied; the packs are still
+// reloaded.
+func (s *Server) Reload() error {
+	ps, err := packs.ListPacks(s.packsDir)
+	if err != nil {
+		return fmt.Errorf("server: list packs: %w", err)
+	}
+	if ps == nil {
+		ps = []*packs.Pack{}
+	}
+	s.hub.Broadcast(hub.TypePacks, ps)
+
+	cfg, err := config.Load(s.configPath)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Validate(s.packsDir); err != nil {
+		return err
+	}
+	s.hub.SetTimeouts(hub.Timeouts{
+		Write: parseDuration("writeTimeout", cfg.WriteTimeout),
+		Pong:  parseDuration("pongTimeout", cfg.PongTimeout),
+		Ping:  parseDuration("pingInterval", cfg.PingInterval),
+	})
+	s.applyConfig(cfg)
+	log.Printf("server: reloaded %s and %s", s.configPath, s.packsDir)
+	return nil
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dacort/babble/internal/config"
+)
+
+// socketFile is the default name of the Unix socket in the state directory.
+const socketFile = "babble.sock"
+
+// SocketPath returns where a server using cfg and stateDir listens for local
+// clients: socketPath if set, otherwise babble.sock in stateDir.
+func SocketPath(cfg *config.Config, stateDir string) string {
+	if cfg.SocketPath != "" {
+		return cfg.SocketPath
+	}
+	return filepath.Join(stateDir, socketFile)
+}
+
+// listenUnix listens on the Unix socket at path, readable and writable only
+// by the current user. A socket file left behind by a server that crashed is
+// replaced; one that a running server still answers on is not.
+func listenUnix(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("server: mkdir %s: %w", filepath.Dir(path), err)
+	}
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("server: %s is in use by another server", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("server: remove stale socket: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("server: stat %s: %w", path, err)
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("server: %w", err)
+	}
+	// The socket is created subject to the umask, so tighten it straight
+	// away. The default directory is created private as well, so other users
+	// cannot reach the socket in the meantime.
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("server: chmod %s: %w", path, err)
+	}
+	return ln, nil
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dacort/babble/internal/events"
+	"github.com/dacort/babble/internal/hub"
+)
+
+// sseKeepAlive is how often an idle event stream receives a comment line, so
+// that proxies and clients do not time the connection out.
+const sseKeepAlive = 15 * time.Second
+
+// handleEventStream handles GET /api/events/stream, a Server-Sent Events
+// feed of the same events the hub broadcasts over /ws. It accepts the same
+// filter as the WebSocket subscribe message as query parameters (session,
+// category, host, event).
+//
+// Each event is sent with its Seq as the SSE id. A client that reconnects
+// with a Last-Event-ID header (or lastEventId query parameter) first receives
+// any retained events it missed. If some were already evicted from the
+// server's history, a "gap" event is sent before the replay. So is one when
+// the id is newer than any this server has assigned, as after a restart
+// without the event log renumbered events from 1; the client is then sent
+// everything retained.
+func (s *Server) handleEventStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	filter := hub.FilterFromQuery(r.URL.Query())
+	if err := filter.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lastID, resume, err := lastEventID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Subscribe before replaying so that nothing falls between the two; the
+	// overlap is removed by skipping events at or below lastID.
+	live, cancel := s.hub.Subscribe(filter)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if resume {
+		// Any id a client got from this server is at most the last Seq
+		// assigned, since events reach the hub only after being numbered.
+		reset := lastID > s.seq.Load()
+		if reset {
+			lastID = 0
+		}
+		missed, complete := s.registry.Since(lastID)
+		if reset || !complete {
+			fmt.Fprint(w, "event: gap\ndata: {}\n\n")
+		}
+		for _, ev := range missed {
+			if !filter.Match(ev) {
+				continue
+			}
+			if err := writeSSE(w, ev); err != nil {
+				return
+			}
+			lastID = ev.Seq
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case ev, ok := <-live:
+			if !ok {
+				// The hub cut us off for falling behind. Ending the response
+				// makes the client reconnect and resume from its last id.
+				return
+			}
+			if ev.Seq <= lastID {
+				continue
+			}
+			if err := writeSSE(w, ev); err != nil {
+				return
+			}
+			lastID = ev.Seq
+			flusher.Flush()
+
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// lastEventID returns the id a reconnecting client last saw, taken from the
+// Last-Event-ID header or the lastEventId query parameter. resume is false
+// for a fresh connection.
+func lastEventID(r *http.Request) (id uint64, resume bool, err error) {
+	raw := r.Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = r.URL.Query().Get("lastEventId")
+	}
+	if raw == "" {
+		return 0, false, nil
+	}
+	id, err = strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid Last-Event-ID %q", raw)
+	}
+	return id, true, nil
+}
+
+// writeSSE writes ev as a single SSE message. The event field is omitted so
+// that browsers deliver it to EventSource.onmessage.
+func writeSSE(w http.ResponseWriter, ev *events.BabbleEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("sse: marshal event: %v", err)
+		return nil
+	}
+	_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", ev.Seq, data)
+	return err
+}
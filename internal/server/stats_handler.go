@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dacort/babble/internal/events"
+	"github.com/dacort/babble/internal/hub"
+	"github.com/dacort/babble/internal/sessions"
+)
+
+// queueStats describes the state of the server's event queue.
+type queueStats struct {
+	Size    int    `json:"size"`
+	Policy  string `json:"policy"`
+	Length  int    `json:"length"`
+	Dropped uint64 `json:"dropped"`
+}
+
+// registryStats counts the sessions the server knows about.
+type registryStats struct {
+	Sessions int `json:"sessions"`
+	Active   int `json:"active"`
+}
+
+// httpStats counts HTTP requests.
+type httpStats struct {
+	Requests uint64                       `json:"requests"`
+	InFlight int64                        `json:"inFlight"`
+	ByRoute  map[string]map[string]uint64 `json:"byRoute"` // route → status code → count
+}
+
+// statsResponse is the JSON body returned by GET /api/stats.
+type statsResponse struct {
+	UptimeSeconds int64             `json:"uptimeSeconds"`
+	Queue         queueStats        `json:"queue"`
+	Registry      registryStats     `json:"registry"`
+	Sessions      sessions.Stats    `json:"sessions"`
+	Parse         events.ParseStats `json:"parse"`
+	Hub           hub.Stats         `json:"hub"`
+	HTTP          httpStats         `json:"http"`
+}
+
+// handleStats handles GET /api/stats. It reports the event queue's capacity,
+// drop policy, current depth, and the number of events dropped so far, along
+// with the counters behind GET /metrics: files tailed and lines read, parse
+// outcomes and events per category, WebSocket traffic and HTTP requests.
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	known := s.registry.Sessions()
+	byRoute := make(map[string]map[string]uint64)
+	var requests uint64
+	for key, n := range httpRequests.Values() {
+		i := strings.LastIndexByte(key, ',')
+		route, code := key[:i], key[i+1:]
+		if byRoute[route] == nil {
+			byRoute[route] = make(map[string]uint64)
+		}
+		byRoute[route][code] = n
+		requests += n
+	}
+	resp := statsResponse{
+		UptimeSeconds: int64(time.Since(s.started).Seconds()),
+		Queue: queueStats{
+			Size:    s.queue.Size(),
+			Policy:  string(s.queue.Policy()),
+			Length:  s.queue.Len(),
+			Dropped: s.queue.Dropped(),
+		},
+		Registry: registryStats{
+			Sessions: len(known),
+			Active:   countActive(known),
+		},
+		Sessions: sessions.ReadStats(),
+		Parse:    events.ReadParseStats(),
+		Hub:      hub.ReadStats(),
+		HTTP: httpStats{
+			Requests: requests,
+			InFlight: httpInFlight.Value(),
+			ByRoute:  byRoute,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("stats: encode response: %v", err)
+	}
+}
+
+// handleClients handles GET /api/clients. It lists every connected WebSocket
+// client with its connection time and how long it has been idle.
+func (s *Server) handleClients(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.hub.Clients()); err != nil {
+		log.Printf("clients: encode response: %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/dacort/babble/internal/config"
+)
+
+// Self-signed certificate files, kept in the state directory.
+const (
+	selfSignedCertFile = "tls-cert.pem"
+	selfSignedKeyFile  = "tls-key.pem"
+)
+
+// selfSignedValidity is how long a generated certificate is valid for; it is
+// regenerated when less than selfSignedRenewBefore remains.
+const (
+	selfSignedValidity    = 365 * 24 * time.Hour
+	selfSignedRenewBefore = 30 * 24 * time.Hour
+)
+
+// CertFile returns the certificate a client should trust to reach a server
+// using cfg and stateDir: tlsCert, the self-signed certificate, or "" when
+// the server does not use TLS.
+func CertFile(cfg *config.Config, stateDir string) string {
+	switch {
+	case cfg.TLSCert != "":
+		return cfg.TLSCert
+	case cfg.TLSSelfSigned:
+		return filepath.Join(stateDir, selfSignedCertFile)
+	}
+	return ""
+}
+
+// ensureSelfSignedCert returns a certificate and key in dir covering hosts,
+// generating them unless a current pair that covers every host exists.
+func ensureSelfSignedCert(dir string, hosts []string) (certFile, keyFile string, err error) {
+	certFile = filepath.Join(dir, selfSignedCertFile)
+	keyFile = filepath.Join(dir, selfSignedKeyFile)
+	if selfSignedCertUsable(certFile, keyFile, hosts) {
+		return certFile, keyFile, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", fmt.Errorf("server: generate key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", "", fmt.Errorf("server: generate serial: %w", err)
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"babble"}, CommonName: "babble self-signed"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return "", "", fmt.Errorf("server: create certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", "", fmt.Errorf("server: marshal key: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", "", fmt.Errorf("server: mkdir %s: %w", dir, err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		return "", "", fmt.Errorf("server: write key: %w", err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		return "", "", fmt.Errorf("server: write certificate: %w", err)
+	}
+	return certFile, keyFile, nil
+}
+
+// selfSignedCertUsable reports whether the pair at certFile and keyFile
+// loads, is not close to expiry, and covers every host.
+func selfSignedCertUsable(certFile, keyFile string, hosts []string) bool {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return false
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil || time.Until(cert.NotAfter) < selfSignedRenewBefore {
+		return false
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			if !slices.ContainsFunc(cert.IPAddresses, ip.Equal) {
+				return false
+			}
+		} else if !slices.Contains(cert.DNSNames, h) {
+			return false
+		}
+	}
+	return true
+}
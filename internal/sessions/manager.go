@@ -35,27 +35,36 @@ import (
 type Manager struct {
 	watchPath string
 	eventCh   chan<- *events.BabbleEvent
+	host      string // stamped on every event so clients can filter by machine
 
 	done chan struct{} // closed by Stop to signal all goroutines to exit
 
 	mu      sync.Mutex
 	tailing map[string]chan struct{} // path → per-file write-notify channel
+
+	tailers sync.WaitGroup // running tail goroutines; only Start's goroutine adds
 }
 
 // NewManager creates a Manager that watches watchPath and sends parsed events
-// to eventCh.
+// to eventCh. Each event's Host is set to the local hostname.
 func NewManager(watchPath string, eventCh chan<- *events.BabbleEvent) *Manager {
+	host, err := os.Hostname()
+	if err != nil {
+		log.Printf("sessions: hostname: %v", err)
+	}
 	return &Manager{
 		watchPath: watchPath,
 		eventCh:   eventCh,
+		host:      host,
 		done:      make(chan struct{}),
 		tailing:   make(map[string]chan struct{}),
 	}
 }
 
 // Start begins watching for new and modified JSONL files. It blocks until Stop
-// is called, then returns nil. Any watcher initialisation error is returned
-// immediately.
+// is called, then returns nil once every tailer has exited, so no event is
+// sent on eventCh after Start returns. Any watcher initialisation error is
+// returned immediately.
 func (m *Manager) Start() error {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
@@ -77,6 +86,7 @@ func (m *Manager) Start() error {
 	for {
 		select {
 		case <-m.done:
+			m.tailers.Wait()
 			return nil
 
 		case ev, ok := <-watcher.Events:
@@ -89,6 +99,7 @@ func (m *Manager) Start() error {
 			if !ok {
 				return nil
 			}
+			watchErrors.Inc()
 			log.Printf("sessions: watcher error: %v", fsErr)
 		}
 	}
@@ -254,7 +265,11 @@ func (m *Manager) startTailing(path string, seekEnd bool) {
 	m.mu.Unlock()
 
 	isSubagent := strings.Contains(path, "/subagents/")
-	go m.tail(path, seekEnd, notifyCh, isSubagent)
+	m.tailers.Add(1)
+	go func() {
+		defer m.tailers.Done()
+		m.tail(path, seekEnd, notifyCh, isSubagent)
+	}()
 }
 
 // notifyWrite wakes up the tailer goroutine for path, if one exists.
@@ -284,13 +299,18 @@ func (m *Manager) tail(path string, seekEnd bool, notifyCh <-chan struct{}, isSu
 
 	f, err := os.Open(path)
 	if err != nil {
+		readErrors.Inc()
 		log.Printf("sessions: open %s: %v", path, err)
 		return
 	}
 	defer f.Close()
+	filesOpened.Inc()
+	tailedFiles.Inc()
+	defer tailedFiles.Dec()
 
 	if seekEnd {
 		if _, err := f.Seek(0, io.SeekEnd); err != nil {
+			readErrors.Inc()
 			log.Printf("sessions: seek %s: %v", path, err)
 			return
 		}
@@ -302,6 +322,7 @@ func (m *Manager) tail(path string, seekEnd bool, notifyCh <-chan struct{}, isSu
 		line, err := reader.ReadBytes('\n')
 		if err != nil {
 			if !errors.Is(err, io.EOF) {
+				readErrors.Inc()
 				log.Printf("sessions: read %s: %v", path, err)
 				return
 			}
@@ -319,10 +340,12 @@ func (m *Manager) tail(path string, seekEnd bool, notifyCh <-chan struct{}, isSu
 			continue
 		}
 
+		bytesRead.Add(uint64(len(line)))
 		trimmed := strings.TrimRight(string(line), "\r\n")
 		if trimmed == "" {
 			continue
 		}
+		linesRead.Inc()
 
 		ev, parseErr := events.ParseLine([]byte(trimmed))
 		if parseErr != nil {
@@ -334,6 +357,10 @@ func (m *Manager) tail(path string, seekEnd bool, notifyCh <-chan struct{}, isSu
 		}
 
 		ev.IsSubagent = isSubagent
+		if isSubagent && ev.AgentID == "" {
+			ev.AgentID = agentIDFromPath(path)
+		}
+		ev.Host = m.host
 
 		select {
 		case m.eventCh <- ev:
@@ -349,6 +376,13 @@ func isDir(path string) bool {
 	return err == nil && fi.IsDir()
 }
 
+// agentIDFromPath returns the agent ID in a subagent log's name, as in
+// agent-{agentId}.jsonl, for logs whose lines do not record it.
+func agentIDFromPath(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), ".jsonl")
+	return strings.TrimPrefix(name, "agent-")
+}
+
 // isJSONL reports whether path has the .jsonl extension.
 func isJSONL(path string) bool {
 	return strings.HasSuffix(path, ".jsonl")
@@ -301,6 +301,9 @@ func TestManagerTailsSubagentFiles(t *testing.T) {
 	if !ev.IsSubagent {
 		t.Error("expected IsSubagent=true for event from subagent file")
 	}
+	if ev.AgentID != "xyz" {
+		t.Errorf("agentID = %q, want %q", ev.AgentID, "xyz")
+	}
 }
 
 // TestManagerTailsNewSubagentFile verifies that when a new subagent JSONL file
@@ -403,3 +406,47 @@ done:
 		t.Errorf("received %d Bash events, want exactly 1 (dedup check)", bashCount)
 	}
 }
+
+// TestManagerStats verifies that tailing a file is reflected in ReadStats.
+func TestManagerStats(t *testing.T) {
+	root := t.TempDir()
+	projectDir := filepath.Join(root, "stats")
+	if err := os.MkdirAll(projectDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	before := sessions.ReadStats()
+
+	eventCh := make(chan *events.BabbleEvent, 32)
+	m := sessions.NewManager(root, eventCh)
+	errCh := make(chan error, 1)
+	go func() { errCh <- m.Start() }()
+	time.Sleep(200 * time.Millisecond)
+
+	line := bashLine("/home/user/stats")
+	if err := os.WriteFile(filepath.Join(projectDir, "s.jsonl"), []byte(line+"\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if ev := receiveWithin(t, eventCh, func(ev *events.BabbleEvent) bool { return ev.Event == "Bash" }, 2*time.Second); ev == nil {
+		t.Fatal("timed out waiting for Bash event")
+	}
+
+	during := sessions.ReadStats()
+	if during.TailedFiles < 1 {
+		t.Errorf("TailedFiles = %d while tailing, want at least 1", during.TailedFiles)
+	}
+	if got := during.FilesOpened - before.FilesOpened; got != 1 {
+		t.Errorf("FilesOpened rose by %d, want 1", got)
+	}
+	if got := during.LinesRead - before.LinesRead; got != 1 {
+		t.Errorf("LinesRead rose by %d, want 1 (blank lines are not counted)", got)
+	}
+	if got := during.BytesRead - before.BytesRead; got != uint64(len(line)+1) {
+		t.Errorf("BytesRead rose by %d, want %d", got, len(line)+1)
+	}
+
+	m.Stop()
+	if err := <-errCh; err != nil {
+		t.Errorf("Start() returned error: %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package sessions
+
+import "github.com/dacort/babble/internal/metrics"
+
+var (
+	tailedFiles = metrics.Default.Gauge("babble_sessions_tailed_files", "Session log files currently being tailed.")
+	filesOpened = metrics.Default.Counter("babble_sessions_files_opened_total", "Session log files opened for tailing.")
+	linesRead   = metrics.Default.Counter("babble_sessions_lines_read_total", "Non-empty lines read from session logs.")
+	bytesRead   = metrics.Default.Counter("babble_sessions_bytes_read_total", "Bytes read from session logs.")
+	readErrors  = metrics.Default.Counter("babble_sessions_read_errors_total", "Failures to open, seek or read a session log.")
+	watchErrors = metrics.Default.Counter("babble_sessions_watch_errors_total", "Errors reported by the file watcher.")
+)
+
+// Stats counts the work of every Manager in the process.
+type Stats struct {
+	TailedFiles int64  `json:"tailedFiles"`
+	FilesOpened uint64 `json:"filesOpened"`
+	LinesRead   uint64 `json:"linesRead"`
+	BytesRead   uint64 `json:"bytesRead"`
+	ReadErrors  uint64 `json:"readErrors"`
+	WatchErrors uint64 `json:"watchErrors"`
+}
+
+// ReadStats returns the current counts.
+func ReadStats() Stats {
+	return Stats{
+		TailedFiles: tailedFiles.Value(),
+		FilesOpened: filesOpened.Value(),
+		LinesRead:   linesRead.Value(),
+		BytesRead:   bytesRead.Value(),
+		ReadErrors:  readErrors.Value(),
+		WatchErrors: watchErrors.Value(),
+	}
+}
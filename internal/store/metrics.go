@@ -0,0 +1,9 @@
+package store
+
+import "github.com/dacort/babble/internal/metrics"
+
+var (
+	eventsWritten  = metrics.Default.Counter("babble_store_events_written_total", "Events appended to the event log.")
+	writeErrors    = metrics.Default.Counter("babble_store_write_errors_total", "Events that could not be appended to the event log.")
+	segmentsPruned = metrics.Default.Counter("babble_store_segments_pruned_total", "Event log segments deleted by the retention policy.")
+)
@@ -0,0 +1,423 @@
+// Package store keeps a durable log of the events babble broadcasts, so that
+// they can be queried after they have left the in-memory history.
+//
+// Events are appended as JSON lines to segment files in a directory. Each
+// segment is named after the Seq of its first event, which lets a query that
+// resumes from a cursor skip whole segments. Old segments are deleted to keep
+// the log within a maximum age and total size.
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dacort/babble/internal/events"
+)
+
+const (
+	// segmentExt is the extension of segment files.
+	segmentExt = ".jsonl"
+	// maxSegmentBytes is the size at which a segment is closed and a new one
+	// started. Smaller logs use smaller segments; see segmentLimit.
+	maxSegmentBytes = 4 << 20
+	// maxSegmentAge is how long a segment is written to before a new one is
+	// started, so that age-based retention can free space a day at a time.
+	maxSegmentAge = 24 * time.Hour
+	// pruneInterval is how often Append applies the retention policy.
+	pruneInterval = time.Minute
+	// maxLineBytes bounds a single stored event when reading it back.
+	maxLineBytes = 1 << 20
+)
+
+// ErrClosed is returned by Append after Close.
+var ErrClosed = errors.New("store: closed")
+
+// Retention bounds how much of the log is kept. Zero fields are unlimited.
+type Retention struct {
+	MaxAge   time.Duration // delete segments last written longer ago than this
+	MaxBytes int64         // delete the oldest segments while the log is larger
+}
+
+// segment is one file of the log.
+type segment struct {
+	path    string
+	first   uint64 // Seq of the first event, from the file name
+	size    int64
+	modTime time.Time // when the last event was written
+}
+
+// Store is an append-only, segmented event log. It is safe for concurrent
+// use: one goroutine appends while any number query.
+type Store struct {
+	dir string
+
+	mu        sync.Mutex
+	retention Retention
+	segments  []*segment // oldest first; the last is being written to
+	f         *os.File   // the last segment, open for appending; nil until the first Append
+	opened    time.Time  // when f was opened
+	lastSeq   uint64
+	lastPrune time.Time
+	closed    bool
+}
+
+// Open opens the log in dir, creating the directory if needed, and applies
+// retention. A final line left incomplete by a crash is discarded.
+func Open(dir string, retention Retention) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("store: mkdir %s: %w", dir, err)
+	}
+	s := &Store{dir: dir, retention: retention}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.pruneLocked(time.Now())
+	s.mu.Unlock()
+	return s, nil
+}
+
+// load lists the existing segments and recovers the last Seq written.
+func (s *Store) load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("store: %w", err)
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		first, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return fmt.Errorf("store: %w", err)
+		}
+		s.segments = append(s.segments, &segment{
+			path:    filepath.Join(s.dir, name),
+			first:   first,
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+	}
+	slices.SortFunc(s.segments, func(a, b *segment) int {
+		switch {
+		case a.first < b.first:
+			return -1
+		case a.first > b.first:
+			return 1
+		}
+		return 0
+	})
+
+	// Recover the last Seq from the newest segment that has a complete line.
+	for i := len(s.segments) - 1; i >= 0; i-- {
+		seq, err := recoverTail(s.segments[i])
+		if err != nil {
+			return err
+		}
+		if seq > 0 {
+			s.lastSeq = seq
+			break
+		}
+	}
+	return nil
+}
+
+// recoverTail truncates seg after its last complete line and returns the Seq
+// of the event on that line, or 0 if it has none.
+func recoverTail(seg *segment) (uint64, error) {
+	data, err := os.ReadFile(seg.path)
+	if err != nil {
+		return 0, fmt.Errorf("store: %w", err)
+	}
+	end := bytes.LastIndexByte(data, '\n') + 1
+	if end < len(data) {
+		log.Printf("store: discarding incomplete last line of %s", seg.path)
+		if err := os.Truncate(seg.path, int64(end)); err != nil {
+			return 0, fmt.Errorf("store: %w", err)
+		}
+		seg.size = int64(end)
+	}
+	lines := bytes.Split(bytes.TrimSuffix(data[:end], []byte("\n")), []byte("\n"))
+	for i := len(lines) - 1; i >= 0; i-- {
+		var ev events.BabbleEvent
+		if json.Unmarshal(lines[i], &ev) == nil && ev.Seq > 0 {
+			return ev.Seq, nil
+		}
+	}
+	return 0, nil
+}
+
+// LastSeq returns the Seq of the last event in the log, or 0 if it is empty.
+// The server continues numbering from here, so that Seq — and with it the
+// query cursor — keeps increasing across restarts.
+func (s *Store) LastSeq() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastSeq
+}
+
+// SetRetention changes the retention policy. It is applied on the next
+// Append.
+func (s *Store) SetRetention(r Retention) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retention = r
+	s.lastPrune = time.Time{}
+}
+
+// Size returns the total size of the log in bytes.
+func (s *Store) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for _, seg := range s.segments {
+		n += seg.size
+	}
+	return n
+}
+
+// Append writes ev to the end of the log. Events must be appended in
+// increasing Seq order.
+func (s *Store) Append(ev *events.BabbleEvent) error {
+	line, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("store: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	now := time.Now()
+	if err := s.rotateLocked(ev.Seq, now); err != nil {
+		writeErrors.Inc()
+		return err
+	}
+	seg := s.segments[len(s.segments)-1]
+	n, err := s.f.Write(line)
+	seg.size += int64(n)
+	seg.modTime = now
+	if err != nil {
+		writeErrors.Inc()
+		return fmt.Errorf("store: write %s: %w", seg.path, err)
+	}
+	eventsWritten.Inc()
+	s.lastSeq = ev.Seq
+
+	if now.Sub(s.lastPrune) >= pruneInterval {
+		s.pruneLocked(now)
+	}
+	return nil
+}
+
+// rotateLocked makes sure there is an open segment to append the event
+// numbered seq to, starting a new one if the current one is full or old. The
+// caller must hold s.mu.
+func (s *Store) rotateLocked(seq uint64, now time.Time) error {
+	if s.f == nil && len(s.segments) > 0 {
+		// Continue the newest segment left by a previous run.
+		seg := s.segments[len(s.segments)-1]
+		f, err := os.OpenFile(seg.path, os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return fmt.Errorf("store: %w", err)
+		}
+		s.f, s.opened = f, now
+	}
+	if s.f != nil {
+		seg := s.segments[len(s.segments)-1]
+		if seg.size == 0 || (seg.size < s.segmentLimit() && now.Sub(s.opened) < maxSegmentAge) {
+			return nil
+		}
+		if err := s.f.Close(); err != nil {
+			log.Printf("store: close %s: %v", seg.path, err)
+		}
+		s.f = nil
+		s.lastPrune = time.Time{} // a full segment may now be prunable
+	}
+
+	path := filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, segmentExt))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("store: %w", err)
+	}
+	s.f, s.opened = f, now
+	s.segments = append(s.segments, &segment{path: path, first: seq, modTime: now})
+	return nil
+}
+
+// segmentLimit returns the size at which to start a new segment: small
+// enough that the size limit can be met by deleting whole segments.
+func (s *Store) segmentLimit() int64 {
+	limit := int64(maxSegmentBytes)
+	if s.retention.MaxBytes > 0 {
+		limit = min(limit, max(s.retention.MaxBytes/8, 1))
+	}
+	return limit
+}
+
+// pruneLocked deletes segments older than the maximum age, then the oldest
+// segments while the log is over the maximum size. The segment being written
+// to is only deleted for age, once nothing has been written to it for that
+// long. The caller must hold s.mu.
+func (s *Store) pruneLocked(now time.Time) {
+	s.lastPrune = now
+	r := s.retention
+
+	var total int64
+	for _, seg := range s.segments {
+		total += seg.size
+	}
+	keep := s.segments[:0]
+	for i, seg := range s.segments {
+		last := i == len(s.segments)-1
+		expired := r.MaxAge > 0 && now.Sub(seg.modTime) > r.MaxAge
+		oversize := r.MaxBytes > 0 && total > r.MaxBytes && !last
+		if !expired && !oversize {
+			keep = append(keep, seg)
+			continue
+		}
+		if last && s.f != nil {
+			s.f.Close()
+			s.f = nil
+		}
+		if err := os.Remove(seg.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("store: prune: %v", err)
+			keep = append(keep, seg)
+			continue
+		}
+		total -= seg.size
+		segmentsPruned.Inc()
+	}
+	clear(s.segments[len(keep):])
+	s.segments = keep
+}
+
+// Close closes the segment being written to. Queries still work afterwards.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
+
+// Query selects events from the log. Zero fields do not filter.
+type Query struct {
+	After uint64                         // only events with a greater Seq: the cursor
+	Since time.Time                      // only events with a Timestamp at or after Since
+	Until time.Time                      // only events with a Timestamp before Until
+	Match func(*events.BabbleEvent) bool // only events Match accepts
+	Limit int                            // at most Limit events; 0 for all
+}
+
+// Query returns the events q selects, oldest first. more reports whether
+// further events match beyond the Limit; pass the last event's Seq as After
+// to fetch them. Events without a valid Timestamp never match Since or Until.
+func (s *Store) Query(q Query) (evs []*events.BabbleEvent, more bool, err error) {
+	s.mu.Lock()
+	segs := make([]segment, len(s.segments))
+	for i, seg := range s.segments {
+		segs[i] = *seg
+	}
+	s.mu.Unlock()
+
+	for i, seg := range segs {
+		if i+1 < len(segs) && segs[i+1].first <= q.After+1 {
+			continue // every event in seg is at or before the cursor
+		}
+		if !q.Since.IsZero() && seg.modTime.Before(q.Since) {
+			continue // events are written after they happen
+		}
+		done, err := scanSegment(seg, func(ev *events.BabbleEvent) bool {
+			if !q.matches(ev) {
+				return true
+			}
+			if q.Limit > 0 && len(evs) == q.Limit {
+				more = true
+				return false
+			}
+			evs = append(evs, ev)
+			return true
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		if done {
+			break
+		}
+	}
+	return evs, more, nil
+}
+
+// matches reports whether ev passes every filter in q.
+func (q Query) matches(ev *events.BabbleEvent) bool {
+	if ev.Seq <= q.After {
+		return false
+	}
+	if !q.Since.IsZero() || !q.Until.IsZero() {
+		t, err := time.Parse(time.RFC3339Nano, ev.Timestamp)
+		if err != nil {
+			return false
+		}
+		if !q.Since.IsZero() && t.Before(q.Since) {
+			return false
+		}
+		if !q.Until.IsZero() && !t.Before(q.Until) {
+			return false
+		}
+	}
+	return q.Match == nil || q.Match(ev)
+}
+
+// scanSegment calls fn with each event in the first seg.size bytes of seg
+// until fn returns false, in which case it reports done. A segment deleted
+// in the meantime is treated as empty, and unreadable lines are skipped.
+func scanSegment(seg segment, fn func(*events.BabbleEvent) bool) (done bool, err error) {
+	f, err := os.Open(seg.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("store: %w", err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(io.LimitReader(f, seg.size))
+	sc.Buffer(nil, maxLineBytes)
+	for sc.Scan() {
+		var ev events.BabbleEvent
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			continue
+		}
+		if !fn(&ev) {
+			return true, nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return false, fmt.Errorf("store: read %s: %w", seg.path, err)
+	}
+	return false, nil
+}
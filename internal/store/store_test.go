@@ -0,0 +1,193 @@
+package store_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dacort/babble/internal/events"
+	"github.com/dacort/babble/internal/store"
+)
+
+// base is the timestamp of the first test event; each later one is a minute
+// after the previous.
+var base = time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+// testEvent returns the event numbered seq, alternating between two sessions
+// and two categories.
+func testEvent(seq uint64) *events.BabbleEvent {
+	session, category := "api", events.CategoryRead
+	if seq%2 == 0 {
+		session, category = "web", events.CategoryWrite
+	}
+	return &events.BabbleEvent{
+		Seq:       seq,
+		Session:   session,
+		Category:  category,
+		Event:     "Tool",
+		Timestamp: base.Add(time.Duration(seq-1) * time.Minute).Format(time.RFC3339Nano),
+	}
+}
+
+// appendEvents appends events first..last to s.
+func appendEvents(t *testing.T, s *store.Store, first, last uint64) {
+	t.Helper()
+	for seq := first; seq <= last; seq++ {
+		if err := s.Append(testEvent(seq)); err != nil {
+			t.Fatalf("Append %d: %v", seq, err)
+		}
+	}
+}
+
+// seqs returns the Seq of each event.
+func seqs(evs []*events.BabbleEvent) []uint64 {
+	out := make([]uint64, len(evs))
+	for i, ev := range evs {
+		out[i] = ev.Seq
+	}
+	return out
+}
+
+// TestQuery checks filtering by match function and time range, and paging
+// through results with the cursor.
+func TestQuery(t *testing.T) {
+	s, err := store.Open(t.TempDir(), store.Retention{})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+	appendEvents(t, s, 1, 10)
+
+	evs, more, err := s.Query(store.Query{
+		Match: func(ev *events.BabbleEvent) bool { return ev.Session == "api" },
+	})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if got := fmt.Sprint(seqs(evs)); got != "[1 3 5 7 9]" || more {
+		t.Errorf("session api: got %s more=%v, want [1 3 5 7 9] more=false", got, more)
+	}
+
+	evs, _, err = s.Query(store.Query{Since: base.Add(3 * time.Minute), Until: base.Add(6 * time.Minute)})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if got := fmt.Sprint(seqs(evs)); got != "[4 5 6]" {
+		t.Errorf("since/until: got %s, want [4 5 6]", got)
+	}
+
+	var pages []string
+	var after uint64
+	for {
+		evs, more, err := s.Query(store.Query{After: after, Limit: 4})
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		pages = append(pages, fmt.Sprint(seqs(evs)))
+		if !more {
+			break
+		}
+		after = evs[len(evs)-1].Seq
+	}
+	if got := fmt.Sprint(pages); got != "[[1 2 3 4] [5 6 7 8] [9 10]]" {
+		t.Errorf("pages = %s, want [[1 2 3 4] [5 6 7 8] [9 10]]", got)
+	}
+}
+
+// TestReopen checks that a reopened log recovers its last Seq, discards an
+// incomplete final line, and carries on appending.
+func TestReopen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := store.Open(dir, store.Retention{})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	appendEvents(t, s, 1, 3)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := s.Append(testEvent(4)); err != store.ErrClosed {
+		t.Errorf("Append after Close = %v, want ErrClosed", err)
+	}
+
+	// Simulate a crash part-way through writing an event.
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if len(matches) != 1 {
+		t.Fatalf("segments = %v, want 1", matches)
+	}
+	f, err := os.OpenFile(matches[0], os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"seq":4,"sess`)
+	f.Close()
+
+	s, err = store.Open(dir, store.Retention{})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer s.Close()
+	if got := s.LastSeq(); got != 3 {
+		t.Errorf("LastSeq = %d, want 3", got)
+	}
+	appendEvents(t, s, 4, 5)
+	evs, _, err := s.Query(store.Query{})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if got := fmt.Sprint(seqs(evs)); got != "[1 2 3 4 5]" {
+		t.Errorf("events = %s, want [1 2 3 4 5]", got)
+	}
+}
+
+// TestRetention checks that the oldest segments are deleted to stay under
+// the size limit, and segments past the age limit are deleted on Open.
+func TestRetention(t *testing.T) {
+	dir := t.TempDir()
+	const maxBytes = 2000
+	s, err := store.Open(dir, store.Retention{MaxBytes: maxBytes})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	appendEvents(t, s, 1, 200)
+	s.SetRetention(store.Retention{MaxBytes: maxBytes}) // prune on the next Append
+	appendEvents(t, s, 201, 201)
+
+	if size := s.Size(); size > maxBytes {
+		t.Errorf("Size = %d, want at most %d", size, maxBytes)
+	}
+	evs, _, err := s.Query(store.Query{})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(evs) == 0 || evs[len(evs)-1].Seq != 201 || evs[0].Seq == 1 {
+		t.Errorf("kept events %v, want the newest only", seqs(evs))
+	}
+	s.Close()
+
+	// Age every segment past the limit.
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	old := time.Now().Add(-48 * time.Hour)
+	for _, m := range matches {
+		if err := os.Chtimes(m, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err = store.Open(dir, store.Retention{MaxAge: 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer s.Close()
+	if size := s.Size(); size != 0 {
+		t.Errorf("Size after age pruning = %d, want 0", size)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.jsonl")); len(matches) != 0 {
+		t.Errorf("segments left: %v", matches)
+	}
+	// Numbering carries on from the pruned log's last event.
+	if got := s.LastSeq(); got != 201 {
+		t.Errorf("LastSeq = %d, want 201", got)
+	}
+}
@@ -16,6 +16,7 @@ func main() {
 		os.Exit(0)
 	}
 
+	cmd.Version = version
 	if err := cmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)